@@ -1,7 +1,7 @@
 /*
 Package cloudapi interacts with the Cloud API (http://apidocs.joyent.com/cloudapi/).
 
-Licensed under the Mozilla Public License version 2.0
+Licensed under the Mozilla Public License version 2.0.
 
 Copyright (c) Joyent Inc.
 */
@@ -42,7 +42,9 @@ const (
 	apiFirewallRulesEnable     = "enable"
 	apiFirewallRulesDisable    = "disable"
 	apiNetworks                = "networks"
-	apiFabricVLANs             = "fabrics/default/vlans"
+	apiNetworkIPs              = "ips"
+	apiFabrics                 = "fabrics"
+	apiFabricVLANs             = "vlans"
 	apiFabricNetworks          = "networks"
 	apiNICs                    = "nics"
 	apiServices                = "services"
@@ -61,11 +63,12 @@ const (
 // Client provides a means to access the Joyent CloudAPI
 type Client struct {
 	client client.Client
+	fabric string
 }
 
 // New creates a new Client.
 func New(client client.Client) *Client {
-	return &Client{client}
+	return &Client{client: client, fabric: DefaultFabric}
 }
 
 // Filter represents a filter that can be applied to an API request.
@@ -98,6 +101,7 @@ type request struct {
 	resp           interface{}
 	respHeader     *http.Header
 	expectedStatus int
+	otherStatuses  []int // statuses also expected, such as that of a followed redirect
 }
 
 // Helper method to send an API request
@@ -115,7 +119,7 @@ func (c *Client) sendRequest(req request) (*jh.ResponseData, error) {
 	respData := jh.ResponseData{
 		RespValue:      req.resp,
 		RespHeaders:    req.respHeader,
-		ExpectedStatus: []int{req.expectedStatus},
+		ExpectedStatus: append([]int{req.expectedStatus}, req.otherStatuses...),
 	}
 	err := c.client.SendRequest(req.method, req.url, "", &request, &respData)
 	return &respData, err
@@ -23,7 +23,9 @@ func (c *Client) ListDatacenters() (map[string]interface{}, error) {
 }
 
 // GetDatacenter gets an individual datacenter by name. Returns an HTTP redirect
-// to your client, the datacenter URL is in the Location header.
+// to your client, the datacenter URL is in the Location header. HTTP clients
+// that follow the redirect lose the header, in which case the URL is looked up
+// in ListDatacenters instead.
 // See API docs: http://apidocs.joyent.com/cloudapi/#GetDatacenter
 func (c *Client) GetDatacenter(datacenterName string) (string, error) {
 	var respHeader http.Header
@@ -32,10 +34,22 @@ func (c *Client) GetDatacenter(datacenterName string) (string, error) {
 		url:            makeURL(apiDatacenters, datacenterName),
 		respHeader:     &respHeader,
 		expectedStatus: http.StatusFound,
+		otherStatuses:  []int{http.StatusOK},
 	}
 	respData, err := c.sendRequest(req)
 	if err != nil {
 		return "", errors.Newf(err, "failed to get datacenter with name: %s", datacenterName)
 	}
-	return respData.RespHeaders.Get("Location"), nil
+	if location := respData.RespHeaders.Get("Location"); location != "" {
+		return location, nil
+	}
+	dcs, err := c.ListDatacenters()
+	if err != nil {
+		return "", errors.Newf(err, "failed to get datacenter with name: %s", datacenterName)
+	}
+	url, ok := dcs[datacenterName].(string)
+	if !ok {
+		return "", errors.Newf(nil, "failed to get datacenter with name: %s", datacenterName)
+	}
+	return url, nil
 }
@@ -0,0 +1,48 @@
+package cloudapi_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	gc "launchpad.net/gocheck"
+
+	lc "github.com/joyent/gosdc/localservices/cloudapi"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (s *LocalTests) TestListDatacenters(c *gc.C) {
+	dcs, err := s.testClient.ListDatacenters()
+	c.Assert(err, gc.IsNil)
+	c.Assert(dcs, gc.HasLen, 1)
+}
+
+func (s *LocalTests) TestGetDatacenter(c *gc.C) {
+	dcs, err := s.cloudapi.ListDatacenters()
+	c.Assert(err, gc.IsNil)
+	defer s.cloudapi.SetDatacenters(dcs)
+
+	mux := httprouter.New()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	east := lc.New(server.URL, s.creds.UserAuthentication.User)
+	east.SetupHTTP(mux)
+	// the root of the datacenter, where a followed redirect lands
+	mux.GET("/", func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {})
+	lc.JoinRegion(map[string]*lc.CloudAPI{lc.DefaultDatacenter: s.cloudapi, "us-east-1": east})
+
+	// the client gets the datacenter URL whether or not it follows the
+	// redirect
+	url, err := s.testClient.GetDatacenter("us-east-1")
+	c.Assert(err, gc.IsNil)
+	c.Assert(url, gc.Equals, server.URL)
+
+	_, err = s.testClient.GetDatacenter("missing")
+	c.Assert(err, gc.ErrorMatches, "failed to get datacenter with name: missing(.|\n)*")
+
+	// a failure of the request is not hidden by the list of datacenters
+	fault, err := s.cloudapi.AddFault(lc.Fault{Operation: "GetDatacenter", Status: http.StatusInternalServerError})
+	c.Assert(err, gc.IsNil)
+	defer s.cloudapi.RemoveFault(fault.Id)
+	_, err = s.testClient.GetDatacenter("us-east-1")
+	c.Assert(err, gc.ErrorMatches, "failed to get datacenter with name: us-east-1(.|\n)*")
+}
@@ -0,0 +1,207 @@
+//
+// gosdc - Go library to interact with the Joyent CloudAPI
+//
+// Fabric subnet planning
+//
+// Copyright (c) Joyent Inc.
+//
+
+package cloudapi
+
+import (
+	"net/netip"
+
+	"github.com/joyent/gocommon/errors"
+)
+
+// AnyVLANID is the ID to give the VLAN of CreatePlannedFabricNetwork for it to
+// get the lowest free ID above 0. Any other ID, 0 included, is used as is.
+const AnyVLANID int16 = -1
+
+// SubnetPlanner hands out subnets of a supernet that do not overlap each
+// other nor the subnets of existing fabric networks
+type SubnetPlanner struct {
+	supernet netip.Prefix
+	used     []netip.Prefix
+}
+
+// NewSubnetPlanner returns a planner for the given supernet, in CIDR
+// notation, that keeps clear of the subnets of the given networks. The
+// supernet may be IPv4 or IPv6, but only IPv4 subnets can be planned as
+// networks by Plan.
+func NewSubnetPlanner(supernet string, existing ...FabricNetwork) (*SubnetPlanner, error) {
+	prefix, err := netip.ParsePrefix(supernet)
+	if err != nil {
+		return nil, errors.NewInvalidArgumentf(err, nil, "supernet %q is not in CIDR notation", supernet)
+	}
+	p := &SubnetPlanner{supernet: prefix.Masked()}
+	for _, network := range existing {
+		for _, s := range []string{network.Subnet, network.Subnet6} {
+			if subnet, err := netip.ParsePrefix(s); err == nil {
+				p.used = append(p.used, subnet.Masked())
+			}
+		}
+	}
+	return p, nil
+}
+
+// Supernet returns the subnet the planner hands out subnets of
+func (p *SubnetPlanner) Supernet() netip.Prefix {
+	return p.supernet
+}
+
+// Next returns the lowest free subnet of the supernet with the given prefix
+// length, and marks it as used.
+func (p *SubnetPlanner) Next(bits int) (netip.Prefix, error) {
+	if bits < p.supernet.Bits() || bits > p.supernet.Addr().BitLen() {
+		return netip.Prefix{}, errors.NewInvalidArgumentf(nil, nil, "a /%d subnet does not fit in supernet %s", bits, p.supernet)
+	}
+	addr := p.supernet.Addr()
+	for addr.IsValid() && p.supernet.Contains(addr) {
+		candidate := netip.PrefixFrom(addr, bits)
+		overlapping, skip := false, candidate
+		for _, used := range p.used {
+			if used.Overlaps(candidate) {
+				overlapping = true
+				if used.Bits() < skip.Bits() {
+					skip = used
+				}
+			}
+		}
+		if !overlapping {
+			p.used = append(p.used, candidate)
+			return candidate, nil
+		}
+		// skip past the larger of the candidate and the subnets it overlaps
+		addr = LastAddr(skip).Next()
+	}
+	return netip.Prefix{}, errors.NewInvalidArgumentf(nil, nil, "no /%d subnet is free in supernet %s", bits, p.supernet)
+}
+
+// Plan returns the options to create a network named name on the next free
+// subnet with the given prefix length. The gateway is the first address of
+// the subnet, and the provision range runs from the address after it up to
+// the last but one, the last being the broadcast address. The supernet must
+// be IPv4, as the subnet of a fabric network is.
+func (p *SubnetPlanner) Plan(name string, bits int) (CreateFabricNetworkOpts, error) {
+	if !p.supernet.Addr().Is4() {
+		return CreateFabricNetworkOpts{}, errors.NewInvalidArgumentf(nil, nil, "cannot plan network %s in IPv6 supernet %s: the subnet of a network is IPv4", name, p.supernet)
+	}
+	if bits > p.supernet.Addr().BitLen()-2 {
+		return CreateFabricNetworkOpts{}, errors.NewInvalidArgumentf(nil, nil, "a /%d subnet has no room for a gateway and a provision range", bits)
+	}
+	subnet, err := p.Next(bits)
+	if err != nil {
+		return CreateFabricNetworkOpts{}, err
+	}
+	gateway := subnet.Addr().Next()
+	return CreateFabricNetworkOpts{
+		Name:             name,
+		Subnet:           subnet.String(),
+		Gateway:          gateway.String(),
+		ProvisionStartIp: gateway.Next().String(),
+		ProvisionEndIp:   LastAddr(subnet).Prev().String(),
+	}, nil
+}
+
+// LastAddr returns the last address of a subnet, its broadcast address for
+// IPv4
+func LastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Masked().Addr().AsSlice()
+	for i := prefix.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> uint(i%8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// NewSubnetPlanner returns a planner for the given supernet that keeps clear
+// of the subnets of the networks of every VLAN of the fabric of the client.
+func (c *Client) NewSubnetPlanner(supernet string) (*SubnetPlanner, error) {
+	_, existing, err := c.listAllFabricNetworks()
+	if err != nil {
+		return nil, err
+	}
+	return NewSubnetPlanner(supernet, existing...)
+}
+
+// listAllFabricNetworks returns the VLANs of the fabric of the client and the
+// networks of all of them
+func (c *Client) listAllFabricNetworks() ([]FabricVLAN, []FabricNetwork, error) {
+	vlans, err := c.ListFabricVLANs()
+	if err != nil {
+		return nil, nil, err
+	}
+	var networks []FabricNetwork
+	for _, vlan := range vlans {
+		vlanNetworks, err := c.ListFabricNetworks(vlan.Id)
+		if err != nil {
+			return nil, nil, err
+		}
+		networks = append(networks, vlanNetworks...)
+	}
+	return vlans, networks, nil
+}
+
+// CreatePlannedFabricNetwork creates a VLAN and a network on it, on the next
+// free subnet of the supernet with the given prefix length, see
+// SubnetPlanner.Plan. The VLAN gets the lowest free ID above 0 if its ID is
+// AnyVLANID. The options give the name and the other fields of the network;
+// their subnet, provision range and gateway are replaced by the planned ones.
+// If the network cannot be created, the VLAN is deleted again.
+func (c *Client) CreatePlannedFabricNetwork(supernet string, bits int, vlan FabricVLAN, opts CreateFabricNetworkOpts) (*FabricVLAN, *FabricNetwork, error) {
+	vlans, existing, err := c.listAllFabricNetworks()
+	if err != nil {
+		return nil, nil, err
+	}
+	planner, err := NewSubnetPlanner(supernet, existing...)
+	if err != nil {
+		return nil, nil, err
+	}
+	planned, err := planner.Plan(opts.Name, bits)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts.Subnet, opts.Gateway = planned.Subnet, planned.Gateway
+	opts.ProvisionStartIp, opts.ProvisionEndIp = planned.ProvisionStartIp, planned.ProvisionEndIp
+	if err := opts.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	if vlan.Id == AnyVLANID {
+		if vlan.Id, err = freeVLANID(vlans); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := vlan.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	created, err := c.CreateFabricVLAN(vlan)
+	if err != nil {
+		return nil, nil, err
+	}
+	network, err := c.CreateFabricNetwork(created.Id, opts)
+	if err != nil {
+		if deleteErr := c.DeleteFabricVLAN(created.Id); deleteErr != nil {
+			return nil, nil, errors.Newf(err, "failed to create planned fabric network %s; VLAN %d is left behind: %v", opts.Name, created.Id, deleteErr)
+		}
+		return nil, nil, err
+	}
+	return created, network, nil
+}
+
+// freeVLANID returns the lowest VLAN ID above 0 none of the given VLANs has,
+// or an error if all are taken
+func freeVLANID(vlans []FabricVLAN) (int16, error) {
+	used := map[int16]bool{}
+	for _, vlan := range vlans {
+		used[vlan.Id] = true
+	}
+	for id := int16(1); id <= MaxVLANID; id++ {
+		if !used[id] {
+			return id, nil
+		}
+	}
+	return 0, errors.Newf(nil, "no VLAN ID is free")
+}
@@ -0,0 +1,116 @@
+package cloudapi_test
+
+import (
+	"net/netip"
+
+	"github.com/joyent/gocommon/errors"
+	"github.com/joyent/gosdc/cloudapi"
+	gc "launchpad.net/gocheck"
+)
+
+func (s *LocalTests) TestSubnetPlanner(c *gc.C) {
+	planner, err := cloudapi.NewSubnetPlanner("10.10.0.0/16",
+		cloudapi.FabricNetwork{Name: "first", Subnet: "10.10.0.0/24"},
+		cloudapi.FabricNetwork{Name: "wide", Subnet: "10.10.4.0/22"},
+		cloudapi.FabricNetwork{Name: "narrow", Subnet: "10.10.1.128/26"},
+		cloudapi.FabricNetwork{Name: "elsewhere", Subnet: "192.168.0.0/16"},
+	)
+	c.Assert(err, gc.IsNil)
+
+	var subnets []string
+	for i := 0; i < 4; i++ {
+		subnet, err := planner.Next(24)
+		c.Assert(err, gc.IsNil)
+		subnets = append(subnets, subnet.String())
+	}
+	c.Assert(subnets, gc.DeepEquals, []string{"10.10.2.0/24", "10.10.3.0/24", "10.10.8.0/24", "10.10.9.0/24"})
+
+	// smaller subnets fill the gaps left
+	subnet, err := planner.Next(26)
+	c.Assert(err, gc.IsNil)
+	c.Assert(subnet.String(), gc.Equals, "10.10.1.0/26")
+
+	opts, err := planner.Plan("planned", 28)
+	c.Assert(err, gc.IsNil)
+	c.Assert(opts, gc.DeepEquals, cloudapi.CreateFabricNetworkOpts{
+		Name:             "planned",
+		Subnet:           "10.10.1.64/28",
+		Gateway:          "10.10.1.65",
+		ProvisionStartIp: "10.10.1.66",
+		ProvisionEndIp:   "10.10.1.78",
+	})
+	c.Assert(opts.Validate(), gc.IsNil)
+}
+
+func (s *LocalTests) TestLastAddr(c *gc.C) {
+	c.Assert(cloudapi.LastAddr(netip.MustParsePrefix("10.10.1.64/28")).String(), gc.Equals, "10.10.1.79")
+	c.Assert(cloudapi.LastAddr(netip.MustParsePrefix("10.10.1.70/28")).String(), gc.Equals, "10.10.1.79")
+	c.Assert(cloudapi.LastAddr(netip.MustParsePrefix("fd00:10::/64")).String(), gc.Equals, "fd00:10::ffff:ffff:ffff:ffff")
+}
+
+func (s *LocalTests) TestSubnetPlannerErrors(c *gc.C) {
+	_, err := cloudapi.NewSubnetPlanner("10.10.0.0")
+	c.Assert(errors.IsInvalidArgument(err), gc.Equals, true)
+
+	planner, err := cloudapi.NewSubnetPlanner("10.10.0.0/23", cloudapi.FabricNetwork{Subnet: "10.10.0.0/24"})
+	c.Assert(err, gc.IsNil)
+	_, err = planner.Next(16)
+	c.Assert(errors.IsInvalidArgument(err), gc.Equals, true)
+	_, err = planner.Plan("tiny", 31)
+	c.Assert(errors.IsInvalidArgument(err), gc.Equals, true)
+
+	_, err = planner.Next(24)
+	c.Assert(err, gc.IsNil)
+	_, err = planner.Next(24)
+	c.Assert(errors.IsInvalidArgument(err), gc.Equals, true)
+	c.Assert(err, gc.ErrorMatches, "no /24 subnet is free in supernet 10.10.0.0/23")
+
+	// IPv6 subnets can be handed out, but not planned as networks
+	planner, err = cloudapi.NewSubnetPlanner("fd00:10::/48")
+	c.Assert(err, gc.IsNil)
+	subnet, err := planner.Next(64)
+	c.Assert(err, gc.IsNil)
+	c.Assert(subnet.String(), gc.Equals, "fd00:10::/64")
+	_, err = planner.Plan("v6", 64)
+	c.Assert(errors.IsInvalidArgument(err), gc.Equals, true)
+}
+
+func (s *LocalTests) TestCreatePlannedFabricNetwork(c *gc.C) {
+	_, existing, cleanup := s.createFabricNetwork(c)
+	defer cleanup()
+
+	planner, err := s.testClient.NewSubnetPlanner("10.0.0.0/8")
+	c.Assert(err, gc.IsNil)
+	subnet, err := planner.Next(24)
+	c.Assert(err, gc.IsNil)
+	c.Assert(subnet.String(), gc.Equals, "10.1.0.0/24")
+
+	vlan, network, err := s.testClient.CreatePlannedFabricNetwork("10.0.0.0/8", 24,
+		cloudapi.FabricVLAN{Id: cloudapi.AnyVLANID, Name: "planned VLAN"},
+		cloudapi.CreateFabricNetworkOpts{Name: "planned network", Subnet: existing.Subnet, InternetNAT: true})
+	c.Assert(err, gc.IsNil)
+	defer func() {
+		c.Assert(s.testClient.DeleteFabricNetwork(vlan.Id, network.Id), gc.IsNil)
+		c.Assert(s.testClient.DeleteFabricVLAN(vlan.Id), gc.IsNil)
+	}()
+	c.Assert(vlan.Name, gc.Equals, "planned VLAN")
+	c.Assert(vlan.Id > 0, gc.Equals, true)
+	c.Assert(network.VLANId, gc.Equals, vlan.Id)
+	c.Assert(network.Name, gc.Equals, "planned network")
+	c.Assert(network.Subnet, gc.Equals, "10.1.0.0/24")
+	c.Assert(network.Gateway, gc.Equals, "10.1.0.1")
+	c.Assert(network.ProvisionStartIp, gc.Equals, "10.1.0.2")
+	c.Assert(network.ProvisionEndIp, gc.Equals, "10.1.0.254")
+	c.Assert(network.InternetNAT, gc.Equals, true)
+
+	// the VLAN is not left behind when the network cannot be created
+	vlans, err := s.testClient.ListFabricVLANs()
+	c.Assert(err, gc.IsNil)
+	_, _, err = s.testClient.CreatePlannedFabricNetwork("10.0.0.0/8", 24,
+		cloudapi.FabricVLAN{Id: 4000, Name: "failed VLAN"},
+		cloudapi.CreateFabricNetworkOpts{Name: "planned network"})
+	c.Assert(err, gc.NotNil)
+	after, err := s.testClient.ListFabricVLANs()
+	c.Assert(err, gc.IsNil)
+	c.Assert(after, gc.HasLen, len(vlans))
+}
@@ -1,13 +1,24 @@
 package cloudapi
 
 import (
+	"encoding/json"
 	"net/http"
+	"net/netip"
 	"strconv"
 
 	"github.com/joyent/gocommon/client"
 	"github.com/joyent/gocommon/errors"
 )
 
+const (
+	// DefaultFabric is the name of the fabric of an account, the one the
+	// client reaches unless told otherwise with WithFabric
+	DefaultFabric = "default"
+
+	// MaxVLANID is the highest ID a fabric VLAN can have
+	MaxVLANID = 4095
+)
+
 type FabricVLAN struct {
 	Id          int16  `json:"vlan_id"`               // Number between 0-4095 indicating VLAN Id
 	Name        string `json:"name"`                  // Unique name to identify VLAN
@@ -28,6 +39,11 @@ type FabricNetwork struct {
 	Routes           map[string]string `json:"routes,omitempty"`    // Map of CIDR block to Gateway IP Address
 	InternetNAT      bool              `json:"internet_nat"`        // If a NAT zone is provisioned at Gateway IP Address
 	VLANId           int16             `json:"vlan_id"`             // VLAN network is on
+
+	Subnet6           string `json:"subnet6,omitempty"`             // CIDR formatted string describing the IPv6 subnet of a dual-stack network
+	ProvisionStartIp6 string `json:"provision_start_ip6,omitempty"` // First IPv6 address on the network that can be assigned
+	ProvisionEndIp6   string `json:"provision_end_ip6,omitempty"`   // Last assignable IPv6 address on the network
+	Gateway6          string `json:"gateway6,omitempty"`            // Optional IPv6 gateway
 }
 
 type CreateFabricNetworkOpts struct {
@@ -40,6 +56,173 @@ type CreateFabricNetworkOpts struct {
 	Resolvers        []string          `json:"resolvers,omitempty"`   // Array of IP addresses for resolvers
 	Routes           map[string]string `json:"routes,omitempty"`      // Map of CIDR block to Gateway IP Address
 	InternetNAT      bool              `json:"internet_nat"`          // If a NAT zone is provisioned at Gateway IP Address
+
+	Subnet6           string `json:"subnet6,omitempty"`             // Optional CIDR formatted IPv6 subnet, making the network dual-stack
+	ProvisionStartIp6 string `json:"provision_start_ip6,omitempty"` // First IPv6 address on the network that can be assigned
+	ProvisionEndIp6   string `json:"provision_end_ip6,omitempty"`   // Last assignable IPv6 address on the network
+	Gateway6          string `json:"gateway6,omitempty"`            // Optional IPv6 gateway
+}
+
+// UpdateFabricNetworkOpts are the fields of a fabric network that can be
+// updated. Fields left empty or nil are not changed. A Description pointing
+// to "", or Resolvers or Routes that are empty but not nil, clear them.
+type UpdateFabricNetworkOpts struct {
+	Name        string            `json:"name,omitempty"`        // Network name
+	Description *string           `json:"description,omitempty"` // Description of network
+	Gateway     string            `json:"gateway,omitempty"`     // Gateway IP
+	Resolvers   []string          `json:"resolvers,omitempty"`   // Array of IP addresses for resolvers
+	Routes      map[string]string `json:"routes,omitempty"`      // Map of CIDR block to Gateway IP Address
+	Gateway6    string            `json:"gateway6,omitempty"`    // IPv6 gateway of a dual-stack network
+}
+
+type jsonUpdateFabricNetworkOpts UpdateFabricNetworkOpts
+
+// MarshalJSON turns the given UpdateFabricNetworkOpts into JSON, leaving out
+// Resolvers and Routes when they are nil but not when they are empty
+func (opts UpdateFabricNetworkOpts) MarshalJSON() ([]byte, error) {
+	jo := struct {
+		jsonUpdateFabricNetworkOpts
+		Resolvers *[]string          `json:"resolvers,omitempty"`
+		Routes    *map[string]string `json:"routes,omitempty"`
+	}{jsonUpdateFabricNetworkOpts: jsonUpdateFabricNetworkOpts(opts)}
+	if opts.Resolvers != nil {
+		jo.Resolvers = &opts.Resolvers
+	}
+	if opts.Routes != nil {
+		jo.Routes = &opts.Routes
+	}
+	return json.Marshal(&jo)
+}
+
+// Validate checks the VLAN for mistakes CloudAPI would reject it for, such as
+// an ID above MaxVLANID, without sending it.
+func (vlan FabricVLAN) Validate() error {
+	if vlan.Id < 0 || vlan.Id > MaxVLANID {
+		return errors.NewInvalidArgumentf(nil, nil, "VLAN ID %d is not between 0 and %d", vlan.Id, MaxVLANID)
+	}
+	if vlan.Name == "" {
+		return errors.NewInvalidArgumentf(nil, nil, "VLAN %d has no name", vlan.Id)
+	}
+	return nil
+}
+
+// Validate checks the options for mistakes CloudAPI would reject them for,
+// such as a gateway or provision range outside of the subnet, without
+// sending them. The subnet must be IPv4 and the optional Subnet6 IPv6. Both
+// are also checked against the subnets of the given networks, such as the
+// other networks of the VLAN, for overlaps.
+func (opts CreateFabricNetworkOpts) Validate(existing ...FabricNetwork) error {
+	if opts.Name == "" {
+		return errors.NewInvalidArgumentf(nil, nil, "network has no name")
+	}
+	subnet, err := validateSubnet("subnet", opts.Subnet, false, opts.ProvisionStartIp, opts.ProvisionEndIp, opts.Gateway)
+	if err != nil {
+		return err
+	}
+	subnets := []netip.Prefix{subnet}
+	if opts.Subnet6 != "" {
+		subnet6, err := validateSubnet("subnet6", opts.Subnet6, true, opts.ProvisionStartIp6, opts.ProvisionEndIp6, opts.Gateway6)
+		if err != nil {
+			return err
+		}
+		subnets = append(subnets, subnet6)
+	} else if opts.ProvisionStartIp6 != "" || opts.ProvisionEndIp6 != "" || opts.Gateway6 != "" {
+		return errors.NewInvalidArgumentf(nil, nil, "IPv6 addresses are given without subnet6")
+	}
+
+	for _, resolver := range opts.Resolvers {
+		if _, err := netip.ParseAddr(resolver); err != nil {
+			return errors.NewInvalidArgumentf(err, nil, "resolver %q is not an IP address", resolver)
+		}
+	}
+	for destination, gateway := range opts.Routes {
+		if _, err := netip.ParsePrefix(destination); err != nil {
+			if _, err := netip.ParseAddr(destination); err != nil {
+				return errors.NewInvalidArgumentf(err, nil, "route destination %q is neither a subnet nor an IP address", destination)
+			}
+		}
+		if _, err := netip.ParseAddr(gateway); err != nil {
+			return errors.NewInvalidArgumentf(err, nil, "route gateway %q is not an IP address", gateway)
+		}
+	}
+
+	for _, network := range existing {
+		for _, s := range []string{network.Subnet, network.Subnet6} {
+			other, err := netip.ParsePrefix(s)
+			if err != nil {
+				continue
+			}
+			for _, subnet := range subnets {
+				if other.Overlaps(subnet) {
+					return errors.NewInvalidArgumentf(nil, nil, "subnet %s overlaps subnet %s of network %s", subnet, other, network.Name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateSubnet parses an IPv4 or, if ipv6 is set, an IPv6 subnet and checks
+// that its provision range and gateway, those given, are within it
+func validateSubnet(field, s string, ipv6 bool, start, end, gateway string) (netip.Prefix, error) {
+	subnet, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, errors.NewInvalidArgumentf(err, nil, "%s %q is not in CIDR notation", field, s)
+	}
+	if subnet.Addr().Is6() != ipv6 {
+		family := "IPv4"
+		if ipv6 {
+			family = "IPv6"
+		}
+		return netip.Prefix{}, errors.NewInvalidArgumentf(nil, nil, "%s %s is not %s", field, subnet, family)
+	}
+	if subnet != subnet.Masked() {
+		return netip.Prefix{}, errors.NewInvalidArgumentf(nil, nil, "%s %s does not start at %s", field, subnet, subnet.Masked())
+	}
+
+	var first, last netip.Addr
+	for _, a := range []struct {
+		addr *netip.Addr
+		name string
+		s    string
+	}{{&first, "provision start IP", start}, {&last, "provision end IP", end}, {nil, "gateway", gateway}} {
+		if a.s == "" {
+			continue
+		}
+		addr, err := netip.ParseAddr(a.s)
+		if err != nil || !subnet.Contains(addr) {
+			return netip.Prefix{}, errors.NewInvalidArgumentf(err, nil, "%s %s is not in %s %s", a.name, a.s, field, subnet)
+		}
+		if a.addr != nil {
+			*a.addr = addr
+		}
+	}
+	if first.IsValid() && last.IsValid() && first.Compare(last) > 0 {
+		return netip.Prefix{}, errors.NewInvalidArgumentf(nil, nil, "provision range %s-%s is reversed", first, last)
+	}
+	return subnet, nil
+}
+
+// WithFabric returns a client whose fabric VLAN and fabric network methods
+// reach the fabric with the given name. Other methods are not affected.
+func (c *Client) WithFabric(name string) *Client {
+	out := *c
+	out.fabric = name
+	return &out
+}
+
+// Fabric returns the name of the fabric the client reaches
+func (c *Client) Fabric() string {
+	if c.fabric == "" {
+		return DefaultFabric
+	}
+	return c.fabric
+}
+
+// fabricURL returns the URL of the VLANs of the fabric of the client, joined
+// with the given parts
+func (c *Client) fabricURL(parts ...string) string {
+	return makeURL(append([]string{apiFabrics, c.Fabric(), apiFabricVLANs}, parts...)...)
 }
 
 // ListFabricVLANs lists VLANs
@@ -48,7 +231,7 @@ func (c *Client) ListFabricVLANs() ([]FabricVLAN, error) {
 	var resp []FabricVLAN
 	req := request{
 		method: client.GET,
-		url:    apiFabricVLANs,
+		url:    c.fabricURL(),
 		resp:   &resp,
 	}
 	if _, err := c.sendRequest(req); err != nil {
@@ -63,7 +246,7 @@ func (c *Client) GetFabricVLAN(vlanID int16) (*FabricVLAN, error) {
 	var resp FabricVLAN
 	req := request{
 		method: client.GET,
-		url:    makeURL(apiFabricVLANs, strconv.Itoa(int(vlanID))),
+		url:    c.fabricURL(strconv.Itoa(int(vlanID))),
 		resp:   &resp,
 	}
 	if _, err := c.sendRequest(req); err != nil {
@@ -78,7 +261,7 @@ func (c *Client) CreateFabricVLAN(vlan FabricVLAN) (*FabricVLAN, error) {
 	var resp FabricVLAN
 	req := request{
 		method:         client.POST,
-		url:            apiFabricVLANs,
+		url:            c.fabricURL(),
 		reqValue:       vlan,
 		resp:           &resp,
 		expectedStatus: http.StatusCreated,
@@ -95,7 +278,7 @@ func (c *Client) UpdateFabricVLAN(vlan FabricVLAN) (*FabricVLAN, error) {
 	var resp FabricVLAN
 	req := request{
 		method:         client.PUT,
-		url:            makeURL(apiFabricVLANs, strconv.Itoa(int(vlan.Id))),
+		url:            c.fabricURL(strconv.Itoa(int(vlan.Id))),
 		reqValue:       vlan,
 		resp:           &resp,
 		expectedStatus: http.StatusAccepted,
@@ -111,7 +294,7 @@ func (c *Client) UpdateFabricVLAN(vlan FabricVLAN) (*FabricVLAN, error) {
 func (c *Client) DeleteFabricVLAN(vlanID int16) error {
 	req := request{
 		method:         client.DELETE,
-		url:            makeURL(apiFabricVLANs, strconv.Itoa(int(vlanID))),
+		url:            c.fabricURL(strconv.Itoa(int(vlanID))),
 		expectedStatus: http.StatusNoContent,
 	}
 	if _, err := c.sendRequest(req); err != nil {
@@ -126,7 +309,7 @@ func (c *Client) ListFabricNetworks(vlanID int16) ([]FabricNetwork, error) {
 	var resp []FabricNetwork
 	req := request{
 		method: client.GET,
-		url:    makeURL(apiFabricVLANs, strconv.Itoa(int(vlanID)), apiFabricNetworks),
+		url:    c.fabricURL(strconv.Itoa(int(vlanID)), apiFabricNetworks),
 		resp:   &resp,
 	}
 	if _, err := c.sendRequest(req); err != nil {
@@ -141,7 +324,7 @@ func (c *Client) GetFabricNetwork(vlanID int16, networkID string) (*FabricNetwor
 	var resp FabricNetwork
 	req := request{
 		method: client.GET,
-		url:    makeURL(apiFabricVLANs, strconv.Itoa(int(vlanID)), apiFabricNetworks, networkID),
+		url:    c.fabricURL(strconv.Itoa(int(vlanID)), apiFabricNetworks, networkID),
 		resp:   &resp,
 	}
 	if _, err := c.sendRequest(req); err != nil {
@@ -156,7 +339,7 @@ func (c *Client) CreateFabricNetwork(vlanID int16, opts CreateFabricNetworkOpts)
 	var resp FabricNetwork
 	req := request{
 		method:         client.POST,
-		url:            makeURL(apiFabricVLANs, strconv.Itoa(int(vlanID)), apiFabricNetworks),
+		url:            c.fabricURL(strconv.Itoa(int(vlanID)), apiFabricNetworks),
 		reqValue:       opts,
 		resp:           &resp,
 		expectedStatus: http.StatusCreated,
@@ -167,12 +350,29 @@ func (c *Client) CreateFabricNetwork(vlanID int16, opts CreateFabricNetworkOpts)
 	return &resp, nil
 }
 
+// UpdateFabricNetwork updates the given fields of a fabric network
+// See API docs: https://apidocs.joyent.com/cloudapi/#UpdateFabricNetwork
+func (c *Client) UpdateFabricNetwork(vlanID int16, networkID string, opts UpdateFabricNetworkOpts) (*FabricNetwork, error) {
+	var resp FabricNetwork
+	req := request{
+		method:         client.PUT,
+		url:            c.fabricURL(strconv.Itoa(int(vlanID)), apiFabricNetworks, networkID),
+		reqValue:       opts,
+		resp:           &resp,
+		expectedStatus: http.StatusAccepted,
+	}
+	if _, err := c.sendRequest(req); err != nil {
+		return nil, errors.Newf(err, "failed to update fabric network %s on vlan %d", networkID, vlanID)
+	}
+	return &resp, nil
+}
+
 // DeleteFabricNetwork deletes an existing fabric network
 // See API docs: https://apidocs.joyent.com/cloudapi/#DeleteFabricNetwork
 func (c *Client) DeleteFabricNetwork(vlanID int16, networkID string) error {
 	req := request{
 		method:         client.DELETE,
-		url:            makeURL(apiFabricVLANs, strconv.Itoa(int(vlanID)), apiFabricNetworks, networkID),
+		url:            c.fabricURL(strconv.Itoa(int(vlanID)), apiFabricNetworks, networkID),
 		expectedStatus: http.StatusNoContent,
 	}
 	if _, err := c.sendRequest(req); err != nil {
@@ -1,6 +1,7 @@
 package cloudapi_test
 
 import (
+	"github.com/joyent/gocommon/errors"
 	"github.com/joyent/gosdc/cloudapi"
 	gc "launchpad.net/gocheck"
 )
@@ -113,6 +114,116 @@ func (s *LocalTests) TestGetFabricNetwork(c *gc.C) {
 	c.Assert(network2.Id, gc.Equals, network.Id)
 }
 
+func (s *LocalTests) TestUpdateFabricNetwork(c *gc.C) {
+	vlan, network, cleanup := s.createFabricNetwork(c)
+	defer cleanup()
+
+	description := "test change"
+	updated, err := s.testClient.UpdateFabricNetwork(vlan.Id, network.Id, cloudapi.UpdateFabricNetworkOpts{
+		Description: &description,
+		Resolvers:   []string{"8.8.8.8"},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(updated.Description, gc.Equals, "test change")
+	c.Assert(updated.Resolvers, gc.DeepEquals, []string{"8.8.8.8"})
+	c.Assert(updated.Name, gc.Equals, network.Name)
+
+	// nil fields are left alone, empty ones are cleared
+	updated, err = s.testClient.UpdateFabricNetwork(vlan.Id, network.Id, cloudapi.UpdateFabricNetworkOpts{Resolvers: []string{}})
+	c.Assert(err, gc.IsNil)
+	c.Assert(updated.Description, gc.Equals, "test change")
+	c.Assert(updated.Resolvers, gc.HasLen, 0)
+	description = ""
+	updated, err = s.testClient.UpdateFabricNetwork(vlan.Id, network.Id, cloudapi.UpdateFabricNetworkOpts{Description: &description})
+	c.Assert(err, gc.IsNil)
+	c.Assert(updated.Description, gc.Equals, "")
+}
+
+func (s *LocalTests) TestWithFabric(c *gc.C) {
+	c.Assert(s.testClient.Fabric(), gc.Equals, cloudapi.DefaultFabric)
+
+	other := s.testClient.WithFabric("other")
+	c.Assert(other.Fabric(), gc.Equals, "other")
+	c.Assert(s.testClient.Fabric(), gc.Equals, cloudapi.DefaultFabric)
+
+	// the local double only has the default fabric
+	_, err := other.ListFabricVLANs()
+	c.Assert(errors.IsResourceNotFound(err), gc.Equals, true)
+	_, err = s.testClient.WithFabric(cloudapi.DefaultFabric).ListFabricVLANs()
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *LocalTests) TestValidateFabricVLAN(c *gc.C) {
+	c.Assert(cloudapi.FabricVLAN{Id: cloudapi.MaxVLANID, Name: "last"}.Validate(), gc.IsNil)
+	for _, vlan := range []cloudapi.FabricVLAN{
+		{Id: cloudapi.MaxVLANID + 1, Name: "too high"},
+		{Id: -1, Name: "negative"},
+		{Id: 2},
+	} {
+		err := vlan.Validate()
+		c.Check(errors.IsInvalidArgument(err), gc.Equals, true, gc.Commentf("%+v: %v", vlan, err))
+	}
+}
+
+func (s *LocalTests) TestValidateFabricNetworkOpts(c *gc.C) {
+	valid := cloudapi.CreateFabricNetworkOpts{
+		Name:             "valid",
+		Subnet:           "10.1.0.0/24",
+		ProvisionStartIp: "10.1.0.10",
+		ProvisionEndIp:   "10.1.0.250",
+		Gateway:          "10.1.0.1",
+		Resolvers:        []string{"8.8.8.8"},
+		Routes:           map[string]string{"10.2.0.0/16": "10.1.0.1", "10.3.0.1": "10.1.0.1"},
+	}
+	c.Assert(valid.Validate(), gc.IsNil)
+
+	for _, change := range []func(*cloudapi.CreateFabricNetworkOpts){
+		func(o *cloudapi.CreateFabricNetworkOpts) { o.Name = "" },
+		func(o *cloudapi.CreateFabricNetworkOpts) { o.Subnet = "10.1.0.0" },
+		func(o *cloudapi.CreateFabricNetworkOpts) { o.Subnet = "10.1.0.5/24" },
+		func(o *cloudapi.CreateFabricNetworkOpts) { o.Gateway = "10.9.0.1" },
+		func(o *cloudapi.CreateFabricNetworkOpts) { o.ProvisionStartIp = "10.0.255.10" },
+		func(o *cloudapi.CreateFabricNetworkOpts) { o.ProvisionEndIp = "10.1.1.250" },
+		func(o *cloudapi.CreateFabricNetworkOpts) {
+			o.ProvisionStartIp, o.ProvisionEndIp = "10.1.0.250", "10.1.0.10"
+		},
+		func(o *cloudapi.CreateFabricNetworkOpts) { o.Resolvers = []string{"dns.example.com"} },
+		func(o *cloudapi.CreateFabricNetworkOpts) { o.Routes = map[string]string{"10.2.0.0/16": "gateway"} },
+		func(o *cloudapi.CreateFabricNetworkOpts) { o.Subnet = "fd00:1::/64" },
+		func(o *cloudapi.CreateFabricNetworkOpts) { o.Subnet6 = "10.4.0.0/24" },
+		func(o *cloudapi.CreateFabricNetworkOpts) { o.Gateway6 = "fd00:1::1" },
+		func(o *cloudapi.CreateFabricNetworkOpts) { o.Subnet6, o.Gateway6 = "fd00:1::/64", "fd00:2::1" },
+	} {
+		opts := valid
+		change(&opts)
+		err := opts.Validate()
+		c.Check(errors.IsInvalidArgument(err), gc.Equals, true, gc.Commentf("%+v: %v", opts, err))
+	}
+
+	existing := []cloudapi.FabricNetwork{{Name: "other", Subnet: "10.1.0.128/25"}}
+	c.Assert(errors.IsInvalidArgument(valid.Validate(existing...)), gc.Equals, true)
+	existing[0].Subnet = "10.1.1.0/24"
+	c.Assert(valid.Validate(existing...), gc.IsNil)
+
+	dualStack := valid
+	dualStack.Subnet6, dualStack.ProvisionStartIp6, dualStack.Gateway6 = "fd00:1::/64", "fd00:1::10", "fd00:1::1"
+	c.Assert(dualStack.Validate(existing...), gc.IsNil)
+	existing[0].Subnet6 = "fd00:1::/48"
+	c.Assert(errors.IsInvalidArgument(dualStack.Validate(existing...)), gc.Equals, true)
+}
+
+func (s *LocalTests) TestCreateFabricNetworkInvalid(c *gc.C) {
+	vlan, cleanup := s.createFabricVLAN(c)
+	defer cleanup()
+
+	_, err := s.testClient.CreateFabricNetwork(vlan.Id, cloudapi.CreateFabricNetworkOpts{
+		Name:    "invalid network",
+		Subnet:  "10.0.0.0/16",
+		Gateway: "192.168.0.1",
+	})
+	c.Assert(err, gc.NotNil)
+}
+
 func (s *LocalTests) TestDeleteFabricNetwork(c *gc.C) {
 	vlan, cleanup := s.createFabricVLAN(c)
 	defer cleanup()
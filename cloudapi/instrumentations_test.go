@@ -0,0 +1,77 @@
+package cloudapi_test
+
+import (
+	gc "launchpad.net/gocheck"
+
+	"github.com/joyent/gosdc/cloudapi"
+)
+
+func (s *LocalTests) createInstrumentation(c *gc.C, decomposition string) *cloudapi.Instrumentation {
+	inst, err := s.testClient.CreateInstrumentation(cloudapi.CreateInstrumentationOpts{
+		Module:        "syscall",
+		Stat:          "syscalls",
+		Decomposition: decomposition,
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(inst, gc.NotNil)
+
+	return inst
+}
+
+func (s *LocalTests) deleteInstrumentation(c *gc.C, instrumentationID string) {
+	err := s.testClient.DeleteInstrumentation(instrumentationID)
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *LocalTests) TestDescribeAnalytics(c *gc.C) {
+	analytics, err := s.testClient.DescribeAnalytics()
+	c.Assert(err, gc.IsNil)
+	c.Assert(analytics.Modules, gc.Not(gc.HasLen), 0)
+	c.Assert(analytics.Metrics, gc.Not(gc.HasLen), 0)
+}
+
+func (s *LocalTests) TestCreateInstrumentation(c *gc.C) {
+	inst := s.createInstrumentation(c, "")
+	s.deleteInstrumentation(c, inst.Id)
+}
+
+func (s *LocalTests) TestListInstrumentations(c *gc.C) {
+	inst := s.createInstrumentation(c, "")
+	defer s.deleteInstrumentation(c, inst.Id)
+
+	insts, err := s.testClient.ListInstrumentations()
+	c.Assert(err, gc.IsNil)
+	c.Assert(insts, gc.DeepEquals, []cloudapi.Instrumentation{*inst})
+}
+
+func (s *LocalTests) TestGetInstrumentation(c *gc.C) {
+	inst := s.createInstrumentation(c, "execname")
+	defer s.deleteInstrumentation(c, inst.Id)
+
+	got, err := s.testClient.GetInstrumentation(inst.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(got, gc.DeepEquals, inst)
+}
+
+func (s *LocalTests) TestGetInstrumentationValue(c *gc.C) {
+	inst := s.createInstrumentation(c, "execname")
+	defer s.deleteInstrumentation(c, inst.Id)
+
+	value, err := s.testClient.GetInstrumentationValue(inst.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(value.Duration, gc.Equals, 1)
+	c.Assert(value.Value, gc.HasLen, 3)
+}
+
+func (s *LocalTests) TestGetInstrumentationHeatmap(c *gc.C) {
+	inst := s.createInstrumentation(c, "latency")
+	defer s.deleteInstrumentation(c, inst.Id)
+
+	heatmap, err := s.testClient.GetInstrumentationHeatmap(inst.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(heatmap.BucketYmax > heatmap.BucketYmin, gc.Equals, true)
+
+	details, err := s.testClient.GetInstrumentationHeatmapDetails(inst.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(details.Total <= heatmap.Total, gc.Equals, true)
+}
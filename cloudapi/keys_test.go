@@ -3,6 +3,7 @@ package cloudapi_test
 import (
 	gc "launchpad.net/gocheck"
 
+	"github.com/joyent/gocommon/errors"
 	"github.com/joyent/gosdc/cloudapi"
 )
 
@@ -42,3 +43,17 @@ func (s *LocalTests) TestDeleteKey(c *gc.C) {
 
 	s.deleteKey(c)
 }
+
+func (s *LocalTests) TestGetKeyNotFound(c *gc.C) {
+	_, err := s.testClient.GetKey("missing-key")
+	c.Assert(err, gc.NotNil)
+	c.Assert(errors.IsResourceNotFound(err), gc.Equals, true)
+}
+
+func (s *LocalTests) TestCreateKeyConflict(c *gc.C) {
+	s.createKey(c)
+	defer s.deleteKey(c)
+
+	_, err := s.testClient.CreateKey(cloudapi.CreateKeyOpts{Name: "fake-key", Key: testKey})
+	c.Assert(err, gc.ErrorMatches, "(?s).*Key name fake-key already in use.*")
+}
@@ -46,6 +46,7 @@ type LocalTests struct {
 	Mux        *httprouter.Router
 	oldHandler http.Handler
 	cloudapi   *lc.CloudAPI
+	checkpoint string
 }
 
 func (s *LocalTests) SetUpSuite(c *gc.C) {
@@ -66,6 +67,7 @@ func (s *LocalTests) SetUpSuite(c *gc.C) {
 	}
 	s.cloudapi = lc.New(s.creds.SdcEndpoint.URL, s.creds.UserAuthentication.User)
 	s.cloudapi.SetupHTTP(s.Mux)
+	s.checkpoint = s.cloudapi.Checkpoint()
 }
 
 func (s *LocalTests) TearDownSuite(c *gc.C) {
@@ -81,6 +83,12 @@ func (s *LocalTests) SetUpTest(c *gc.C) {
 	c.Assert(s.testClient, gc.NotNil)
 }
 
+// TearDownTest puts the double back in the state it had before the test, so
+// that tests do not see each other's resources.
+func (s *LocalTests) TearDownTest(c *gc.C) {
+	c.Assert(s.cloudapi.Restore(s.checkpoint), gc.IsNil)
+}
+
 // Helper method to create a test key in the user account
 func (s *LocalTests) createKey(c *gc.C) {
 	key, err := s.testClient.CreateKey(cloudapi.CreateKeyOpts{Name: "fake-key", Key: testKey})
@@ -94,8 +102,10 @@ func (s *LocalTests) deleteKey(c *gc.C) {
 }
 
 // Helper method to create a test virtual machine in the user account
-func (s *LocalTests) createMachine(c *gc.C) *cloudapi.Machine {
-	machine, err := s.testClient.CreateMachine(cloudapi.CreateMachineOpts{Package: localPackageName, Image: localImageID})
+// createMachine creates a machine on the given networks, or on the default
+// ones if none is given, and waits for it to run
+func (s *LocalTests) createMachine(c *gc.C, networks ...string) *cloudapi.Machine {
+	machine, err := s.testClient.CreateMachine(cloudapi.CreateMachineOpts{Package: localPackageName, Image: localImageID, Networks: networks})
 	c.Assert(err, gc.IsNil)
 	c.Assert(machine, gc.NotNil)
 
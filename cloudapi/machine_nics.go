@@ -18,13 +18,15 @@ var (
 
 // NIC represents a NIC on a machine
 type NIC struct {
-	IP      string   `json:"ip"`      // NIC's IPv4 Address
-	MAC     string   `json:"mac"`     // NIC's MAC address
-	Primary bool     `json:"primary"` // Whether this is the machine's primary NIC
-	Netmask string   `json:"netmask"` // IPv4 netmask
-	Gateway string   `json:"gateway"` // IPv4 gateway
-	State   NICState `json:"state"`   // Describes the state of the NIC (e.g. provisioning, running, or stopped)
-	Network string   `json:"network"` // Network ID this NIC is attached to
+	IP       string   `json:"ip"`                 // NIC's IPv4 Address
+	MAC      string   `json:"mac"`                // NIC's MAC address
+	Primary  bool     `json:"primary"`            // Whether this is the machine's primary NIC
+	Netmask  string   `json:"netmask"`            // IPv4 netmask
+	Gateway  string   `json:"gateway"`            // IPv4 gateway
+	State    NICState `json:"state"`              // Describes the state of the NIC (e.g. provisioning, running, or stopped)
+	Network  string   `json:"network"`            // Network ID this NIC is attached to
+	IPs      []string `json:"ips,omitempty"`      // IPv4 and IPv6 addresses of the NIC in CIDR notation, IPv4 first
+	Gateways []string `json:"gateways,omitempty"` // IPv4 and IPv6 gateways of the NIC, IPv4 first
 }
 
 type addNICOptions struct {
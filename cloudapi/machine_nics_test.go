@@ -6,11 +6,11 @@ import (
 )
 
 func (s *LocalTests) addNIC(c *gc.C) (machine *cloudapi.Machine, nic *cloudapi.NIC, cleanup func()) {
-	machine = s.createMachine(c)
-
 	networks, err := s.testClient.ListNetworks()
 	c.Assert(err, gc.IsNil)
 
+	// off the first network, which the machine would be on by default
+	machine = s.createMachine(c, networks[1].Id)
 	nic, err = s.testClient.AddNIC(machine.Id, networks[0].Id)
 	c.Assert(err, gc.IsNil)
 
@@ -33,8 +33,13 @@ func (s *LocalTests) TestListNICs(c *gc.C) {
 
 	nics, err := s.testClient.ListNICs(machine.Id)
 	c.Assert(err, gc.IsNil)
-	c.Assert(nics, gc.HasLen, 1)
-	c.Assert(nics[0].MAC, gc.Equals, nic.MAC)
+	// the NIC of the network the machine was created on, and the added one
+	c.Assert(nics, gc.HasLen, 2)
+	networks := map[string]string{}
+	for _, n := range nics {
+		networks[n.MAC] = n.Network
+	}
+	c.Assert(networks[nic.MAC], gc.Equals, nic.Network)
 }
 
 func (s *LocalTests) TestGetNIC(c *gc.C) {
@@ -56,3 +61,33 @@ func (s *LocalTests) TestRemoveNIC(c *gc.C) {
 	_, err = s.testClient.GetNIC(machine.Id, nic.MAC)
 	c.Assert(err, gc.Not(gc.IsNil))
 }
+
+func (s *LocalTests) TestAddDualStackNIC(c *gc.C) {
+	vlan, cleanup := s.createFabricVLAN(c)
+	defer cleanup()
+	network, err := s.testClient.CreateFabricNetwork(vlan.Id, cloudapi.CreateFabricNetworkOpts{
+		Name:     "dual-stack network",
+		Subnet:   "10.60.0.0/24",
+		Gateway:  "10.60.0.1",
+		Subnet6:  "fd00:60::/64",
+		Gateway6: "fd00:60::1",
+	})
+	c.Assert(err, gc.IsNil)
+	defer func() {
+		c.Assert(s.testClient.DeleteFabricNetwork(vlan.Id, network.Id), gc.IsNil)
+	}()
+	c.Assert(network.Subnet6, gc.Equals, "fd00:60::/64")
+
+	machine := s.createMachine(c)
+	defer s.deleteMachine(c, machine.Id)
+	nic, err := s.testClient.AddNIC(machine.Id, network.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(nic.IP, gc.Equals, "10.60.0.2")
+	c.Assert(nic.IPs, gc.DeepEquals, []string{"10.60.0.2/24", "fd00:60::2/64"})
+	c.Assert(nic.Gateways, gc.DeepEquals, []string{"10.60.0.1", "fd00:60::1"})
+
+	m, err := s.testClient.GetMachine(machine.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(m.IPs[len(m.IPs)-2:], gc.DeepEquals, []string{"10.60.0.2", "fd00:60::2"})
+	c.Assert(s.testClient.RemoveNIC(machine.Id, nic.MAC), gc.IsNil)
+}
@@ -0,0 +1,73 @@
+package cloudapi_test
+
+import (
+	gc "launchpad.net/gocheck"
+
+	"github.com/joyent/gosdc/cloudapi"
+)
+
+func (s *LocalTests) createMachineSnapshot(c *gc.C, machineID string) {
+	snapshot, err := s.testClient.CreateMachineSnapshot(machineID, cloudapi.SnapshotOpts{Name: "test-snapshot"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(snapshot, gc.DeepEquals, &cloudapi.Snapshot{Name: "test-snapshot", State: "queued"})
+}
+
+func (s *LocalTests) TestCreateMachineSnapshot(c *gc.C) {
+	testMachine := s.createMachine(c)
+	defer s.deleteMachine(c, testMachine.Id)
+
+	s.createMachineSnapshot(c, testMachine.Id)
+}
+
+func (s *LocalTests) TestListMachineSnapshots(c *gc.C) {
+	testMachine := s.createMachine(c)
+	defer s.deleteMachine(c, testMachine.Id)
+
+	s.createMachineSnapshot(c, testMachine.Id)
+
+	snapshots, err := s.testClient.ListMachineSnapshots(testMachine.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(snapshots, gc.DeepEquals, []cloudapi.Snapshot{{Name: "test-snapshot", State: "created"}})
+}
+
+func (s *LocalTests) TestGetMachineSnapshot(c *gc.C) {
+	testMachine := s.createMachine(c)
+	defer s.deleteMachine(c, testMachine.Id)
+
+	s.createMachineSnapshot(c, testMachine.Id)
+
+	snapshot, err := s.testClient.GetMachineSnapshot(testMachine.Id, "test-snapshot")
+	c.Assert(err, gc.IsNil)
+	c.Assert(snapshot, gc.DeepEquals, &cloudapi.Snapshot{Name: "test-snapshot", State: "created"})
+}
+
+func (s *LocalTests) TestStartMachineFromSnapshot(c *gc.C) {
+	testMachine := s.createMachine(c)
+	defer s.deleteMachine(c, testMachine.Id)
+
+	_, err := s.testClient.AddMachineTags(testMachine.Id, map[string]string{"test": "a"})
+	c.Assert(err, gc.IsNil)
+	s.createMachineSnapshot(c, testMachine.Id)
+
+	_, err = s.testClient.ReplaceMachineTags(testMachine.Id, map[string]string{"test": "b"})
+	c.Assert(err, gc.IsNil)
+
+	err = s.testClient.StopMachine(testMachine.Id)
+	c.Assert(err, gc.IsNil)
+	err = s.testClient.StartMachineFromSnapshot(testMachine.Id, "test-snapshot")
+	c.Assert(err, gc.IsNil)
+
+	tag, err := s.testClient.GetMachineTag(testMachine.Id, "test")
+	c.Assert(err, gc.IsNil)
+	c.Assert(tag, gc.Equals, "a")
+}
+
+func (s *LocalTests) TestDeleteMachineSnapshot(c *gc.C) {
+	testMachine := s.createMachine(c)
+	defer s.deleteMachine(c, testMachine.Id)
+
+	s.createMachineSnapshot(c, testMachine.Id)
+
+	err := s.testClient.DeleteMachineSnapshot(testMachine.Id, "test-snapshot")
+	c.Assert(err, gc.IsNil)
+}
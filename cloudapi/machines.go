@@ -29,8 +29,9 @@ type Machine struct {
 	Image           string            // The image id the machine was provisioned with
 	PrimaryIP       string            // The primary (public) IP address for the machine
 	Networks        []string          // The network IDs for the machine
-	FirewallEnabled bool              `json:"firewall_enabled"` // whether or not the firewall is enabled
-	DomainNames     []string          `json:"dns_names"` // The domain names of this machine
+	FirewallEnabled bool              `json:"firewall_enabled"`       // whether or not the firewall is enabled
+	DomainNames     []string          `json:"dns_names"`              // The domain names of this machine
+	ComputeNode     string            `json:"compute_node,omitempty"` // The compute node the machine runs on
 }
 
 // Equals compares two machines. Ignores state and timestamps.
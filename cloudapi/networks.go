@@ -5,12 +5,37 @@ import (
 	"github.com/joyent/gocommon/errors"
 )
 
-// Network represents a network available to a given account
+// Network represents a network available to a given account, fabric
+// networks of the account included
 type Network struct {
-	Id          string // Unique identifier for the network
-	Name        string // Network name
-	Public      bool   // Whether this a public or private (rfc1918) network
-	Description string // Optional description for this network, when name is not enough
+	Id               string            `json:"id"`                           // Unique identifier for the network
+	Name             string            `json:"name"`                         // Network name
+	Public           bool              `json:"public"`                       // Whether this a public or private (rfc1918) network
+	Fabric           bool              `json:"fabric,omitempty"`             // Whether this network is on a fabric
+	Description      string            `json:"description,omitempty"`        // Optional description for this network, when name is not enough
+	Subnet           string            `json:"subnet,omitempty"`             // CIDR formatted string describing the network
+	ProvisionStartIp string            `json:"provision_start_ip,omitempty"` // First IP on the network that can be assigned
+	ProvisionEndIp   string            `json:"provision_end_ip,omitempty"`   // Last assignable IP on the network
+	Gateway          string            `json:"gateway,omitempty"`            // Optional Gateway IP
+	Resolvers        []string          `json:"resolvers,omitempty"`          // Array of IP addresses for resolvers
+	Routes           map[string]string `json:"routes,omitempty"`             // Map of CIDR block to Gateway IP Address
+	InternetNAT      bool              `json:"internet_nat,omitempty"`       // If a NAT zone is provisioned at Gateway IP Address
+	VLANId           int16             `json:"vlan_id,omitempty"`            // VLAN a fabric network is on
+
+	Subnet6           string `json:"subnet6,omitempty"`             // CIDR formatted string describing the IPv6 subnet of a dual-stack network
+	ProvisionStartIp6 string `json:"provision_start_ip6,omitempty"` // First IPv6 address on the network that can be assigned
+	ProvisionEndIp6   string `json:"provision_end_ip6,omitempty"`   // Last assignable IPv6 address on the network
+	Gateway6          string `json:"gateway6,omitempty"`            // Optional IPv6 gateway
+}
+
+// NetworkIP represents an IP address on a network along with what uses it
+type NetworkIP struct {
+	IP            string `json:"ip"`                        // IP address
+	Reserved      bool   `json:"reserved"`                  // Whether the IP is kept from being handed out to new NICs
+	Managed       bool   `json:"managed"`                   // Whether the IP is managed by the datacenter, such as a gateway
+	OwnerUUID     string `json:"owner_uuid,omitempty"`      // UUID of the account the IP belongs to, if any
+	BelongsToUUID string `json:"belongs_to_uuid,omitempty"` // UUID of the machine the IP is assigned to, if any
+	BelongsToType string `json:"belongs_to_type,omitempty"` // Type of what the IP is assigned to, such as zone
 }
 
 // ListNetworks lists all the networks which can be used by the given account.
@@ -42,3 +67,51 @@ func (c *Client) GetNetwork(networkID string) (*Network, error) {
 	}
 	return &resp, nil
 }
+
+// ListNetworkIPs lists the IPs of a network that are in use, reserved or
+// managed.
+// See API docs: https://apidocs.joyent.com/cloudapi/#ListNetworkIPs
+func (c *Client) ListNetworkIPs(networkID string) ([]NetworkIP, error) {
+	var resp []NetworkIP
+	req := request{
+		method: client.GET,
+		url:    makeURL(apiNetworks, networkID, apiNetworkIPs),
+		resp:   &resp,
+	}
+	if _, err := c.sendRequest(req); err != nil {
+		return nil, errors.Newf(err, "failed to get list of IPs of network with id %s", networkID)
+	}
+	return resp, nil
+}
+
+// GetNetworkIP retrieves an IP of a network, whether or not it is used.
+// See API docs: https://apidocs.joyent.com/cloudapi/#GetNetworkIP
+func (c *Client) GetNetworkIP(networkID, ipAddress string) (*NetworkIP, error) {
+	var resp NetworkIP
+	req := request{
+		method: client.GET,
+		url:    makeURL(apiNetworks, networkID, apiNetworkIPs, ipAddress),
+		resp:   &resp,
+	}
+	if _, err := c.sendRequest(req); err != nil {
+		return nil, errors.Newf(err, "failed to get IP %s of network with id %s", ipAddress, networkID)
+	}
+	return &resp, nil
+}
+
+// UpdateNetworkIP reserves an IP of a network so it is not handed out to new
+// NICs, or releases it.
+// See API docs: https://apidocs.joyent.com/cloudapi/#UpdateNetworkIP
+func (c *Client) UpdateNetworkIP(networkID, ipAddress string, reserved bool) (*NetworkIP, error) {
+	var resp NetworkIP
+	req := request{
+		method:   client.PUT,
+		url:      makeURL(apiNetworks, networkID, apiNetworkIPs, ipAddress),
+		reqValue: map[string]bool{"reserved": reserved},
+		resp:     &resp,
+	}
+	if _, err := c.sendRequest(req); err != nil {
+		return nil, errors.Newf(err, "failed to update IP %s of network with id %s", ipAddress, networkID)
+	}
+	return &resp, nil
+}
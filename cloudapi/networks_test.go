@@ -17,9 +17,62 @@ func (s *LocalTests) TestGetNetwork(c *gc.C) {
 	c.Assert(err, gc.IsNil)
 	c.Assert(net, gc.NotNil)
 	c.Assert(net, gc.DeepEquals, &cloudapi.Network{
-		Id:          localNetworkID,
-		Name:        "Test-Joyent-Public",
-		Public:      true,
-		Description: "",
+		Id:               localNetworkID,
+		Name:             "Test-Joyent-Public",
+		Public:           true,
+		Description:      "",
+		Subnet:           "32.151.0.0/16",
+		ProvisionStartIp: "32.151.0.10",
+		ProvisionEndIp:   "32.151.255.250",
+		Gateway:          "32.151.0.1",
 	})
 }
+
+func (s *LocalTests) TestFabricNetworkInNetworks(c *gc.C) {
+	vlan, fabricNetwork, cleanup := s.createFabricNetwork(c)
+	defer cleanup()
+
+	nets, err := s.testClient.ListNetworks()
+	c.Assert(err, gc.IsNil)
+	found := false
+	for _, net := range nets {
+		if net.Id == fabricNetwork.Id {
+			found = true
+		}
+	}
+	c.Assert(found, gc.Equals, true)
+
+	net, err := s.testClient.GetNetwork(fabricNetwork.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(net.Fabric, gc.Equals, true)
+	c.Assert(net.VLANId, gc.Equals, vlan.Id)
+	c.Assert(net.Subnet, gc.Equals, fabricNetwork.Subnet)
+	c.Assert(net.InternetNAT, gc.Equals, true)
+}
+
+func (s *LocalTests) TestNetworkIPs(c *gc.C) {
+	ip, err := s.testClient.UpdateNetworkIP(localNetworkID, "32.151.250.2", true)
+	c.Assert(err, gc.IsNil)
+	c.Assert(ip.Reserved, gc.Equals, true)
+	defer s.testClient.UpdateNetworkIP(localNetworkID, "32.151.250.2", false)
+
+	ip, err = s.testClient.GetNetworkIP(localNetworkID, "32.151.250.2")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ip.IP, gc.Equals, "32.151.250.2")
+	c.Assert(ip.Reserved, gc.Equals, true)
+	c.Assert(ip.Managed, gc.Equals, false)
+
+	ips, err := s.testClient.ListNetworkIPs(localNetworkID)
+	c.Assert(err, gc.IsNil)
+	found := false
+	for _, listed := range ips {
+		if listed.IP == ip.IP {
+			found = true
+			c.Assert(listed.OwnerUUID, gc.Equals, ip.OwnerUUID)
+		}
+	}
+	c.Assert(found, gc.Equals, true)
+
+	_, err = s.testClient.UpdateNetworkIP(localNetworkID, "32.151.0.1", true)
+	c.Assert(err, gc.NotNil)
+}
@@ -0,0 +1,207 @@
+package cloudapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/joyent/gocommon/errors"
+)
+
+// TopologyKind is the kind of a node or an edge of a topology
+type TopologyKind string
+
+const (
+	TopologyMachine  TopologyKind = "machine"       // A machine of the account
+	TopologyNetwork  TopologyKind = "network"       // A network, fabric or not
+	TopologyVLAN     TopologyKind = "vlan"          // A fabric VLAN
+	TopologyRule     TopologyKind = "firewall_rule" // An enabled firewall rule
+	TopologyNIC      TopologyKind = "nic"           // Edge from a machine to the network of one of its NICs
+	TopologyOnVLAN   TopologyKind = "on_vlan"       // Edge from a fabric network to its VLAN
+	TopologyFirewall TopologyKind = "firewall"      // Edge from a firewall rule to a machine it applies to
+)
+
+// TopologyNode is a machine, network, VLAN or firewall rule of a topology.
+// IDs are prefixed with the kind of the node, as in "vlan:2", so that they
+// are unique across kinds.
+type TopologyNode struct {
+	Id    string       `json:"id"`    // Unique identifier of the node in the topology
+	Kind  TopologyKind `json:"kind"`  // What the node is
+	Label string       `json:"label"` // Name of what the node is, or its ID if it has none
+}
+
+// TopologyEdge links two nodes of a topology
+type TopologyEdge struct {
+	From  string       `json:"from"`            // ID of the machine, network or firewall rule node
+	To    string       `json:"to"`              // ID of the network, VLAN or machine node
+	Kind  TopologyKind `json:"kind"`            // What the edge is
+	Label string       `json:"label,omitempty"` // IPs of a NIC
+}
+
+// Topology is a graph of the machines of an account, the networks their
+// NICs are on and the VLANs of the fabric networks among those
+type Topology struct {
+	Nodes []TopologyNode `json:"nodes"`
+	Edges []TopologyEdge `json:"edges"`
+
+	index map[string]bool
+}
+
+// TopologyOpts are the options of Topology
+type TopologyOpts struct {
+	FirewallRules bool // Whether to add enabled firewall rules, with edges to the machines they apply to
+}
+
+// Topology builds the topology of the account from its machines, their
+// NICs, the networks and the fabric VLANs and networks of the fabric of the
+// client. Every network and VLAN is a node, whether a machine is on it or
+// not. Firewall rules, if asked for, are those listed for each machine.
+func (c *Client) Topology(opts TopologyOpts) (*Topology, error) {
+	t := &Topology{Nodes: []TopologyNode{}, Edges: []TopologyEdge{}, index: map[string]bool{}}
+
+	networks, err := c.ListNetworks()
+	if err != nil {
+		return nil, err
+	}
+	for _, network := range networks {
+		t.addNode(topologyID(TopologyNetwork, network.Id), TopologyNetwork, network.Name)
+	}
+
+	vlans, err := c.ListFabricVLANs()
+	if err != nil {
+		return nil, err
+	}
+	for _, vlan := range vlans {
+		vlanID := topologyID(TopologyVLAN, strconv.Itoa(int(vlan.Id)))
+		t.addNode(vlanID, TopologyVLAN, vlan.Name)
+		fabricNetworks, err := c.ListFabricNetworks(vlan.Id)
+		if err != nil {
+			return nil, err
+		}
+		for _, network := range fabricNetworks {
+			networkID := topologyID(TopologyNetwork, network.Id)
+			t.addNode(networkID, TopologyNetwork, network.Name)
+			t.addEdge(networkID, vlanID, TopologyOnVLAN, "")
+		}
+	}
+
+	machines, err := c.ListMachines(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, machine := range machines {
+		machineID := topologyID(TopologyMachine, machine.Id)
+		t.addNode(machineID, TopologyMachine, machine.Name)
+		nics, err := c.ListNICs(machine.Id)
+		if err != nil {
+			return nil, err
+		}
+		for _, nic := range nics {
+			networkID := topologyID(TopologyNetwork, nic.Network)
+			t.addNode(networkID, TopologyNetwork, "")
+			label := nic.IP
+			if len(nic.IPs) > 0 {
+				label = strings.Join(nic.IPs, ", ")
+			}
+			t.addEdge(machineID, networkID, TopologyNIC, label)
+		}
+	}
+
+	if !opts.FirewallRules {
+		return t, nil
+	}
+	for _, machine := range machines {
+		rules, err := c.ListMachineFirewallRules(machine.Id)
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range rules {
+			if !rule.Enabled {
+				continue
+			}
+			ruleID := topologyID(TopologyRule, rule.Id)
+			t.addNode(ruleID, TopologyRule, rule.Rule)
+			t.addEdge(ruleID, topologyID(TopologyMachine, machine.Id), TopologyFirewall, "")
+		}
+	}
+	return t, nil
+}
+
+// topologyID returns the ID of a node of the given kind
+func topologyID(kind TopologyKind, id string) string {
+	return string(kind) + ":" + id
+}
+
+// addNode adds a node to the topology unless it has it already. Nodes
+// without a label are labelled with their ID.
+func (t *Topology) addNode(id string, kind TopologyKind, label string) {
+	if t.index[id] {
+		return
+	}
+	if label == "" {
+		label = strings.TrimPrefix(id, string(kind)+":")
+	}
+	t.index[id] = true
+	t.Nodes = append(t.Nodes, TopologyNode{Id: id, Kind: kind, Label: label})
+}
+
+func (t *Topology) addEdge(from, to string, kind TopologyKind, label string) {
+	t.Edges = append(t.Edges, TopologyEdge{From: from, To: to, Kind: kind, Label: label})
+}
+
+// dotShapes are the Graphviz shapes of the kinds of nodes
+var dotShapes = map[TopologyKind]string{
+	TopologyMachine: "box",
+	TopologyNetwork: "ellipse",
+	TopologyVLAN:    "hexagon",
+	TopologyRule:    "note",
+}
+
+// WriteDOT writes the topology as an undirected Graphviz DOT graph.
+// Firewall rule edges are dashed.
+func (t *Topology) WriteDOT(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, "graph topology {")
+	for _, node := range t.Nodes {
+		fmt.Fprintf(b, "\t%s [label=%s shape=%s];\n", dotQuote(node.Id), dotQuote(node.Label), dotShapes[node.Kind])
+	}
+	for _, edge := range t.Edges {
+		attrs := []string{}
+		if edge.Label != "" {
+			attrs = append(attrs, "label="+dotQuote(edge.Label))
+		}
+		if edge.Kind == TopologyFirewall {
+			attrs = append(attrs, "style=dashed")
+		}
+		fmt.Fprintf(b, "\t%s -- %s", dotQuote(edge.From), dotQuote(edge.To))
+		if len(attrs) > 0 {
+			fmt.Fprintf(b, " [%s]", strings.Join(attrs, " "))
+		}
+		fmt.Fprintln(b, ";")
+	}
+	fmt.Fprintln(b, "}")
+	if err := b.Flush(); err != nil {
+		return errors.Newf(err, "failed to write topology as DOT")
+	}
+	return nil
+}
+
+// dotEscaper escapes what DOT needs escaped in a quoted string
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// dotQuote returns s as a quoted DOT string, with backslashes and double
+// quotes escaped and anything else, such as UTF-8, left as is
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
+
+// WriteJSON writes the topology as a JSON object of its nodes and edges
+func (t *Topology) WriteJSON(w io.Writer) error {
+	if err := json.NewEncoder(w).Encode(t); err != nil {
+		return errors.Newf(err, "failed to write topology as JSON")
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package cloudapi_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/joyent/gosdc/cloudapi"
+	gc "launchpad.net/gocheck"
+)
+
+func (s *LocalTests) TestTopology(c *gc.C) {
+	vlan, network, cleanup := s.createFabricNetwork(c)
+	defer cleanup()
+	// only on the fabric network, so that its only NIC is there
+	machine := s.createMachine(c, network.Id)
+	defer s.deleteMachine(c, machine.Id)
+	nics, err := s.testClient.ListNICs(machine.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(nics, gc.HasLen, 1)
+	nic := nics[0]
+	rule, err := s.testClient.CreateFirewallRule(cloudapi.CreateFwRuleOpts{
+		Enabled: true,
+		Rule:    "FROM any TO vm " + machine.Id + " ALLOW tcp PORT 22",
+	})
+	c.Assert(err, gc.IsNil)
+	defer s.deleteFwRule(c, rule.Id)
+
+	machineID := "machine:" + machine.Id
+	networkID := "network:" + network.Id
+	vlanID := "vlan:" + strconv.Itoa(int(vlan.Id))
+	ruleID := "firewall_rule:" + rule.Id
+
+	topology, err := s.testClient.Topology(cloudapi.TopologyOpts{})
+	c.Assert(err, gc.IsNil)
+	nodes := map[string]cloudapi.TopologyNode{}
+	for _, node := range topology.Nodes {
+		nodes[node.Id] = node
+	}
+	// the machine has no name, so it is labelled with its ID
+	c.Assert(nodes[machineID], gc.Equals, cloudapi.TopologyNode{Id: machineID, Kind: cloudapi.TopologyMachine, Label: machine.Id})
+	c.Assert(nodes[networkID], gc.Equals, cloudapi.TopologyNode{Id: networkID, Kind: cloudapi.TopologyNetwork, Label: network.Name})
+	c.Assert(nodes[vlanID], gc.Equals, cloudapi.TopologyNode{Id: vlanID, Kind: cloudapi.TopologyVLAN, Label: vlan.Name})
+	_, present := nodes[ruleID]
+	c.Assert(present, gc.Equals, false)
+	c.Assert(topology.Edges, gc.HasLen, 2)
+	c.Assert(topology.Edges, gc.DeepEquals, []cloudapi.TopologyEdge{
+		{From: networkID, To: vlanID, Kind: cloudapi.TopologyOnVLAN},
+		{From: machineID, To: networkID, Kind: cloudapi.TopologyNIC, Label: strings.Join(nic.IPs, ", ")},
+	})
+
+	topology, err = s.testClient.Topology(cloudapi.TopologyOpts{FirewallRules: true})
+	c.Assert(err, gc.IsNil)
+	c.Assert(topology.Edges[len(topology.Edges)-1], gc.Equals, cloudapi.TopologyEdge{From: ruleID, To: machineID, Kind: cloudapi.TopologyFirewall})
+
+	var dot bytes.Buffer
+	c.Assert(topology.WriteDOT(&dot), gc.IsNil)
+	c.Assert(strings.HasPrefix(dot.String(), "graph topology {\n"), gc.Equals, true)
+	c.Assert(dot.String(), gc.Matches, `(?s).*\t"`+vlanID+`" \[label="`+vlan.Name+`" shape=hexagon\];\n.*`)
+	c.Assert(dot.String(), gc.Matches, `(?s).*\t"`+machineID+`" -- "`+networkID+`" \[label="[^"]+"\];\n.*`)
+	c.Assert(dot.String(), gc.Matches, `(?s).*\t"`+ruleID+`" -- "`+machineID+`" \[style=dashed\];\n}\n`)
+
+	var out bytes.Buffer
+	c.Assert(topology.WriteJSON(&out), gc.IsNil)
+	var decoded cloudapi.Topology
+	c.Assert(json.Unmarshal(out.Bytes(), &decoded), gc.IsNil)
+	c.Assert(decoded.Nodes, gc.DeepEquals, topology.Nodes)
+	c.Assert(decoded.Edges, gc.DeepEquals, topology.Edges)
+}
+
+func (s *LocalTests) TestTopologyDOTQuoting(c *gc.C) {
+	topology := &cloudapi.Topology{
+		Nodes: []cloudapi.TopologyNode{{Id: "machine:1", Kind: cloudapi.TopologyMachine, Label: `say "héllo" \ bye`}},
+		Edges: []cloudapi.TopologyEdge{},
+	}
+	var dot bytes.Buffer
+	c.Assert(topology.WriteDOT(&dot), gc.IsNil)
+	// only backslashes and double quotes are escaped, UTF-8 is left as is
+	c.Assert(dot.String(), gc.Equals, "graph topology {\n\t\"machine:1\" [label=\"say \\\"héllo\\\" \\\\ bye\" shape=box];\n}\n")
+}
@@ -0,0 +1,280 @@
+//
+// gosdc - Go library to interact with the Joyent CloudAPI
+//
+// Standalone CloudAPI double server
+//
+// Copyright (c) Joyent Inc.
+//
+
+/*
+Command sdc-double serves the local CloudAPI double over HTTP or HTTPS, so that
+tools such as the triton CLI or Terraform, and programs not written in Go, can
+be pointed at it.
+
+	sdc-double -port 8080 -account tester -fixture catalog.yaml
+
+Flags:
+
+	-host, -port          address to listen on (127.0.0.1:8080)
+	-account              account the double serves (tester); may be
+	                      repeated to serve several accounts, the first one
+	                      holding the packages, images and networks
+	-url                  URL the double is reached at, derived from the
+	                      address by default
+	-tls-cert, -tls-key   serve HTTPS with the given certificate and key
+	-fixture              JSON or YAML fixture to load, see
+	                      localservices/cloudapi.Fixture; may be repeated
+	-key [account/]name=path
+	                      add the OpenSSH public key at path to the account,
+	                      the first one by default; may be repeated
+	-require-signatures   reject requests that are not signed by a key of
+	                      the account
+	-quiet                do not log requests
+	-shutdown-timeout     how long to wait for requests in flight on SIGINT
+	                      or SIGTERM (10s)
+
+The endpoints under /_admin, such as /_admin/reset or /_admin/faults, control
+the double, see localservices/cloudapi.AdminRoute. /_admin/reset brings the
+double back to the fixtures and keys it was started with.
+*/
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	lc "github.com/joyent/gosdc/localservices/cloudapi"
+	"github.com/julienschmidt/httprouter"
+)
+
+// stringList is a flag that may be given more than once
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+type config struct {
+	host              string
+	port              int
+	account           string
+	accounts          stringList
+	url               string
+	tlsCert           string
+	tlsKey            string
+	fixtures          stringList
+	keys              stringList
+	requireSignatures bool
+	quiet             bool
+	shutdownTimeout   time.Duration
+}
+
+func parseFlags(args []string, output io.Writer) (*config, error) {
+	cfg := &config{}
+	flags := flag.NewFlagSet("sdc-double", flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.StringVar(&cfg.host, "host", "127.0.0.1", "host to listen on")
+	flags.IntVar(&cfg.port, "port", 8080, "port to listen on")
+	flags.Var(&cfg.accounts, "account", "account the double serves, may be repeated (tester)")
+	flags.StringVar(&cfg.url, "url", "", "URL the double is reached at")
+	flags.StringVar(&cfg.tlsCert, "tls-cert", "", "TLS certificate file, to serve HTTPS")
+	flags.StringVar(&cfg.tlsKey, "tls-key", "", "TLS key file, to serve HTTPS")
+	flags.Var(&cfg.fixtures, "fixture", "JSON or YAML fixture file to load, may be repeated")
+	flags.Var(&cfg.keys, "key", "[account/]name=path of an OpenSSH public key to add to the account, may be repeated")
+	flags.BoolVar(&cfg.requireSignatures, "require-signatures", false, "reject requests that are not signed by a key of the account")
+	flags.BoolVar(&cfg.quiet, "quiet", false, "do not log requests")
+	flags.DurationVar(&cfg.shutdownTimeout, "shutdown-timeout", 10*time.Second, "how long to wait for requests in flight when shutting down")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if flags.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+	if len(cfg.accounts) == 0 {
+		cfg.accounts = stringList{"tester"}
+	}
+	cfg.account = cfg.accounts[0]
+	if (cfg.tlsCert == "") != (cfg.tlsKey == "") {
+		return nil, fmt.Errorf("-tls-cert and -tls-key must be given together")
+	}
+	if cfg.url == "" {
+		scheme := "http"
+		if cfg.tlsCert != "" {
+			scheme = "https"
+		}
+		cfg.url = scheme + "://" + net.JoinHostPort(cfg.host, strconv.Itoa(cfg.port))
+	}
+
+	return cfg, nil
+}
+
+// newDouble builds the double described by the configuration
+func newDouble(cfg *config) (*lc.CloudAPI, error) {
+	api := lc.New(cfg.url, cfg.account)
+	for _, login := range cfg.accounts[1:] {
+		if _, err := api.AddAccount(login); err != nil {
+			return nil, err
+		}
+	}
+	for _, login := range api.Accounts() {
+		account, err := api.Account(login)
+		if err != nil {
+			return nil, err
+		}
+		// nobody verifies calls made to a long running server
+		account.RecordCalls(false)
+	}
+
+	for _, path := range cfg.fixtures {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		f, err := lc.ParseFixture(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		if err := api.LoadFixture(f); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	}
+
+	for _, key := range cfg.keys {
+		parts := strings.SplitN(key, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("-key must be [account/]name=path, got %q", key)
+		}
+		account, name := api, parts[0]
+		if i := strings.Index(name, "/"); i >= 0 {
+			var err error
+			if account, err = api.Account(name[:i]); err != nil {
+				return nil, err
+			}
+			name = name[i+1:]
+		}
+		data, err := ioutil.ReadFile(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		if _, err := account.CreateKey(name, strings.TrimSpace(string(data))); err != nil {
+			return nil, err
+		}
+	}
+
+	// POST /_admin/reset goes back to the fixtures and keys loaded above
+	api.SetBaseline()
+	api.RequireSignatures(cfg.requireSignatures)
+	return api, nil
+}
+
+// newHandler returns the HTTP handler serving the double, logging requests
+// to logger unless it is nil
+func newHandler(api *lc.CloudAPI, logger *log.Logger) http.Handler {
+	mux := httprouter.New()
+	api.SetupHTTP(mux)
+	if logger == nil {
+		return mux
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			// faults abort requests to drop or truncate them
+			if err := recover(); err != nil {
+				logger.Printf("%s %s aborted %s", r.Method, r.URL.RequestURI(), time.Since(start))
+				panic(err)
+			}
+		}()
+		mux.ServeHTTP(rec, r)
+		logger.Printf("%s %s %d %s", r.Method, r.URL.RequestURI(), rec.status, time.Since(start))
+	})
+}
+
+// statusRecorder remembers the status of a response for logging
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func main() {
+	logger := log.New(os.Stderr, "sdc-double: ", log.LstdFlags)
+
+	cfg, err := parseFlags(os.Args[1:], os.Stderr)
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	api, err := newDouble(cfg)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	requestLogger := logger
+	if cfg.quiet {
+		requestLogger = nil
+	}
+	server := &http.Server{
+		Addr:    net.JoinHostPort(cfg.host, strconv.Itoa(cfg.port)),
+		Handler: newHandler(api, requestLogger),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		sig := <-signals
+		logger.Printf("%s received, shutting down", sig)
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			logger.Printf("shutdown: %s", err)
+		}
+	}()
+
+	logger.Printf("serving accounts %s at %s", strings.Join(cfg.accounts, ", "), cfg.url)
+	if cfg.tlsCert != "" {
+		err = server.ListenAndServeTLS(cfg.tlsCert, cfg.tlsKey)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		logger.Fatal(err)
+	}
+	<-done
+}
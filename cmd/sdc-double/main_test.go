@@ -0,0 +1,210 @@
+//
+// gosdc - Go library to interact with the Joyent CloudAPI
+//
+// Standalone CloudAPI double server tests
+//
+// Copyright (c) Joyent Inc.
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	lc "github.com/joyent/gosdc/localservices/cloudapi"
+)
+
+const testKey = "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAAAgQC5 tester@localhost"
+
+func TestParseFlags(t *testing.T) {
+	cfg, err := parseFlags(nil, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.url != "http://127.0.0.1:8080" || cfg.account != "tester" {
+		t.Fatalf("unexpected defaults %+v", cfg)
+	}
+
+	cfg, err = parseFlags([]string{"-port", "8443", "-tls-cert", "c.pem", "-tls-key", "k.pem", "-fixture", "a.yaml", "-fixture", "b.json"}, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.url != "https://127.0.0.1:8443" {
+		t.Fatalf("expected an HTTPS URL, got %s", cfg.url)
+	}
+	if len(cfg.fixtures) != 2 {
+		t.Fatalf("expected both fixtures, got %v", cfg.fixtures)
+	}
+
+	if _, err := parseFlags([]string{"-tls-cert", "c.pem"}, ioutil.Discard); err == nil {
+		t.Fatal("expected -tls-cert without -tls-key to be rejected")
+	}
+}
+
+func TestServe(t *testing.T) {
+	dir := t.TempDir()
+	fixture := filepath.Join(dir, "fixture.yaml")
+	if err := ioutil.WriteFile(fixture, []byte("packages:\n  - name: Tiny\n    memory: 256\n"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	key := filepath.Join(dir, "id_rsa.pub")
+	if err := ioutil.WriteFile(key, []byte(testKey+"\n"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	cfg, err := parseFlags([]string{"-fixture", fixture, "-key", "laptop=" + key}, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	api, err := newDouble(cfg)
+	if err != nil {
+		t.Fatalf("newDouble: %v", err)
+	}
+	var logged bytes.Buffer
+	server := httptest.NewServer(newHandler(api, log.New(&logged, "", 0)))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/tester/packages")
+	if err != nil {
+		t.Fatalf("GET packages: %v", err)
+	}
+	defer resp.Body.Close()
+	var pkgs []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&pkgs); err != nil {
+		t.Fatalf("decoding packages: %v", err)
+	}
+	if len(pkgs) != 1 || pkgs[0]["Name"] != "Tiny" {
+		t.Fatalf("expected the fixture package, got %v", pkgs)
+	}
+
+	keys, err := api.ListKeys()
+	if err != nil {
+		t.Fatalf("ListKeys: %v", err)
+	}
+	if len(keys) != 1 || keys[0].Name != "laptop" || keys[0].Key != testKey {
+		t.Fatalf("expected the laptop key, got %v", keys)
+	}
+
+	// a reset goes back to the fixture and keys the double was started with
+	if err := api.DeleteKey("laptop"); err != nil {
+		t.Fatalf("DeleteKey: %v", err)
+	}
+	reset, err := http.Post(server.URL+lc.AdminRoute+"/reset", "application/json", nil)
+	if err != nil {
+		t.Fatalf("POST reset: %v", err)
+	}
+	reset.Body.Close()
+	if pkgs, err := api.ListPackages(nil); err != nil || len(pkgs) != 1 || pkgs[0].Name != "Tiny" {
+		t.Fatalf("expected the fixture package after a reset, got %v, %v", pkgs, err)
+	}
+	if keys, err := api.ListKeys(); err != nil || len(keys) != 1 {
+		t.Fatalf("expected the laptop key after a reset, got %v, %v", keys, err)
+	}
+
+	server.Close()
+	if got := logged.String(); !strings.HasPrefix(got, "GET /tester/packages 200 ") {
+		t.Fatalf("unexpected request log %q", got)
+	}
+}
+
+func TestAccounts(t *testing.T) {
+	key := filepath.Join(t.TempDir(), "id_rsa.pub")
+	if err := ioutil.WriteFile(key, []byte(testKey+"\n"), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	cfg, err := parseFlags([]string{"-account", "operator", "-account", "reseller", "-key", "reseller/laptop=" + key}, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	if cfg.account != "operator" {
+		t.Fatalf("expected the first account to be the primary one, got %s", cfg.account)
+	}
+	api, err := newDouble(cfg)
+	if err != nil {
+		t.Fatalf("newDouble: %v", err)
+	}
+	reseller, err := api.Account("reseller")
+	if err != nil {
+		t.Fatalf("Account: %v", err)
+	}
+	if keys, err := reseller.ListKeys(); err != nil || len(keys) != 1 {
+		t.Fatalf("expected the key of the reseller, got %v, %v", keys, err)
+	}
+	if keys, err := api.ListKeys(); err != nil || len(keys) != 0 {
+		t.Fatalf("expected no key for the operator, got %v, %v", keys, err)
+	}
+
+	server := httptest.NewServer(newHandler(api, nil))
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/reseller/keys")
+	if err != nil {
+		t.Fatalf("GET keys: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the reseller to be served, got %d", resp.StatusCode)
+	}
+
+	cfg.keys = []string{"nobody/laptop=" + key}
+	if _, err := newDouble(cfg); err == nil {
+		t.Fatal("expected a key for an unknown account to be rejected")
+	}
+}
+
+func TestRequireSignatures(t *testing.T) {
+	cfg, err := parseFlags([]string{"-require-signatures"}, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	api, err := newDouble(cfg)
+	if err != nil {
+		t.Fatalf("newDouble: %v", err)
+	}
+	server := httptest.NewServer(newHandler(api, nil))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/tester/packages")
+	if err != nil {
+		t.Fatalf("GET packages: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected an unsigned request to be rejected, got %d", resp.StatusCode)
+	}
+}
+
+func TestLogDroppedRequests(t *testing.T) {
+	cfg, err := parseFlags(nil, ioutil.Discard)
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	api, err := newDouble(cfg)
+	if err != nil {
+		t.Fatalf("newDouble: %v", err)
+	}
+	if _, err := api.AddFault(lc.Fault{Operation: "ListKeys", Drop: true}); err != nil {
+		t.Fatalf("AddFault: %v", err)
+	}
+	var logged bytes.Buffer
+	server := httptest.NewUnstartedServer(newHandler(api, log.New(&logged, "", 0)))
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.Start()
+
+	_, err = http.Get(server.URL + "/tester/keys")
+	server.Close()
+	if err == nil {
+		t.Fatal("expected the connection to be dropped")
+	}
+	if got := logged.String(); !strings.HasPrefix(got, "GET /tester/keys aborted ") {
+		t.Fatalf("unexpected request log %q", got)
+	}
+}
@@ -3,12 +3,12 @@ Package gosdc enables Go programs to interact with the Joyent CloudAPI.
 
 The gosdc package is structured as follow:
 
-	- gosdc/cloudapi. This package interacts with the Cloud API (http://apidocs.joyent.com/cloudapi/).
-	- gosdc/localservices. This package provides local services to be used for testing.
+  - gosdc/cloudapi. This package interacts with the Cloud API (http://apidocs.joyent.com/cloudapi/).
+  - gosdc/localservices. This package provides local services to be used for testing.
+  - gosdc/cmd/sdc-double. This command serves the local CloudAPI double over HTTP.
 
-Licensed under the Mozilla Public License version 2.0
+Licensed under the Mozilla Public License version 2.0.
 
 Copyright (c) Joyent Inc.
-
 */
 package gosdc
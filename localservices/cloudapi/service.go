@@ -9,14 +9,15 @@
 package cloudapi
 
 import (
-	"fmt"
 	"math/rand"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/joyent/gosdc/cloudapi"
 	"github.com/joyent/gosdc/localservices"
+	"github.com/julienschmidt/httprouter"
 )
 
 var (
@@ -26,23 +27,74 @@ var (
 	machinesFilters = []string{"type", "name", "image", "state", "memory", "tombstone", "limit", "offset", "credentials"}
 )
 
-// CloudAPI is the API test double
+// CloudAPI is the API test double of an account. It is safe for concurrent
+// use; values returned by its methods are copies of the internal state.
+//
+// New returns the double of the primary account, AddAccount those of other
+// accounts served alongside it.
 type CloudAPI struct {
 	localservices.ServiceInstance
+	*host
+	accountID string
+	router    *httprouter.Router // routes of the account, nil for the primary account
+	state
+
+	analyticsSeed int64
+
+	limits Limits
+}
+
+// host is what the accounts served by a double share: the lock guarding all
+// of them, the catalog of packages, images and networks held by the primary
+// account, and the configuration of the simulated datacenter.
+type host struct {
+	mu            sync.RWMutex
+	serviceURL    string
+	primary       *CloudAPI
+	accounts      map[string]*CloudAPI // by login, including the primary account
+	checkpoints   map[string]map[string]*state
+	checkpointSeq int
+	baseline      map[string]*state // what Reset goes back to, if set
+	datacenters   map[string]string
+	services      map[string]string
+	clock         Clock
+	transitions   map[string]Transition
+
+	requireSignatures bool
+	clockSkew         time.Duration
+
+	faults    []*Fault
+	faultSeq  int
+	faultRand *rand.Rand
+
+	computeNodes []ComputeNode
+}
+
+// state is the resources held by an account, as saved by Checkpoint. Only the
+// primary account holds packages, images and networks, which all the accounts
+// of the double share.
+type state struct {
 	keys          []cloudapi.Key
 	packages      []cloudapi.Package
 	images        []cloudapi.Image
 	machines      []*machine
-	snapshots     map[string][]cloudapi.Snapshot
+	snapshots     map[string][]*snapshot
 	firewallRules []*cloudapi.FirewallRule
 	networks      []cloudapi.Network
 	fabricVLANs   map[int16]*fabricVLAN
+	reservedIPs   map[string]map[string]bool // IPs reserved by the account, by network
+
+	instrumentations   []*instrumentation
+	instrumentationSeq int
 }
 
 type machine struct {
 	cloudapi.Machine
 	NICs        map[string]*cloudapi.NIC `json:"-"`
 	NetworkNICs map[string]string        `json:"-"`
+	pending     *transition
+
+	provisionError *Error // why provisioning failed, if it failed for lack of capacity
 }
 
 // fabricNetwork is a container for a fabric network and it's associated VLANs
@@ -62,36 +114,58 @@ func New(serviceURL, userAccount string) *CloudAPI {
 		hostname += separator
 	}
 
-	var (
-		keys          []cloudapi.Key
-		machines      []*machine
-		snapshots     = map[string][]cloudapi.Snapshot{}
-		firewallRules []*cloudapi.FirewallRule
-		fabricVLANs   = map[int16]*fabricVLAN{}
-	)
+	accountID, err := localservices.NewUUID()
+	if err != nil {
+		panic(err)
+	}
 
 	cloudapiService := &CloudAPI{
-		keys:          keys,
-		packages:      initPackages(),
-		images:        initImages(),
-		machines:      machines,
-		snapshots:     snapshots,
-		firewallRules: firewallRules,
-		fabricVLANs:   fabricVLANs,
-		networks: []cloudapi.Network{
-			{Id: "123abc4d-0011-aabb-2233-ccdd4455", Name: "Test-Joyent-Public", Public: true},
-			{Id: "456def0a-33ff-7f8e-9a0b-33bb44cc", Name: "Test-Joyent-Private", Public: false},
+		host: &host{
+			serviceURL:  trimURL(serviceURL),
+			checkpoints: map[string]map[string]*state{},
+			datacenters: map[string]string{DefaultDatacenter: trimURL(serviceURL)},
+			services:    map[string]string{"cloudapi": trimURL(serviceURL)},
+			clock:       systemClock{},
+			transitions: map[string]Transition{},
+			clockSkew:   DefaultClockSkew,
+			faultRand:   rand.New(rand.NewSource(time.Now().UnixNano())),
 		},
+		accountID: accountID,
+		state:     newState(),
 		ServiceInstance: localservices.ServiceInstance{
 			Scheme:      URL.Scheme,
 			Hostname:    hostname,
 			UserAccount: userAccount,
 		},
 	}
+	cloudapiService.primary = cloudapiService
+	cloudapiService.accounts = map[string]*CloudAPI{userAccount: cloudapiService}
 
 	return cloudapiService
 }
 
+// newAccountState returns the resources a new account other than the
+// primary one starts with. They do not include a catalog.
+func newAccountState() state {
+	return state{
+		snapshots:   map[string][]*snapshot{},
+		fabricVLANs: map[int16]*fabricVLAN{},
+		reservedIPs: map[string]map[string]bool{},
+	}
+}
+
+// newState returns the resources a new double starts with
+func newState() state {
+	return state{
+		packages:    initPackages(),
+		images:      initImages(),
+		networks:    initNetworks(),
+		snapshots:   map[string][]*snapshot{},
+		fabricVLANs: map[int16]*fabricVLAN{},
+		reservedIPs: map[string]map[string]bool{},
+	}
+}
+
 func initPackages() []cloudapi.Package {
 	return []cloudapi.Package{
 		{
@@ -210,14 +284,72 @@ func initImages() []cloudapi.Image {
 	}
 }
 
-func generatePublicIPAddress() string {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	return fmt.Sprintf("32.151.%d.%d", r.Intn(255), r.Intn(255))
+func initNetworks() []cloudapi.Network {
+	return []cloudapi.Network{
+		{
+			Id:               "123abc4d-0011-aabb-2233-ccdd4455",
+			Name:             "Test-Joyent-Public",
+			Public:           true,
+			Subnet:           "32.151.0.0/16",
+			ProvisionStartIp: "32.151.0.10",
+			ProvisionEndIp:   "32.151.255.250",
+			Gateway:          "32.151.0.1",
+		},
+		{
+			Id:               "456def0a-33ff-7f8e-9a0b-33bb44cc",
+			Name:             "Test-Joyent-Private",
+			Public:           false,
+			Subnet:           "10.201.0.0/16",
+			ProvisionStartIp: "10.201.0.10",
+			ProvisionEndIp:   "10.201.255.250",
+			Gateway:          "10.201.0.1",
+		},
+	}
+}
+
+func copyStrings(in []string) []string {
+	if in == nil {
+		return nil
+	}
+	out := make([]string, len(in))
+	copy(out, in)
+	return out
+}
+
+func copyStringMap(in map[string]string) map[string]string {
+	if in == nil {
+		return nil
+	}
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
 }
 
-func generatePrivateIPAddress() string {
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	return fmt.Sprintf("10.201.%d.%d", r.Intn(255), r.Intn(255))
+// copyMachine returns a deep copy of the given machine
+func copyMachine(m *cloudapi.Machine) *cloudapi.Machine {
+	out := *m
+	out.IPs = copyStrings(m.IPs)
+	out.Networks = copyStrings(m.Networks)
+	out.DomainNames = copyStrings(m.DomainNames)
+	out.Metadata = copyStringMap(m.Metadata)
+	out.Tags = copyStringMap(m.Tags)
+	return &out
+}
+
+// copyImage returns a deep copy of the given image
+func copyImage(image cloudapi.Image) cloudapi.Image {
+	out := image
+	out.Tags = copyStringMap(image.Tags)
+	out.ACL = copyStrings(image.ACL)
+	if image.Requirements != nil {
+		out.Requirements = make(map[string]interface{}, len(image.Requirements))
+		for k, v := range image.Requirements {
+			out.Requirements[k] = v
+		}
+	}
+	return out
 }
 
 func contains(list []string, elem string) bool {
@@ -0,0 +1,160 @@
+//
+// gosdc - Go library to interact with the Joyent CloudAPI
+//
+// CloudAPI double testing service - accounts
+//
+// Copyright (c) Joyent Inc.
+//
+
+package cloudapi
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/joyent/gosdc/cloudapi"
+	"github.com/joyent/gosdc/localservices"
+	"github.com/julienschmidt/httprouter"
+)
+
+// AddAccount adds an account to the double and returns the double of that
+// account. The account has its own keys, machines, firewall rules, fabrics,
+// instrumentations, limits and hooks, and shares the packages, images and
+// networks of the primary account as well as the clock, transitions, faults,
+// compute nodes and checkpoints of the double. It is served over HTTP under
+// /<login> by the router the double was set up on with SetupHTTP.
+func (c *CloudAPI) AddAccount(login string) (*CloudAPI, error) {
+	if login == "" || strings.Contains(login, separator) || separator+login == AdminRoute {
+		return nil, invalidArgumentError("Invalid login %q", login)
+	}
+	accountID, err := localservices.NewUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	account := &CloudAPI{
+		host:      c.host,
+		accountID: accountID,
+		router:    httprouter.New(),
+		state:     newAccountState(),
+		ServiceInstance: localservices.ServiceInstance{
+			Scheme:      c.Scheme,
+			Hostname:    c.Hostname,
+			UserAccount: login,
+		},
+	}
+	account.router.NotFound = NotFound{}
+	account.router.MethodNotAllowed = MethodNotAllowed{}
+	account.setupAccountHTTP(account.router)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.accounts[login]; ok {
+		return nil, conflictError("Account %s already exists", login)
+	}
+	c.accounts[login] = account
+
+	return account, nil
+}
+
+// Account returns the double of the account with the given login
+func (c *CloudAPI) Account(login string) (*CloudAPI, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	account, ok := c.accounts[login]
+	if !ok {
+		return nil, notFoundError("Account %s not found", login)
+	}
+	return account, nil
+}
+
+// Accounts returns the logins of the accounts of the double, sorted
+func (c *CloudAPI) Accounts() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	logins := make([]string, 0, len(c.accounts))
+	for login := range c.accounts {
+		logins = append(logins, login)
+	}
+	sort.Strings(logins)
+	return logins
+}
+
+// AccountID returns the UUID of the account, as found in the Owner and ACL
+// of images
+func (c *CloudAPI) AccountID() string {
+	return c.accountID
+}
+
+// URL returns the URL the double is served from
+func (c *CloudAPI) URL() string {
+	return c.serviceURL
+}
+
+// accountList returns the accounts of the double sorted by login. The caller
+// must hold c.mu.
+func (c *CloudAPI) accountList() []*CloudAPI {
+	logins := make([]string, 0, len(c.accounts))
+	for login := range c.accounts {
+		logins = append(logins, login)
+	}
+	sort.Strings(logins)
+
+	accounts := make([]*CloudAPI, len(logins))
+	for i, login := range logins {
+		accounts[i] = c.accounts[login]
+	}
+	return accounts
+}
+
+// settleAll completes the machine transitions that are due in every account.
+// The caller must hold c.mu for writing.
+func (c *CloudAPI) settleAll() {
+	for _, account := range c.accounts {
+		account.settle()
+	}
+}
+
+// isAccount reports whether an image owner or ACL entry names the account,
+// by UUID or by login
+func (c *CloudAPI) isAccount(id string) bool {
+	return id != "" && (id == c.accountID || id == c.UserAccount)
+}
+
+// canSee reports whether an image is visible to the account: public images
+// are, private ones to their owner and the accounts in their ACL.
+func (c *CloudAPI) canSee(image *cloudapi.Image) bool {
+	if image.Public || c.isAccount(image.Owner) {
+		return true
+	}
+	for _, id := range image.ACL {
+		if c.isAccount(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// accountsHandler serves the requests of the accounts added with AddAccount,
+// each with the router of its account
+type accountsHandler struct {
+	cloudapi *CloudAPI
+}
+
+func (h accountsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	login := strings.SplitN(strings.TrimPrefix(r.URL.Path, separator), separator, 2)[0]
+
+	h.cloudapi.mu.RLock()
+	account := h.cloudapi.accounts[login]
+	h.cloudapi.mu.RUnlock()
+
+	if account == nil || account.router == nil {
+		NotFound{}.ServeHTTP(w, r)
+		return
+	}
+	account.router.ServeHTTP(w, r)
+}
@@ -0,0 +1,658 @@
+//
+// gosdc - Go library to interact with the Joyent CloudAPI
+//
+// CloudAPI double testing service - analytics
+//
+// Copyright (c) Joyent Inc.
+//
+
+package cloudapi
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joyent/gosdc/cloudapi"
+)
+
+const (
+	defaultGranularity   = 1
+	defaultRetentionTime = 600
+	defaultIdleMax       = 3600
+
+	defaultHeatmapWidth    = 600
+	defaultHeatmapHeight   = 300
+	defaultHeatmapNbuckets = 100
+
+	// rawValueBuckets is the number of value ranges a numeric decomposition
+	// is split into in raw values.
+	rawValueBuckets = 10
+	// maxDataPoints bounds the number of data points generated for a single
+	// interval of a numerically decomposed instrumentation.
+	maxDataPoints = 50
+)
+
+// analyticsType describes a type of metric or field value
+type analyticsType struct {
+	arity string // "discrete" or "numeric"
+	unit  string
+	max   int // upper bound for generated values
+}
+
+var analyticsTypes = map[string]analyticsType{
+	"string":  {arity: "discrete"},
+	"number":  {arity: "numeric", max: 1000},
+	"percent": {arity: "numeric", unit: "percent", max: 100},
+	"size":    {arity: "numeric", unit: "bytes", max: 1 << 20},
+	"time":    {arity: "numeric", unit: "nanoseconds", max: 1000000},
+}
+
+// analyticsField describes a field metrics can be filtered or decomposed by
+type analyticsField struct {
+	label string
+	typ   string
+}
+
+var analyticsFields = map[string]analyticsField{
+	"zonename":  {"zone name", "string"},
+	"pid":       {"process identifier", "string"},
+	"execname":  {"application name", "string"},
+	"pexecname": {"parent application name", "string"},
+	"syscall":   {"system call", "string"},
+	"nic":       {"NIC name", "string"},
+	"direction": {"sent/received", "string"},
+	"optype":    {"operation type", "string"},
+	"fstype":    {"filesystem type", "string"},
+	"raddr":     {"remote IP address", "string"},
+	"rport":     {"remote TCP port", "string"},
+	"latency":   {"latency", "time"},
+	"size":      {"size", "size"},
+}
+
+// analyticsMetric describes a quantity measured by the analytics service
+type analyticsMetric struct {
+	module   string
+	stat     string
+	label    string
+	typ      string
+	interval string // "interval" or "point"
+	fields   []string
+}
+
+var analyticsModules = map[string]string{
+	"cpu":     "CPU",
+	"memory":  "Memory",
+	"nic":     "Network interfaces",
+	"syscall": "System calls",
+	"fs":      "Filesystem",
+	"tcp":     "TCP",
+}
+
+var analyticsMetrics = []analyticsMetric{
+	{"cpu", "thread_samples", "thread samples", "number", "interval", []string{"zonename", "pid", "execname", "pexecname"}},
+	{"cpu", "usage", "aggregated CPU usage", "percent", "interval", []string{"zonename"}},
+	{"memory", "rss", "resident set size", "size", "point", []string{"zonename"}},
+	{"nic", "bytes", "bytes sent and received", "size", "interval", []string{"nic", "direction", "zonename"}},
+	{"syscall", "syscalls", "system calls", "number", "interval", []string{"zonename", "syscall", "execname", "latency"}},
+	{"fs", "logical_ops", "logical filesystem operations", "number", "interval", []string{"zonename", "optype", "fstype", "latency", "size"}},
+	{"tcp", "connections", "TCP connections", "number", "interval", []string{"zonename", "raddr", "rport"}},
+}
+
+// analyticsTransformation describes a post-processing function for values
+type analyticsTransformation struct {
+	label  string
+	fields []string
+}
+
+var analyticsTransformations = map[string]analyticsTransformation{
+	"geolocate":  {"geolocate IP addresses", []string{"raddr"}},
+	"reversedns": {"reverse dns IP addresses lookup", []string{"raddr"}},
+}
+
+// instrumentation is an instrumentation along with what is needed to
+// generate its data
+type instrumentation struct {
+	cloudapi.Instrumentation
+	metric   analyticsMetric
+	discrete string // discrete decomposition field, if any
+	numeric  string // numeric decomposition field, if any
+}
+
+// dataPoint is a single synthetic observation of a numerically decomposed
+// instrumentation
+type dataPoint struct {
+	key   string
+	value int
+}
+
+func findMetric(module, stat string) (analyticsMetric, bool) {
+	for _, m := range analyticsMetrics {
+		if m.module == module && m.stat == stat {
+			return m, true
+		}
+	}
+	return analyticsMetric{}, false
+}
+
+// SetAnalyticsSeed sets the seed synthetic instrumentation data is generated
+// from. The same seed always yields the same values for a given
+// instrumentation ID and point in time.
+func (c *CloudAPI) SetAnalyticsSeed(seed int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.analyticsSeed = seed
+}
+
+// DescribeAnalytics returns the schema of the analytics service
+func (c *CloudAPI) DescribeAnalytics() (result *cloudapi.Analytics, err error) {
+	call, err := c.StartCall(HookDescribeAnalytics, c)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	analytics := &cloudapi.Analytics{
+		Modules:         map[string]interface{}{},
+		Fields:          map[string]interface{}{},
+		Types:           map[string]interface{}{},
+		Metrics:         map[string]interface{}{},
+		Transformations: map[string]interface{}{},
+	}
+	for name, t := range analyticsTransformations {
+		analytics.Transformations[name] = map[string]interface{}{"label": t.label, "fields": copyStrings(t.fields)}
+	}
+	for name, label := range analyticsModules {
+		analytics.Modules[name] = map[string]interface{}{"label": label}
+	}
+	for name, field := range analyticsFields {
+		analytics.Fields[name] = map[string]interface{}{"label": field.label, "type": field.typ}
+	}
+	for name, typ := range analyticsTypes {
+		t := map[string]interface{}{"arity": typ.arity}
+		if typ.unit != "" {
+			t["unit"] = typ.unit
+		}
+		analytics.Types[name] = t
+	}
+	for _, m := range analyticsMetrics {
+		stats, ok := analytics.Metrics[m.module].(map[string]interface{})
+		if !ok {
+			stats = map[string]interface{}{}
+			analytics.Metrics[m.module] = stats
+		}
+		stats[m.stat] = map[string]interface{}{
+			"label":    m.label,
+			"type":     m.typ,
+			"interval": m.interval,
+			"fields":   copyStrings(m.fields),
+		}
+	}
+
+	return analytics, nil
+}
+
+// getInstrumentation finds an instrumentation by ID. The caller must hold c.mu.
+func (c *CloudAPI) getInstrumentation(instrumentationID string) (*instrumentation, error) {
+	for _, inst := range c.instrumentations {
+		if inst.Id == instrumentationID {
+			return inst, nil
+		}
+	}
+
+	return nil, notFoundError("Instrumentation %s not found", instrumentationID)
+}
+
+// copyInstrumentation returns a deep copy of the given instrumentation
+func copyInstrumentation(inst *cloudapi.Instrumentation) cloudapi.Instrumentation {
+	out := *inst
+	out.Decomposition = copyStrings(inst.Decomposition)
+	out.Transformations = copyStrings(inst.Transformations)
+	if inst.Uris != nil {
+		out.Uris = append([]cloudapi.Uri(nil), inst.Uris...)
+	}
+	return out
+}
+
+// ListInstrumentations returns all instrumentations in the double
+func (c *CloudAPI) ListInstrumentations() (result []cloudapi.Instrumentation, err error) {
+	call, err := c.StartCall(HookListInstrumentations, c)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	out := make([]cloudapi.Instrumentation, len(c.instrumentations))
+	for i, inst := range c.instrumentations {
+		out[i] = copyInstrumentation(&inst.Instrumentation)
+	}
+
+	return out, nil
+}
+
+// GetInstrumentation returns a single instrumentation by ID
+func (c *CloudAPI) GetInstrumentation(instrumentationID string) (result *cloudapi.Instrumentation, err error) {
+	call, err := c.StartCall(HookGetInstrumentation, c, instrumentationID)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	inst, err := c.getInstrumentation(instrumentationID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := copyInstrumentation(&inst.Instrumentation)
+	return &out, nil
+}
+
+// CreateInstrumentation creates a new instrumentation, or clones an existing
+// one when opts.Clone is set. Decomposition is a comma separated list of at
+// most one discrete and one numeric field of the metric.
+func (c *CloudAPI) CreateInstrumentation(opts cloudapi.CreateInstrumentationOpts) (result *cloudapi.Instrumentation, err error) {
+	call, err := c.StartCall(HookCreateInstrumentation, c, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if opts.Clone != 0 {
+		source, err := c.getInstrumentation(strconv.Itoa(opts.Clone))
+		if err != nil {
+			return nil, err
+		}
+		opts.Module = source.Module
+		opts.Stat = source.Stat
+		opts.Predicate = source.Predicate
+		opts.Decomposition = strings.Join(source.Decomposition, ",")
+		opts.Granularity = source.Granularity
+		opts.RetentionTime = source.RetentionTime
+		opts.PersistData = source.PersistData
+		opts.IdleMax = source.IdleMax
+	}
+
+	metric, ok := findMetric(opts.Module, opts.Stat)
+	if !ok {
+		return nil, invalidArgumentError("Unknown metric %s.%s", opts.Module, opts.Stat)
+	}
+
+	inst := &instrumentation{metric: metric}
+	decomposition := []string{}
+	if opts.Decomposition != "" {
+		for _, field := range strings.Split(opts.Decomposition, ",") {
+			field = strings.TrimSpace(field)
+			if !contains(metric.fields, field) {
+				return nil, invalidArgumentError("Metric %s.%s cannot be decomposed by %s", metric.module, metric.stat, field)
+			}
+			target := &inst.discrete
+			if analyticsTypes[analyticsFields[field].typ].arity == "numeric" {
+				target = &inst.numeric
+			}
+			if *target != "" {
+				return nil, invalidArgumentError("Cannot decompose by both %s and %s", *target, field)
+			}
+			*target = field
+			decomposition = append(decomposition, field)
+		}
+	}
+
+	if opts.Granularity <= 0 {
+		opts.Granularity = defaultGranularity
+	}
+	if opts.RetentionTime <= 0 {
+		opts.RetentionTime = defaultRetentionTime
+	}
+	if opts.RetentionTime < opts.Granularity {
+		return nil, invalidArgumentError("Retention time %d is shorter than granularity %d", opts.RetentionTime, opts.Granularity)
+	}
+	if opts.IdleMax <= 0 {
+		opts.IdleMax = defaultIdleMax
+	}
+	if opts.Predicate == "" {
+		opts.Predicate = "{}"
+	}
+
+	c.instrumentationSeq++
+	id := strconv.Itoa(c.instrumentationSeq)
+	base := fmt.Sprintf("/%s/analytics/instrumentations/%s", c.ServiceInstance.UserAccount, id)
+
+	inst.Instrumentation = cloudapi.Instrumentation{
+		Id:              id,
+		Module:          metric.module,
+		Stat:            metric.stat,
+		Predicate:       opts.Predicate,
+		Decomposition:   decomposition,
+		ValueDimension:  len(decomposition) + 1,
+		ValueArity:      "scalar",
+		RetentionTime:   opts.RetentionTime,
+		Granularity:     opts.Granularity,
+		IdleMax:         opts.IdleMax,
+		Transformations: []string{},
+		PersistData:     opts.PersistData,
+		Crtime:          int(c.now().UnixNano() / int64(time.Millisecond)),
+		ValueScope:      metric.interval,
+		Uris:            []cloudapi.Uri{{Uri: base + "/value/raw", Name: "value_raw"}},
+	}
+	switch {
+	case inst.numeric != "":
+		inst.ValueArity = "numeric-decomposition"
+		inst.Uris = append(inst.Uris,
+			cloudapi.Uri{Uri: base + "/value/heatmap/image", Name: "value_heatmap"},
+			cloudapi.Uri{Uri: base + "/value/heatmap/details", Name: "details_heatmap"})
+	case inst.discrete != "":
+		inst.ValueArity = "discrete-decomposition"
+	}
+
+	c.instrumentations = append(c.instrumentations, inst)
+
+	out := copyInstrumentation(&inst.Instrumentation)
+	return &out, nil
+}
+
+// DeleteInstrumentation deletes an instrumentation and its data
+func (c *CloudAPI) DeleteInstrumentation(instrumentationID string) (err error) {
+	call, err := c.StartCall(HookDeleteInstrumentation, c, instrumentationID)
+	if err != nil {
+		return err
+	}
+	defer c.ProcessAfterHook(call, c, nil, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, inst := range c.instrumentations {
+		if inst.Id == instrumentationID {
+			c.instrumentations = append(c.instrumentations[:i], c.instrumentations[i+1:]...)
+			return nil
+		}
+	}
+
+	return notFoundError("Instrumentation %s not found", instrumentationID)
+}
+
+// GetInstrumentationValue returns the value of an instrumentation for the
+// interval starting at startTime (Unix seconds), or for the latest complete
+// interval when startTime is 0. startTime is aligned down to the
+// instrumentation granularity and must be within its retention time.
+//
+// The shape of the value follows the decomposition: a number when there is
+// none, an object keyed by field value for a discrete decomposition, and a
+// list of [[min, max], count] buckets for a numeric one.
+func (c *CloudAPI) GetInstrumentationValue(instrumentationID string, startTime int) (result *cloudapi.InstrumentationValue, err error) {
+	call, err := c.StartCall(HookGetInstrumentationValue, c, instrumentationID, startTime)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	inst, err := c.getInstrumentation(instrumentationID)
+	if err != nil {
+		return nil, err
+	}
+
+	latest := c.latestInterval(inst)
+	if startTime == 0 {
+		startTime = latest
+	}
+	startTime -= startTime % inst.Granularity
+	if startTime > latest || startTime <= latest-inst.RetentionTime {
+		return nil, invalidArgumentError("No data for instrumentation %s at %d", instrumentationID, startTime)
+	}
+
+	transformations := map[string]interface{}{}
+	for _, t := range inst.Transformations {
+		transformations[t] = map[string]interface{}{}
+	}
+
+	return &cloudapi.InstrumentationValue{
+		Value:           c.instrumentationValue(inst, startTime),
+		Transformations: transformations,
+		StartTime:       startTime,
+		Duration:        inst.Granularity,
+	}, nil
+}
+
+// GetInstrumentationHeatmap returns a summary of the heatmap of a numerically
+// decomposed instrumentation over its retention time: the overall time and
+// value range covered by the image, the number of data points in it and,
+// with a discrete decomposition, the number of data points per field value.
+func (c *CloudAPI) GetInstrumentationHeatmap(instrumentationID string, opts cloudapi.HeatmapOpts) (result *cloudapi.Heatmap, err error) {
+	call, err := c.StartCall(HookGetInstrumentationHeatmap, c, instrumentationID, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	inst, err := c.getHeatmapInstrumentation(instrumentationID)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = heatmapDefaults(inst, opts)
+	first, columns := c.heatmapColumns(inst)
+	heatmap := &cloudapi.Heatmap{
+		BucketTime: first,
+		BucketYmin: opts.Ymin,
+		BucketYmax: opts.Ymax,
+		Present:    map[string]interface{}{},
+	}
+	for col := 0; col < columns; col++ {
+		c.fillHeatmapBucket(inst, heatmap, first+col*inst.Granularity)
+	}
+
+	return heatmap, nil
+}
+
+// GetInstrumentationHeatmapDetails returns the bucket of the heatmap of a
+// numerically decomposed instrumentation found at pixel opts.X, opts.Y.
+// The heatmap spans the retention time horizontally, split into columns of
+// one granularity each, and opts.Nbuckets value ranges between opts.Ymin and
+// opts.Ymax vertically, with y growing downwards.
+func (c *CloudAPI) GetInstrumentationHeatmapDetails(instrumentationID string, opts cloudapi.HeatmapOpts) (result *cloudapi.Heatmap, err error) {
+	call, err := c.StartCall(HookGetInstrumentationHeatmapDetails, c, instrumentationID, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	inst, err := c.getHeatmapInstrumentation(instrumentationID)
+	if err != nil {
+		return nil, err
+	}
+
+	opts = heatmapDefaults(inst, opts)
+	if opts.X < 0 || opts.X >= opts.Width || opts.Y < 0 || opts.Y >= opts.Height {
+		return nil, invalidArgumentError("Point (%d, %d) is outside of the %dx%d heatmap", opts.X, opts.Y, opts.Width, opts.Height)
+	}
+
+	first, columns := c.heatmapColumns(inst)
+	bucket := (opts.Height - 1 - opts.Y) * opts.Nbuckets / opts.Height
+	span := opts.Ymax - opts.Ymin
+
+	heatmap := &cloudapi.Heatmap{
+		BucketTime: first + opts.X*columns/opts.Width*inst.Granularity,
+		BucketYmin: opts.Ymin + bucket*span/opts.Nbuckets,
+		BucketYmax: opts.Ymin + (bucket+1)*span/opts.Nbuckets,
+		Present:    map[string]interface{}{},
+	}
+	c.fillHeatmapBucket(inst, heatmap, heatmap.BucketTime)
+
+	return heatmap, nil
+}
+
+// getHeatmapInstrumentation finds an instrumentation that has a heatmap. The
+// caller must hold c.mu.
+func (c *CloudAPI) getHeatmapInstrumentation(instrumentationID string) (*instrumentation, error) {
+	inst, err := c.getInstrumentation(instrumentationID)
+	if err != nil {
+		return nil, err
+	}
+	if inst.numeric == "" {
+		return nil, invalidArgumentError("Instrumentation %s has no numeric decomposition", instrumentationID)
+	}
+
+	return inst, nil
+}
+
+func heatmapDefaults(inst *instrumentation, opts cloudapi.HeatmapOpts) cloudapi.HeatmapOpts {
+	if opts.Width <= 0 {
+		opts.Width = defaultHeatmapWidth
+	}
+	if opts.Height <= 0 {
+		opts.Height = defaultHeatmapHeight
+	}
+	if opts.Nbuckets <= 0 {
+		opts.Nbuckets = defaultHeatmapNbuckets
+	}
+	if opts.Ymax <= opts.Ymin {
+		opts.Ymax = analyticsTypes[analyticsFields[inst.numeric].typ].max
+	}
+	return opts
+}
+
+// latestInterval returns the start of the latest complete interval of an
+// instrumentation. The caller must hold c.mu.
+func (c *CloudAPI) latestInterval(inst *instrumentation) int {
+	now := int(c.now().Unix())
+	return now - now%inst.Granularity - inst.Granularity
+}
+
+// heatmapColumns returns the start of the first interval kept for an
+// instrumentation and the number of intervals kept. The caller must hold c.mu.
+func (c *CloudAPI) heatmapColumns(inst *instrumentation) (int, int) {
+	columns := inst.RetentionTime / inst.Granularity
+	return c.latestInterval(inst) - (columns-1)*inst.Granularity, columns
+}
+
+// fillHeatmapBucket adds the data points of the interval starting at
+// startTime that fall within the bucket's value range. The caller must hold
+// c.mu.
+func (c *CloudAPI) fillHeatmapBucket(inst *instrumentation, heatmap *cloudapi.Heatmap, startTime int) {
+	for _, p := range c.dataPoints(inst, startTime) {
+		if p.value < heatmap.BucketYmin || p.value >= heatmap.BucketYmax {
+			continue
+		}
+		heatmap.Total++
+		if p.key != "" {
+			count, _ := heatmap.Present[p.key].(int)
+			heatmap.Present[p.key] = count + 1
+		}
+	}
+}
+
+// random returns a generator for the given instrumentation and interval that
+// always produces the same sequence for the same analytics seed. The caller
+// must hold c.mu.
+func (c *CloudAPI) random(inst *instrumentation, startTime int) *rand.Rand {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d/%s/%d", c.analyticsSeed, inst.Id, startTime)
+	return rand.New(rand.NewSource(int64(h.Sum64())))
+}
+
+// fieldValues returns the values a discrete field takes in generated data.
+// Zone names are the IDs of the machines in the double, if any. The caller
+// must hold c.mu.
+func (c *CloudAPI) fieldValues(field string) []string {
+	if field == "zonename" && len(c.machines) > 0 {
+		values := make([]string, len(c.machines))
+		for i, m := range c.machines {
+			values[i] = m.Id
+		}
+		return values
+	}
+
+	return []string{field + "-0", field + "-1", field + "-2"}
+}
+
+// dataPoints returns the synthetic observations of a numerically decomposed
+// instrumentation for the interval starting at startTime. The caller must
+// hold c.mu.
+func (c *CloudAPI) dataPoints(inst *instrumentation, startTime int) []dataPoint {
+	r := c.random(inst, startTime)
+	max := analyticsTypes[analyticsFields[inst.numeric].typ].max
+
+	var keys []string
+	if inst.discrete != "" {
+		keys = c.fieldValues(inst.discrete)
+	}
+
+	points := make([]dataPoint, r.Intn(maxDataPoints+1))
+	for i := range points {
+		if keys != nil {
+			points[i].key = keys[r.Intn(len(keys))]
+		}
+		points[i].value = r.Intn(max)
+	}
+
+	return points
+}
+
+// instrumentationValue generates the raw value of an instrumentation for the
+// interval starting at startTime. The caller must hold c.mu.
+func (c *CloudAPI) instrumentationValue(inst *instrumentation, startTime int) interface{} {
+	if inst.numeric != "" {
+		max := analyticsTypes[analyticsFields[inst.numeric].typ].max
+		buckets := map[string][]int{}
+		for _, p := range c.dataPoints(inst, startTime) {
+			if buckets[p.key] == nil {
+				buckets[p.key] = make([]int, rawValueBuckets)
+			}
+			buckets[p.key][p.value*rawValueBuckets/max]++
+		}
+
+		distribution := func(counts []int) []interface{} {
+			out := []interface{}{}
+			for i, count := range counts {
+				if count > 0 {
+					bounds := []int{i * max / rawValueBuckets, (i+1)*max/rawValueBuckets - 1}
+					out = append(out, []interface{}{bounds, count})
+				}
+			}
+			return out
+		}
+
+		if inst.discrete == "" {
+			return distribution(buckets[""])
+		}
+		value := map[string]interface{}{}
+		for key, counts := range buckets {
+			value[key] = distribution(counts)
+		}
+		return value
+	}
+
+	r := c.random(inst, startTime)
+	max := analyticsTypes[inst.metric.typ].max
+	if inst.discrete == "" {
+		return r.Intn(max)
+	}
+
+	value := map[string]interface{}{}
+	for _, key := range c.fieldValues(inst.discrete) {
+		value[key] = r.Intn(max)
+	}
+	return value
+}
@@ -0,0 +1,262 @@
+//
+// gosdc - Go library to interact with the Joyent CloudAPI
+//
+// CloudAPI double testing service - HTTP Signature authentication
+//
+// Copyright (c) Joyent Inc.
+//
+
+package cloudapi
+
+import (
+	"crypto"
+	"crypto/md5"
+	"crypto/rsa"
+	_ "crypto/sha1" // register the hashes signatures may use
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultClockSkew is how far the Date header of a signed request may be
+// from the double's clock.
+const DefaultClockSkew = 300 * time.Second
+
+var signatureHashes = map[string]crypto.Hash{
+	"rsa-sha1":   crypto.SHA1,
+	"rsa-sha256": crypto.SHA256,
+	"rsa-sha384": crypto.SHA384,
+	"rsa-sha512": crypto.SHA512,
+}
+
+// RequireSignatures turns checking of the HTTP Signature on requests served
+// by SetupHTTP on or off. It is off by default. When on, every request must
+// carry a Date header within the clock skew of the double's clock and be
+// signed by a key of the account, added with CreateKey. The key is named by
+// its name or its fingerprint.
+func (c *CloudAPI) RequireSignatures(require bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.requireSignatures = require
+}
+
+// SetClockSkew sets how far the Date header of a signed request may be from
+// the double's clock, DefaultClockSkew by default.
+func (c *CloudAPI) SetClockSkew(skew time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.clockSkew = skew
+}
+
+// authenticate checks the HTTP Signature of the request if signatures are
+// required.
+func (c *CloudAPI) authenticate(r *http.Request) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.requireSignatures {
+		return nil
+	}
+
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return NewError(CodeInvalidCredentials, "Authorization header is missing")
+	}
+	sig, err := parseSignature(header)
+	if err != nil {
+		return NewError(CodeInvalidHeader, "%s", err)
+	}
+
+	date := r.Header.Get("Date")
+	sent, err := parseDate(date)
+	if err != nil {
+		return NewError(CodeInvalidHeader, "Date header is missing or invalid")
+	}
+	if skew := c.now().Sub(sent); skew > c.clockSkew || skew < -c.clockSkew {
+		return NewError(CodeInvalidCredentials, "Date header %s is too far from the server time", date)
+	}
+
+	hash, ok := signatureHashes[strings.ToLower(sig.algorithm)]
+	if !ok {
+		return NewError(CodeInvalidHeader, "Unsupported signature algorithm %s", sig.algorithm)
+	}
+
+	parts := strings.Split(sig.keyID, separator)
+	if len(parts) != 4 || parts[0] != "" || parts[2] != "keys" {
+		return NewError(CodeInvalidCredentials, "Invalid keyId %s", sig.keyID)
+	}
+	if parts[1] != c.UserAccount {
+		return NewError(CodeInvalidCredentials, "Account %s not found", parts[1])
+	}
+	key, err := c.findSigningKey(parts[3])
+	if err != nil {
+		return NewError(CodeInvalidCredentials, "%s", err)
+	}
+
+	signing, err := sig.signingString(r)
+	if err != nil {
+		return NewError(CodeInvalidHeader, "%s", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(sig.signature)
+	if err != nil {
+		return NewError(CodeInvalidCredentials, "Signature is not valid base64")
+	}
+	h := hash.New()
+	h.Write([]byte(signing))
+	if err := rsa.VerifyPKCS1v15(key, hash, h.Sum(nil), signature); err != nil {
+		return NewError(CodeInvalidCredentials, "The signature we calculated does not match the one you sent")
+	}
+
+	return nil
+}
+
+// findSigningKey returns the public half of the account key with the given
+// name or fingerprint. The caller must hold c.mu.
+func (c *CloudAPI) findSigningKey(id string) (*rsa.PublicKey, error) {
+	for _, k := range c.keys {
+		key, fingerprint, err := parseAuthorizedKey(k.Key)
+		if err != nil {
+			continue
+		}
+		if k.Name == id || fingerprint == id {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Key %s not found", id)
+}
+
+// signature is a parsed Authorization header
+type signature struct {
+	keyID     string
+	algorithm string
+	headers   []string // signed headers, nil when the bare Date is signed
+	signature string
+}
+
+// parseSignature parses an Authorization header. Both the CloudAPI form,
+// with the signature following the parameters, and the HTTP Signatures form,
+// with a signature parameter, are understood.
+func parseSignature(header string) (*signature, error) {
+	if !strings.HasPrefix(header, "Signature ") {
+		return nil, fmt.Errorf("Authorization scheme must be Signature")
+	}
+	rest := strings.TrimSpace(strings.TrimPrefix(header, "Signature "))
+
+	params := map[string]string{}
+	for rest != "" {
+		eq := strings.Index(rest, "=\"")
+		if eq < 0 || strings.ContainsAny(rest[:eq], " ,") {
+			break
+		}
+		end := strings.Index(rest[eq+2:], "\"")
+		if end < 0 {
+			return nil, fmt.Errorf("Authorization header is malformed")
+		}
+		params[rest[:eq]] = rest[eq+2 : eq+2+end]
+		rest = strings.TrimLeft(rest[eq+3+end:], ", ")
+	}
+
+	sig := &signature{
+		keyID:     params["keyId"],
+		algorithm: params["algorithm"],
+		signature: params["signature"],
+	}
+	if sig.signature == "" {
+		sig.signature = rest
+	} else if h, ok := params["headers"]; ok {
+		sig.headers = strings.Fields(strings.ToLower(h))
+	} else {
+		sig.headers = []string{"date"}
+	}
+	if sig.keyID == "" || sig.algorithm == "" || sig.signature == "" {
+		return nil, fmt.Errorf("Authorization header must have a keyId, an algorithm and a signature")
+	}
+
+	return sig, nil
+}
+
+// signingString returns the string the client should have signed
+func (s *signature) signingString(r *http.Request) (string, error) {
+	if s.headers == nil {
+		return r.Header.Get("Date"), nil
+	}
+
+	lines := make([]string, len(s.headers))
+	for i, h := range s.headers {
+		switch h {
+		case "(request-target)":
+			lines[i] = h + ": " + strings.ToLower(r.Method) + " " + r.URL.RequestURI()
+		case "request-line":
+			lines[i] = r.Method + " " + r.URL.RequestURI() + " " + r.Proto
+		default:
+			v := r.Header.Get(h)
+			if h == "host" && v == "" {
+				v = r.Host
+			}
+			if v == "" {
+				return "", fmt.Errorf("Signed header %s is missing", h)
+			}
+			lines[i] = h + ": " + v
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+func parseDate(date string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC1123, date); err == nil {
+		return t, nil
+	}
+	return http.ParseTime(date)
+}
+
+// parseAuthorizedKey parses an OpenSSH authorized_keys RSA public key and
+// returns it along with its MD5 fingerprint.
+func parseAuthorizedKey(authorized string) (*rsa.PublicKey, string, error) {
+	fields := strings.Fields(authorized)
+	if len(fields) < 2 || fields[0] != "ssh-rsa" {
+		return nil, "", fmt.Errorf("Key is not an ssh-rsa key")
+	}
+	wire, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, "", fmt.Errorf("Key is not valid base64")
+	}
+
+	var parts [3][]byte
+	rest := wire
+	for i := range parts {
+		if len(rest) < 4 {
+			return nil, "", fmt.Errorf("Key is truncated")
+		}
+		n := binary.BigEndian.Uint32(rest)
+		if uint32(len(rest)-4) < n {
+			return nil, "", fmt.Errorf("Key is truncated")
+		}
+		parts[i], rest = rest[4:4+n], rest[4+n:]
+	}
+	if string(parts[0]) != "ssh-rsa" {
+		return nil, "", fmt.Errorf("Key is not an ssh-rsa key")
+	}
+	e := new(big.Int).SetBytes(parts[1])
+	if !e.IsInt64() || e.Int64() > 1<<31-1 {
+		return nil, "", fmt.Errorf("Key exponent is too large")
+	}
+
+	sum := md5.Sum(wire)
+	hexes := make([]string, len(sum))
+	for i, b := range sum {
+		hexes[i] = fmt.Sprintf("%02x", b)
+	}
+
+	key := &rsa.PublicKey{N: new(big.Int).SetBytes(parts[2]), E: int(e.Int64())}
+	return key, strings.Join(hexes, ":"), nil
+}
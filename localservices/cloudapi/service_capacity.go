@@ -0,0 +1,254 @@
+//
+// gosdc - Go library to interact with the Joyent CloudAPI
+//
+// CloudAPI double testing service - account limits and compute capacity
+//
+// Copyright (c) Joyent Inc.
+//
+
+package cloudapi
+
+import (
+	"github.com/joyent/gosdc/localservices"
+)
+
+// Limits are the provisioning limits of the account. A zero limit does not
+// constrain the account. Memory and Disk are in MiB, as in packages, and are
+// counted from the packages of the machines of the account.
+type Limits struct {
+	Machines int `json:"machines,omitempty"`
+	Memory   int `json:"memory,omitempty"`
+	Disk     int `json:"disk,omitempty"`
+}
+
+// ComputeNode is a simulated server machines are provisioned on. Memory and
+// Disk are its capacity in MiB.
+type ComputeNode struct {
+	Id     string `json:"id"`
+	Memory int    `json:"memory"`
+	Disk   int    `json:"disk"`
+}
+
+// NodeUsage is what the machines placed on a compute node use of it
+type NodeUsage struct {
+	ComputeNode
+	Machines   []string `json:"machines"`
+	UsedMemory int      `json:"used_memory"`
+	UsedDisk   int      `json:"used_disk"`
+}
+
+// validate checks that limits can be set
+func (l Limits) validate() error {
+	if l.Machines < 0 || l.Memory < 0 || l.Disk < 0 {
+		return invalidArgumentError("Limits must not be negative")
+	}
+	return nil
+}
+
+// quotaExceededError is the error CloudAPI returns for a request going over
+// the limits of the account
+func quotaExceededError() *Error {
+	return NewError(CodeQuotaExceeded, "Quota exceeded; to have your limits raised please contact Support")
+}
+
+// insufficientCapacityError is the error a provisioning fails with when no
+// compute node has room for the machine
+func insufficientCapacityError() *Error {
+	return NewError(CodeInsufficientCapacity, "There isn't enough capacity in this datacenter")
+}
+
+// SetLimits sets the provisioning limits of the account. Machines already
+// over the new limits are kept.
+func (c *CloudAPI) SetLimits(limits Limits) error {
+	if err := limits.validate(); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.limits = limits
+	return nil
+}
+
+// Limits returns the provisioning limits of the account
+func (c *CloudAPI) Limits() Limits {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.limits
+}
+
+// SetComputeNodes sets the compute nodes new machines are placed on, in the
+// order they are tried. Nodes given without an ID get one. With no compute
+// nodes, the default, capacity is unlimited and machines are not placed.
+//
+// The compute nodes are shared by all the accounts of the double. Machines
+// already placed on a node stay there, and only count against the nodes they
+// are on.
+func (c *CloudAPI) SetComputeNodes(nodes []ComputeNode) error {
+	pool, err := newComputeNodes(nodes)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.computeNodes = pool
+	return nil
+}
+
+// newComputeNodes checks the given compute nodes and gives IDs to those
+// without one
+func newComputeNodes(nodes []ComputeNode) ([]ComputeNode, error) {
+	pool := make([]ComputeNode, 0, len(nodes))
+	ids := map[string]bool{}
+	for _, node := range nodes {
+		if node.Id == "" {
+			id, err := localservices.NewUUID()
+			if err != nil {
+				return nil, err
+			}
+			node.Id = id
+		}
+		if ids[node.Id] {
+			return nil, invalidArgumentError("Compute node %s is given twice", node.Id)
+		}
+		if node.Memory <= 0 || node.Disk <= 0 {
+			return nil, invalidArgumentError("Compute node %s has no memory or disk", node.Id)
+		}
+		ids[node.Id] = true
+		pool = append(pool, node)
+	}
+	return pool, nil
+}
+
+// ComputeNodes returns the compute nodes of the double
+func (c *CloudAPI) ComputeNodes() []ComputeNode {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return append([]ComputeNode{}, c.computeNodes...)
+}
+
+// NodeUsage returns the compute nodes of the double along with the machines
+// of all accounts placed on them and the memory and disk those use
+func (c *CloudAPI) NodeUsage() []NodeUsage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.settleAll()
+
+	usage := []NodeUsage{}
+	for _, node := range c.computeNodes {
+		u := NodeUsage{ComputeNode: node, Machines: []string{}}
+		for _, m := range c.allMachines() {
+			if placedOn(m, node.Id) {
+				u.Machines = append(u.Machines, m.Id)
+				u.UsedMemory += m.Memory
+				u.UsedDisk += m.Disk
+			}
+		}
+		usage = append(usage, u)
+	}
+	return usage
+}
+
+// ProvisionError returns the error the provisioning of a machine failed
+// with, such as InsufficientCapacity, or nil if it did not fail that way
+func (c *CloudAPI) ProvisionError(machineID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.settle()
+	m, err := c.findMachine(machineID)
+	if err != nil {
+		return err
+	}
+	if m.provisionError == nil {
+		return nil
+	}
+	return m.provisionError
+}
+
+// allMachines returns the machines of all accounts, which share the compute
+// nodes. The caller must hold c.mu.
+func (c *CloudAPI) allMachines() []*machine {
+	var machines []*machine
+	for _, account := range c.accountList() {
+		machines = append(machines, account.machines...)
+	}
+	return machines
+}
+
+// placedOn reports whether a machine holds capacity on the given compute
+// node. Failed machines hold none. The caller must hold c.mu.
+func placedOn(m *machine, nodeID string) bool {
+	return m.ComputeNode == nodeID && m.State != "failed"
+}
+
+// nodeFree returns the memory and disk left on a compute node. The caller
+// must hold c.mu.
+func (c *CloudAPI) nodeFree(node ComputeNode) (memory, disk int) {
+	memory, disk = node.Memory, node.Disk
+	for _, m := range c.allMachines() {
+		if placedOn(m, node.Id) {
+			memory -= m.Memory
+			disk -= m.Disk
+		}
+	}
+	return memory, disk
+}
+
+// placeMachine returns the first compute node with room for the given
+// memory and disk, or an empty ID when the double has no compute nodes. The
+// caller must hold c.mu.
+func (c *CloudAPI) placeMachine(memory, disk int) (string, *Error) {
+	if len(c.computeNodes) == 0 {
+		return "", nil
+	}
+	for _, node := range c.computeNodes {
+		if freeMemory, freeDisk := c.nodeFree(node); memory <= freeMemory && disk <= freeDisk {
+			return node.Id, nil
+		}
+	}
+	return "", insufficientCapacityError()
+}
+
+// checkResize returns an error if a machine cannot grow to the given memory
+// and disk on its compute node. The caller must hold c.mu.
+func (c *CloudAPI) checkResize(m *machine, memory, disk int) error {
+	for _, node := range c.computeNodes {
+		if !placedOn(m, node.Id) {
+			continue
+		}
+		freeMemory, freeDisk := c.nodeFree(node)
+		if memory-m.Memory > freeMemory || disk-m.Disk > freeDisk {
+			return insufficientCapacityError()
+		}
+	}
+	return nil
+}
+
+// checkLimits returns an error if the account would go over its limits by
+// adding the given machines, memory and disk to those of its machines. Only
+// the limits a request grows against are checked. The caller must hold c.mu.
+func (c *CloudAPI) checkLimits(machines, memory, disk int) error {
+	l := c.limits
+	if l == (Limits{}) {
+		return nil
+	}
+	var usedMachines, usedMemory, usedDisk int
+	for _, m := range c.liveMachines() {
+		usedMachines++
+		usedMemory += m.Memory
+		usedDisk += m.Disk
+	}
+	if (machines > 0 && l.Machines > 0 && usedMachines+machines > l.Machines) ||
+		(memory > 0 && l.Memory > 0 && usedMemory+memory > l.Memory) ||
+		(disk > 0 && l.Disk > 0 && usedDisk+disk > l.Disk) {
+		return quotaExceededError()
+	}
+	return nil
+}
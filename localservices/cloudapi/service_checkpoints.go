@@ -0,0 +1,198 @@
+//
+// gosdc - Go library to interact with the Joyent CloudAPI
+//
+// CloudAPI double testing service - checkpoints
+//
+// Copyright (c) Joyent Inc.
+//
+
+package cloudapi
+
+import (
+	"strconv"
+
+	"github.com/joyent/gosdc/cloudapi"
+)
+
+// AdminRoute is the path under which SetupHTTP serves the endpoints that
+// control the double rather than its account:
+//
+//	POST /_admin/checkpoints                      Checkpoint, returns {"id": ...}
+//	POST /_admin/checkpoints/:id?action=restore   Restore
+//	POST /_admin/reset                            Reset, to the baseline if any
+//	GET /_admin/faults                            Faults
+//	POST /_admin/faults                           AddFault, returns the fault
+//	DELETE /_admin/faults                         ClearFaults
+//	DELETE /_admin/faults/:id                     RemoveFault
+//
+// They are neither authenticated nor subject to faults.
+const AdminRoute = "/_admin"
+
+// Checkpoint saves the resources of every account of the double and returns
+// the ID to restore them with. Configuration such as the accounts, the clock,
+// transitions, hooks, faults and the topology is not part of a checkpoint.
+func (c *CloudAPI) Checkpoint() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checkpointSeq++
+	id := strconv.Itoa(c.checkpointSeq)
+	c.checkpoints[id] = c.saveStates()
+
+	return id
+}
+
+// Restore brings the resources of the double back to the given checkpoint.
+// Accounts added since the checkpoint lose all their resources. A checkpoint
+// can be restored any number of times.
+func (c *CloudAPI) Restore(checkpointID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	saved, ok := c.checkpoints[checkpointID]
+	if !ok {
+		return notFoundError("Checkpoint %s not found", checkpointID)
+	}
+	c.restoreStates(saved)
+
+	return nil
+}
+
+// SetBaseline saves the resources of every account of the double as the
+// baseline Reset brings them back to, such as those loaded from fixtures
+// when the double is set up.
+func (c *CloudAPI) SetBaseline() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.baseline = c.saveStates()
+}
+
+// Reset brings the resources of the double back to the baseline saved by
+// SetBaseline, as Restore does with a checkpoint. Without a baseline, they go
+// back to those of a new double, leaving the accounts other than the primary
+// one empty. Checkpoints are kept.
+func (c *CloudAPI) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.baseline != nil {
+		c.restoreStates(c.baseline)
+		return
+	}
+	for _, account := range c.accounts {
+		account.state = newAccountState()
+	}
+	c.primary.state = newState()
+}
+
+// saveStates returns copies of the states of every account, by login. The
+// caller must hold c.mu.
+func (c *CloudAPI) saveStates() map[string]*state {
+	saved := make(map[string]*state, len(c.accounts))
+	for login, account := range c.accounts {
+		saved[login] = account.state.copy()
+	}
+	return saved
+}
+
+// restoreStates gives every account a copy of its saved state, and accounts
+// added since an empty one. The caller must hold c.mu.
+func (c *CloudAPI) restoreStates(saved map[string]*state) {
+	for login, account := range c.accounts {
+		if s, ok := saved[login]; ok {
+			account.state = *s.copy()
+		} else {
+			account.state = newAccountState()
+		}
+	}
+}
+
+// copy returns a deep copy of the state
+func (s *state) copy() *state {
+	out := &state{
+		keys:               append([]cloudapi.Key(nil), s.keys...),
+		packages:           append([]cloudapi.Package(nil), s.packages...),
+		images:             make([]cloudapi.Image, len(s.images)),
+		networks:           copyNetworks(s.networks),
+		snapshots:          make(map[string][]*snapshot, len(s.snapshots)),
+		fabricVLANs:        make(map[int16]*fabricVLAN, len(s.fabricVLANs)),
+		reservedIPs:        make(map[string]map[string]bool, len(s.reservedIPs)),
+		instrumentationSeq: s.instrumentationSeq,
+	}
+
+	for i, image := range s.images {
+		out.images[i] = copyImage(image)
+	}
+
+	for _, m := range s.machines {
+		out.machines = append(out.machines, copyMachineWrapper(m))
+	}
+
+	for machineID, snapshots := range s.snapshots {
+		copies := make([]*snapshot, len(snapshots))
+		for i, snap := range snapshots {
+			copies[i] = &snapshot{
+				Snapshot: snap.Snapshot,
+				Metadata: copyStringMap(snap.Metadata),
+				Tags:     copyStringMap(snap.Tags),
+			}
+			if snap.pending != nil {
+				t := *snap.pending
+				copies[i].pending = &t
+			}
+		}
+		out.snapshots[machineID] = copies
+	}
+
+	for _, rule := range s.firewallRules {
+		r := *rule
+		out.firewallRules = append(out.firewallRules, &r)
+	}
+
+	for id, vlan := range s.fabricVLANs {
+		v := &fabricVLAN{
+			FabricVLAN: vlan.FabricVLAN,
+			Networks:   make(map[string]*cloudapi.FabricNetwork, len(vlan.Networks)),
+		}
+		for networkID, network := range vlan.Networks {
+			v.Networks[networkID] = copyFabricNetwork(network)
+		}
+		out.fabricVLANs[id] = v
+	}
+
+	for networkID, ips := range s.reservedIPs {
+		out.reservedIPs[networkID] = make(map[string]bool, len(ips))
+		for ip := range ips {
+			out.reservedIPs[networkID][ip] = true
+		}
+	}
+
+	for _, inst := range s.instrumentations {
+		i := *inst
+		i.Instrumentation = copyInstrumentation(&inst.Instrumentation)
+		out.instrumentations = append(out.instrumentations, &i)
+	}
+
+	return out
+}
+
+// copyMachineWrapper returns a deep copy of a machine of the double,
+// including the action in progress
+func copyMachineWrapper(m *machine) *machine {
+	out := &machine{
+		Machine:     *copyMachine(&m.Machine),
+		NICs:        make(map[string]*cloudapi.NIC, len(m.NICs)),
+		NetworkNICs: copyStringMap(m.NetworkNICs),
+
+		provisionError: m.provisionError,
+	}
+	for mac, nic := range m.NICs {
+		out.NICs[mac] = copyNIC(nic)
+	}
+	if m.pending != nil {
+		t := *m.pending
+		out.pending = &t
+	}
+	return out
+}
@@ -0,0 +1,94 @@
+package cloudapi
+
+import (
+	"strings"
+)
+
+// DefaultDatacenter is the name a new double knows itself by until it is
+// given another topology.
+const DefaultDatacenter = "us-west-1"
+
+// SetDatacenters replaces the datacenters known to the double. Datacenters
+// map names to CloudAPI URLs.
+func (c *CloudAPI) SetDatacenters(datacenters map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.datacenters = copyStringMap(datacenters)
+}
+
+// SetServices replaces the services listed by the double. Services map names
+// to URLs.
+func (c *CloudAPI) SetServices(services map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.services = copyStringMap(services)
+}
+
+// JoinRegion makes the given doubles, keyed by datacenter name, one region:
+// each of them lists all the others as datacenters, and redirects to them from
+// GetDatacenter. The doubles must be served from the URLs they were created
+// with.
+func JoinRegion(datacenters map[string]*CloudAPI) {
+	region := make(map[string]string, len(datacenters))
+	for name, dc := range datacenters {
+		region[name] = dc.serviceURL
+	}
+
+	for _, dc := range datacenters {
+		dc.SetDatacenters(region)
+	}
+}
+
+// ListDatacenters returns the datacenters known to the double, keyed by name
+func (c *CloudAPI) ListDatacenters() (result map[string]string, err error) {
+	call, err := c.StartCall(HookListDatacenters, c)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return copyStringMap(c.datacenters), nil
+}
+
+// GetDatacenter returns the URL of the named datacenter
+func (c *CloudAPI) GetDatacenter(name string) (result string, err error) {
+	call, err := c.StartCall(HookGetDatacenter, c, name)
+	if err != nil {
+		return "", err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	url, ok := c.datacenters[name]
+	if !ok {
+		return "", notFoundError("Datacenter %s not found", name)
+	}
+
+	return url, nil
+}
+
+// ListServices returns the services known to the double, keyed by name
+func (c *CloudAPI) ListServices() (result map[string]string, err error) {
+	call, err := c.StartCall(HookListServices, c)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return copyStringMap(c.services), nil
+}
+
+// trimURL returns the service URL without a trailing separator
+func trimURL(serviceURL string) string {
+	return strings.TrimSuffix(serviceURL, separator)
+}
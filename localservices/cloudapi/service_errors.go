@@ -0,0 +1,137 @@
+//
+// gosdc - Go library to interact with the Joyent CloudAPI
+//
+// CloudAPI double testing service - error model
+//
+// Copyright (c) Joyent Inc.
+//
+
+package cloudapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// CloudAPI error codes, see https://apidocs.joyent.com/cloudapi/#error-responses
+const (
+	CodeBadMethod            = "BadMethod"
+	CodeBadRequest           = "BadRequest"
+	CodeInternalError        = "InternalError"
+	CodeInUseError           = "InUseError"
+	CodeInsufficientCapacity = "InsufficientCapacity"
+	CodeInvalidArgument      = "InvalidArgument"
+	CodeInvalidContent       = "InvalidContent"
+	CodeInvalidCredentials   = "InvalidCredentials"
+	CodeInvalidHeader        = "InvalidHeader"
+	CodeInvalidVersion       = "InvalidVersion"
+	CodeMissingParameter     = "MissingParameter"
+	CodeNotAuthorized        = "NotAuthorized"
+	CodeQuotaExceeded        = "QuotaExceeded"
+	CodeRequestThrottled     = "RequestThrottled"
+	CodeRequestTooLarge      = "RequestTooLarge"
+	CodeRequestMoved         = "RequestMoved"
+	CodeResourceNotFound     = "ResourceNotFound"
+	CodeServiceUnavailable   = "ServiceUnavailable"
+	CodeSubnetFull           = "SubnetFull"
+	CodeUnknownError         = "UnknownError"
+)
+
+var errorStatuses = map[string]int{
+	CodeBadMethod:            http.StatusMethodNotAllowed,
+	CodeBadRequest:           http.StatusBadRequest,
+	CodeInternalError:        http.StatusInternalServerError,
+	CodeInUseError:           http.StatusConflict,
+	CodeInsufficientCapacity: http.StatusServiceUnavailable,
+	CodeInvalidArgument:      http.StatusConflict,
+	CodeInvalidContent:       http.StatusBadRequest,
+	CodeInvalidCredentials:   http.StatusUnauthorized,
+	CodeInvalidHeader:        http.StatusBadRequest,
+	CodeInvalidVersion:       http.StatusBadRequest,
+	CodeMissingParameter:     http.StatusConflict,
+	CodeNotAuthorized:        http.StatusForbidden,
+	CodeQuotaExceeded:        http.StatusForbidden,
+	CodeRequestThrottled:     http.StatusTooManyRequests,
+	CodeRequestTooLarge:      http.StatusRequestEntityTooLarge,
+	CodeRequestMoved:         http.StatusMovedPermanently,
+	CodeResourceNotFound:     http.StatusNotFound,
+	CodeServiceUnavailable:   http.StatusServiceUnavailable,
+	CodeSubnetFull:           http.StatusConflict,
+	CodeUnknownError:         http.StatusInternalServerError,
+}
+
+// Error is an error returned by the double. Over HTTP it is sent with the
+// status CloudAPI uses for its code and a {"code","message"} body.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// NewError returns an Error with the given CloudAPI code
+func NewError(code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// StatusCode returns the HTTP status CloudAPI responds with for the error.
+// Unknown codes map to 500.
+func (e *Error) StatusCode() int {
+	if status, ok := errorStatuses[e.Code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+func (e *Error) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sendJSON(e.StatusCode(), e, w, r)
+}
+
+// ErrorCode returns the CloudAPI code of an error returned by the double,
+// InternalError for errors of other kinds.
+func ErrorCode(err error) string {
+	if e, ok := err.(*Error); ok {
+		return e.Code
+	}
+	return CodeInternalError
+}
+
+func notFoundError(format string, args ...interface{}) *Error {
+	return NewError(CodeResourceNotFound, format, args...)
+}
+
+func conflictError(format string, args ...interface{}) *Error {
+	return NewError(CodeInUseError, format, args...)
+}
+
+func invalidArgumentError(format string, args ...interface{}) *Error {
+	return NewError(CodeInvalidArgument, format, args...)
+}
+
+// stateError reports an action that the resource is not in a state to take
+func stateError(format string, args ...interface{}) *Error {
+	return NewError(CodeInvalidArgument, format, args...)
+}
+
+// asInvalidArgument turns a lookup of a resource named in a request into an
+// invalid argument of that request
+func asInvalidArgument(err error) error {
+	if e, ok := err.(*Error); ok && e.Code == CodeResourceNotFound {
+		return invalidArgumentError("%s", e.Message)
+	}
+	return err
+}
+
+// toHTTPError returns the response sent for an error returned by a handler
+func toHTTPError(err error) http.Handler {
+	switch e := err.(type) {
+	case http.Handler:
+		return e
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return NewError(CodeInvalidContent, "Invalid JSON: %s", err)
+	}
+	return NewError(CodeInternalError, "%s", err)
+}
@@ -1,24 +1,52 @@
 package cloudapi
 
 import (
-	"fmt"
 	"math/rand"
+	"net/netip"
+	"strings"
 
 	"github.com/joyent/gosdc/cloudapi"
 	"github.com/joyent/gosdc/localservices"
 )
 
+// validationError returns the error the double rejects a request with when
+// the validation of its options fails, with the first line of the message of
+// the validation error, which leaves out its cause
+func validationError(err error) *Error {
+	return invalidArgumentError("%s", strings.SplitN(err.Error(), "\n", 2)[0])
+}
+
+// checkFabric returns an error for a fabric other than the one of the
+// account. The double only has the default fabric: the VLANs of an account
+// are all on it, and requests about any other fabric are not found.
+func checkFabric(fabric string) error {
+	if fabric != cloudapi.DefaultFabric {
+		return notFoundError("Fabric %s not found", fabric)
+	}
+	return nil
+}
+
+// getFabricWrapper finds a VLAN by ID. The caller must hold c.mu.
 func (c *CloudAPI) getFabricWrapper(vlanID int16) (*fabricVLAN, error) {
 	vlan, present := c.fabricVLANs[vlanID]
 	if !present {
-		return nil, fmt.Errorf("VLAN %d not found", vlanID)
+		return nil, notFoundError("VLAN %d not found", vlanID)
 	}
 
 	return vlan, nil
 }
 
 // ListFabricVLANs lists VLANs
-func (c *CloudAPI) ListFabricVLANs() ([]cloudapi.FabricVLAN, error) {
+func (c *CloudAPI) ListFabricVLANs() (result []cloudapi.FabricVLAN, err error) {
+	call, err := c.StartCall(HookListFabricVLANs, c)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	out := []cloudapi.FabricVLAN{}
 	for _, vlan := range c.fabricVLANs {
 		out = append(out, vlan.FabricVLAN)
@@ -28,18 +56,52 @@ func (c *CloudAPI) ListFabricVLANs() ([]cloudapi.FabricVLAN, error) {
 }
 
 // GetFabricVLAN retrieves a single VLAN by ID
-func (c *CloudAPI) GetFabricVLAN(vlanID int16) (*cloudapi.FabricVLAN, error) {
+func (c *CloudAPI) GetFabricVLAN(vlanID int16) (result *cloudapi.FabricVLAN, err error) {
+	call, err := c.StartCall(HookGetFabricVLAN, c, vlanID)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	vlan, err := c.getFabricWrapper(vlanID)
 	if err != nil {
 		return nil, err
 	}
 
-	return &vlan.FabricVLAN, nil
+	out := vlan.FabricVLAN
+	return &out, nil
 }
 
-// CreateFabricVLAN creates a new VLAN with the specified options
-func (c *CloudAPI) CreateFabricVLAN(vlan cloudapi.FabricVLAN) (*cloudapi.FabricVLAN, error) {
-	id := int16(rand.Intn(4095 + 1))
+// CreateFabricVLAN creates a new VLAN with the specified options, which are
+// checked as by FabricVLAN.Validate. A VLAN given with ID 0 gets a free ID.
+func (c *CloudAPI) CreateFabricVLAN(vlan cloudapi.FabricVLAN) (result *cloudapi.FabricVLAN, err error) {
+	call, err := c.StartCall(HookCreateFabricVLAN, c, vlan)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	if err := vlan.Validate(); err != nil {
+		return nil, validationError(err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.checkVLANName(vlan.Name, -1); err != nil {
+		return nil, err
+	}
+	id := vlan.Id
+	if id == 0 {
+		if id, err = c.freeVLANID(); err != nil {
+			return nil, err
+		}
+	} else if _, present := c.fabricVLANs[id]; present {
+		return nil, conflictError("VLAN %d already exists", id)
+	}
 	vlan.Id = id
 
 	c.fabricVLANs[id] = &fabricVLAN{
@@ -51,23 +113,86 @@ func (c *CloudAPI) CreateFabricVLAN(vlan cloudapi.FabricVLAN) (*cloudapi.FabricV
 }
 
 // UpdateFabricVLAN updates a given VLAN with new fields
-func (c *CloudAPI) UpdateFabricVLAN(new cloudapi.FabricVLAN) (*cloudapi.FabricVLAN, error) {
-	current, err := c.GetFabricVLAN(new.Id)
+func (c *CloudAPI) UpdateFabricVLAN(new cloudapi.FabricVLAN) (result *cloudapi.FabricVLAN, err error) {
+	call, err := c.StartCall(HookUpdateFabricVLAN, c, new)
 	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	if err := new.Validate(); err != nil {
+		return nil, validationError(err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	current, err := c.getFabricWrapper(new.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkVLANName(new.Name, new.Id); err != nil {
+		return nil, err
+	}
 
 	current.Name = new.Name
 	current.Description = new.Description
 
-	return current, nil
+	out := current.FabricVLAN
+	return &out, nil
+}
+
+// freeVLANID returns a VLAN ID no VLAN has. The caller must hold c.mu.
+func (c *CloudAPI) freeVLANID() (int16, error) {
+	if id := int16(rand.Intn(cloudapi.MaxVLANID) + 1); c.fabricVLANs[id] == nil {
+		return id, nil
+	}
+	for id := int16(1); id <= cloudapi.MaxVLANID; id++ {
+		if c.fabricVLANs[id] == nil {
+			return id, nil
+		}
+	}
+	return 0, conflictError("No VLAN ID is free")
+}
+
+// checkVLANName returns an error if a VLAN other than the given one already
+// has the name. The caller must hold c.mu.
+func (c *CloudAPI) checkVLANName(name string, vlanID int16) error {
+	for id, vlan := range c.fabricVLANs {
+		if id != vlanID && vlan.Name == name {
+			return conflictError("VLAN %s already exists", name)
+		}
+	}
+	return nil
+}
+
+// checkFabricNetworkName returns an error if a fabric network other than the
+// given one already has the name. The caller must hold c.mu.
+func (c *CloudAPI) checkFabricNetworkName(name, networkID string) error {
+	for _, vlan := range c.fabricVLANs {
+		for id, network := range vlan.Networks {
+			if id != networkID && network.Name == name {
+				return conflictError("Network %s already exists", name)
+			}
+		}
+	}
+	return nil
 }
 
 // DeleteFabricVLAN delets a given VLAN as specified by ID
-func (c *CloudAPI) DeleteFabricVLAN(vlanID int16) error {
+func (c *CloudAPI) DeleteFabricVLAN(vlanID int16) (err error) {
+	call, err := c.StartCall(HookDeleteFabricVLAN, c, vlanID)
+	if err != nil {
+		return err
+	}
+	defer c.ProcessAfterHook(call, c, nil, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	_, present := c.fabricVLANs[vlanID]
 	if !present {
-		return fmt.Errorf("VLAN %d not found", vlanID)
+		return notFoundError("VLAN %d not found", vlanID)
 	}
 
 	delete(c.fabricVLANs, vlanID)
@@ -75,7 +200,16 @@ func (c *CloudAPI) DeleteFabricVLAN(vlanID int16) error {
 }
 
 // ListFabricNetworks lists the networks inside the given VLAN
-func (c *CloudAPI) ListFabricNetworks(vlanID int16) ([]cloudapi.FabricNetwork, error) {
+func (c *CloudAPI) ListFabricNetworks(vlanID int16) (result []cloudapi.FabricNetwork, err error) {
+	call, err := c.StartCall(HookListFabricNetworks, c, vlanID)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	vlan, err := c.getFabricWrapper(vlanID)
 	if err != nil {
 		return nil, err
@@ -83,14 +217,23 @@ func (c *CloudAPI) ListFabricNetworks(vlanID int16) ([]cloudapi.FabricNetwork, e
 
 	out := []cloudapi.FabricNetwork{}
 	for _, network := range vlan.Networks {
-		out = append(out, *network)
+		out = append(out, *copyFabricNetwork(network))
 	}
 
 	return out, nil
 }
 
 // GetFabricNetwork gets a single network by VLAN and Network IDs
-func (c *CloudAPI) GetFabricNetwork(vlanID int16, networkID string) (*cloudapi.FabricNetwork, error) {
+func (c *CloudAPI) GetFabricNetwork(vlanID int16, networkID string) (result *cloudapi.FabricNetwork, err error) {
+	call, err := c.StartCall(HookGetFabricNetwork, c, vlanID, networkID)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	vlan, err := c.getFabricWrapper(vlanID)
 	if err != nil {
 		return nil, err
@@ -98,23 +241,44 @@ func (c *CloudAPI) GetFabricNetwork(vlanID int16, networkID string) (*cloudapi.F
 
 	network, present := vlan.Networks[networkID]
 	if !present {
-		return nil, fmt.Errorf("Network %s not found", networkID)
+		return nil, notFoundError("Network %s not found", networkID)
 	}
 
-	return network, nil
+	return copyFabricNetwork(network), nil
 }
 
-// CreateFabricNetwork creates a new fabric network
-func (c *CloudAPI) CreateFabricNetwork(vlanID int16, opts cloudapi.CreateFabricNetworkOpts) (*cloudapi.FabricNetwork, error) {
+// CreateFabricNetwork creates a new fabric network. The options are checked
+// as by CreateFabricNetworkOpts.Validate, against the other networks of the
+// VLAN.
+func (c *CloudAPI) CreateFabricNetwork(vlanID int16, opts cloudapi.CreateFabricNetworkOpts) (result *cloudapi.FabricNetwork, err error) {
+	call, err := c.StartCall(HookCreateFabricNetwork, c, vlanID, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
 	id, err := localservices.NewUUID()
 	if err != nil {
 		return nil, err
 	}
 
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	vlan, err := c.getFabricWrapper(vlanID)
 	if err != nil {
 		return nil, err
 	}
+	existing := []cloudapi.FabricNetwork{}
+	for _, network := range vlan.Networks {
+		existing = append(existing, *network)
+	}
+	if err := opts.Validate(existing...); err != nil {
+		return nil, validationError(err)
+	}
+	if err := c.checkFabricNetworkName(opts.Name, ""); err != nil {
+		return nil, err
+	}
 
 	vlan.Networks[id] = &cloudapi.FabricNetwork{
 		Id:               id,
@@ -126,16 +290,98 @@ func (c *CloudAPI) CreateFabricNetwork(vlanID int16, opts cloudapi.CreateFabricN
 		ProvisionStartIp: opts.ProvisionStartIp,
 		ProvisionEndIp:   opts.ProvisionEndIp,
 		Gateway:          opts.Gateway,
-		Routes:           opts.Routes,
+		Resolvers:        copyStrings(opts.Resolvers),
+		Routes:           copyStringMap(opts.Routes),
 		InternetNAT:      opts.InternetNAT,
 		VLANId:           vlanID,
+
+		Subnet6:           opts.Subnet6,
+		ProvisionStartIp6: opts.ProvisionStartIp6,
+		ProvisionEndIp6:   opts.ProvisionEndIp6,
+		Gateway6:          opts.Gateway6,
 	}
 
-	return vlan.Networks[id], nil
+	return copyFabricNetwork(vlan.Networks[id]), nil
+}
+
+// UpdateFabricNetwork updates the fields of a fabric network given in opts
+func (c *CloudAPI) UpdateFabricNetwork(vlanID int16, networkID string, opts cloudapi.UpdateFabricNetworkOpts) (result *cloudapi.FabricNetwork, err error) {
+	call, err := c.StartCall(HookUpdateFabricNetwork, c, vlanID, networkID, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	vlan, err := c.getFabricWrapper(vlanID)
+	if err != nil {
+		return nil, err
+	}
+	network, present := vlan.Networks[networkID]
+	if !present {
+		return nil, notFoundError("Network %s not found", networkID)
+	}
+
+	if opts.Name != "" {
+		if err := c.checkFabricNetworkName(opts.Name, networkID); err != nil {
+			return nil, err
+		}
+	}
+	ranges, err := c.networkRanges(networkID)
+	if err != nil {
+		return nil, err
+	}
+	for i, g := range []struct{ gateway, subnet string }{{opts.Gateway, network.Subnet}, {opts.Gateway6, network.Subnet6}} {
+		if g.gateway == "" {
+			continue
+		}
+		if i >= len(ranges) {
+			return nil, invalidArgumentError("Network %s has no IPv6 subnet for gateway %s", networkID, g.gateway)
+		}
+		gateway, err := netip.ParseAddr(g.gateway)
+		if err != nil || !ranges[i].prefix.Contains(gateway) {
+			return nil, invalidArgumentError("Gateway %s is not in subnet %s", g.gateway, g.subnet)
+		}
+		if ip := c.networkIPs(ranges[i])[gateway]; ip != nil && ip.BelongsToUUID != "" {
+			return nil, conflictError("Gateway %s is in use by machine %s", g.gateway, ip.BelongsToUUID)
+		}
+	}
+
+	if opts.Name != "" {
+		network.Name = opts.Name
+	}
+	if opts.Description != nil {
+		network.Description = *opts.Description
+	}
+	if opts.Gateway != "" {
+		network.Gateway = opts.Gateway
+	}
+	if opts.Gateway6 != "" {
+		network.Gateway6 = opts.Gateway6
+	}
+	if opts.Resolvers != nil {
+		network.Resolvers = copyStrings(opts.Resolvers)
+	}
+	if opts.Routes != nil {
+		network.Routes = copyStringMap(opts.Routes)
+	}
+
+	return copyFabricNetwork(network), nil
 }
 
 // DeleteFabricNetwork deletes an existing fabric network
-func (c *CloudAPI) DeleteFabricNetwork(vlanID int16, networkID string) error {
+func (c *CloudAPI) DeleteFabricNetwork(vlanID int16, networkID string) (err error) {
+	call, err := c.StartCall(HookDeleteFabricNetwork, c, vlanID, networkID)
+	if err != nil {
+		return err
+	}
+	defer c.ProcessAfterHook(call, c, nil, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	vlan, err := c.getFabricWrapper(vlanID)
 	if err != nil {
 		return err
@@ -143,9 +389,23 @@ func (c *CloudAPI) DeleteFabricNetwork(vlanID int16, networkID string) error {
 
 	_, present := vlan.Networks[networkID]
 	if !present {
-		return fmt.Errorf("Network %s not found", networkID)
+		return notFoundError("Network %s not found", networkID)
+	}
+	for _, m := range c.machines {
+		for _, network := range m.Networks {
+			if network == networkID {
+				return conflictError("Network %s is in use by machine %s", networkID, m.Id)
+			}
+		}
 	}
 
 	delete(vlan.Networks, networkID)
 	return nil
 }
+
+func copyFabricNetwork(network *cloudapi.FabricNetwork) *cloudapi.FabricNetwork {
+	out := *network
+	out.Resolvers = copyStrings(network.Resolvers)
+	out.Routes = copyStringMap(network.Routes)
+	return &out
+}
@@ -0,0 +1,320 @@
+//
+// gosdc - Go library to interact with the Joyent CloudAPI
+//
+// CloudAPI double testing service - fault injection
+//
+// Copyright (c) Joyent Inc.
+//
+
+package cloudapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joyent/gosdc/localservices/hook"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Fault describes a failure the double injects into the requests it serves
+// over HTTP. A request matches a fault when it matches every criterion the
+// fault sets; the first fault a request matches applies to it.
+//
+// Operations are named after the control points of the double, such as
+// HookCreateMachine or HookStopMachine. A request to act on a machine calls
+// both UpdateMachine and the operation of its action, and matches either.
+type Fault struct {
+	Id string `json:"id,omitempty"`
+
+	Route     string `json:"route,omitempty"`      // path.Match pattern of the request path, such as /tester/machines/*
+	Method    string `json:"method,omitempty"`     // HTTP method
+	Operation string `json:"operation,omitempty"`  // operation of the double the request calls
+	MachineID string `json:"machine_id,omitempty"` // machine the request is about
+
+	Latency  time.Duration `json:"-"`                  // delay before the request is served, or fails
+	Status   int           `json:"status,omitempty"`   // HTTP status of an injected error, by default that of Code
+	Code     string        `json:"code,omitempty"`     // CloudAPI code of an injected error, UnknownError if only Status is set
+	Message  string        `json:"message,omitempty"`  // message of an injected error
+	Drop     bool          `json:"drop,omitempty"`     // close the connection without responding
+	Truncate bool          `json:"truncate,omitempty"` // serve the request but close the connection halfway through the body
+
+	Probability float64 `json:"probability,omitempty"` // chance the fault applies to a matching request, 0 is taken as 1
+	Times       int     `json:"times,omitempty"`       // number of requests the fault applies to before it is removed, 0 for no limit
+}
+
+type faultJSON Fault
+
+// MarshalJSON encodes the latency of a fault as a duration string
+func (f Fault) MarshalJSON() ([]byte, error) {
+	out := struct {
+		faultJSON
+		Latency string `json:"latency,omitempty"`
+	}{faultJSON: faultJSON(f)}
+	if f.Latency != 0 {
+		out.Latency = f.Latency.String()
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes a fault with its latency given as a duration string
+// such as "250ms"
+func (f *Fault) UnmarshalJSON(data []byte) error {
+	in := struct {
+		*faultJSON
+		Latency string `json:"latency"`
+	}{faultJSON: (*faultJSON)(f)}
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	if in.Latency == "" {
+		f.Latency = 0
+		return nil
+	}
+	latency, err := time.ParseDuration(in.Latency)
+	if err != nil {
+		return NewError(CodeInvalidContent, "Invalid fault latency %q", in.Latency)
+	}
+	f.Latency = latency
+	return nil
+}
+
+// validate checks that a fault can be injected
+func (f *Fault) validate() error {
+	if f.Route != "" {
+		if _, err := path.Match(f.Route, "/"); err != nil {
+			return invalidArgumentError("Invalid fault route %q", f.Route)
+		}
+	}
+	if f.Latency < 0 {
+		return invalidArgumentError("Fault latency must not be negative")
+	}
+	if f.Status != 0 && (f.Status < 100 || f.Status > 599) {
+		return invalidArgumentError("Invalid fault status %d", f.Status)
+	}
+	if f.Probability < 0 || f.Probability > 1 {
+		return invalidArgumentError("Fault probability must be between 0 and 1")
+	}
+	if f.Times < 0 {
+		return invalidArgumentError("Fault times must not be negative")
+	}
+	if f.Latency == 0 && !f.failing() && !f.Drop && !f.Truncate {
+		return invalidArgumentError("Fault has no effect")
+	}
+	return nil
+}
+
+// failing reports whether the fault responds with an error
+func (f *Fault) failing() bool {
+	return f.Status != 0 || f.Code != ""
+}
+
+// error returns the error the fault responds with
+func (f *Fault) error() *ErrorResponse {
+	e := &Error{Code: f.Code, Message: f.Message}
+	if e.Code == "" {
+		e.Code = CodeUnknownError
+	}
+	if e.Message == "" {
+		e.Message = "Injected fault"
+	}
+	status := f.Status
+	if status == 0 {
+		status = e.StatusCode()
+	}
+	body, _ := json.Marshal(e)
+	return &ErrorResponse{
+		Code:        status,
+		Body:        string(body),
+		contentType: "application/json",
+		errorText:   e.Message,
+	}
+}
+
+// matches reports whether a request calling the given operations matches the
+// criteria of the fault
+func (f *Fault) matches(r *http.Request, operations []string, machineID string) bool {
+	if f.Route != "" {
+		if ok, _ := path.Match(f.Route, r.URL.Path); !ok {
+			return false
+		}
+	}
+	if f.Method != "" && !strings.EqualFold(f.Method, r.Method) {
+		return false
+	}
+	if f.Operation != "" && !contains(operations, f.Operation) {
+		return false
+	}
+	if f.MachineID != "" && f.MachineID != machineID {
+		return false
+	}
+	return true
+}
+
+// AddFault starts injecting a fault and returns it with its ID
+func (c *CloudAPI) AddFault(fault Fault) (*Fault, error) {
+	if err := fault.validate(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.faultSeq++
+	fault.Id = strconv.Itoa(c.faultSeq)
+	c.faults = append(c.faults, &fault)
+
+	f := fault
+	return &f, nil
+}
+
+// Faults returns the faults being injected, in the order they were added
+func (c *CloudAPI) Faults() []Fault {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	faults := []Fault{}
+	for _, f := range c.faults {
+		faults = append(faults, *f)
+	}
+	return faults
+}
+
+// RemoveFault stops injecting the given fault
+func (c *CloudAPI) RemoveFault(faultID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, f := range c.faults {
+		if f.Id == faultID {
+			c.faults = append(c.faults[:i], c.faults[i+1:]...)
+			return nil
+		}
+	}
+	return notFoundError("Fault %s not found", faultID)
+}
+
+// ClearFaults stops injecting all faults
+func (c *CloudAPI) ClearFaults() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.faults = nil
+}
+
+// SetFaultSeed sets the seed deciding whether faults with a probability
+// apply, so that a sequence of requests fails the same way on every run
+func (c *CloudAPI) SetFaultSeed(seed int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.faultRand = rand.New(rand.NewSource(seed))
+}
+
+// fault returns the fault applying to a request, if any, and counts it
+// against the times the fault applies
+func (c *CloudAPI) fault(r *http.Request, operations []string, machineID string) *Fault {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, f := range c.faults {
+		if !f.matches(r, operations, machineID) {
+			continue
+		}
+		if f.Probability > 0 && f.Probability < 1 && c.faultRand.Float64() >= f.Probability {
+			continue
+		}
+
+		applied := *f
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				c.faults = append(c.faults[:i], c.faults[i+1:]...)
+			}
+		}
+		return &applied
+	}
+	return nil
+}
+
+// injectFault applies a fault to a request. It returns false when the
+// request is left for the handler to serve.
+func (c *CloudAPI) injectFault(f *Fault, w http.ResponseWriter, r *http.Request, serve func(http.ResponseWriter)) bool {
+	if f.Latency > 0 {
+		time.Sleep(f.Latency)
+	}
+
+	switch {
+	case f.Drop:
+		// net/http closes the connection of a handler aborted this way
+		panic(http.ErrAbortHandler)
+
+	case f.failing():
+		f.error().ServeHTTP(w, r)
+		return true
+
+	case f.Truncate:
+		rec := &responseBuffer{header: w.Header(), status: http.StatusOK}
+		serve(rec)
+		body := rec.body.Bytes()
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(rec.status)
+		w.Write(body[:len(body)/2])
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		panic(http.ErrAbortHandler)
+	}
+
+	return false
+}
+
+// responseBuffer holds a response so that a fault can send part of it
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *responseBuffer) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *responseBuffer) Write(data []byte) (int, error) {
+	return b.body.Write(data)
+}
+
+// machineActions are the operations UpdateMachine dispatches to by action
+var machineActions = map[string]hook.ControlPoint{
+	"stop":             HookStopMachine,
+	"start":            HookStartMachine,
+	"reboot":           HookRebootMachine,
+	"resize":           HookResizeMachine,
+	"rename":           HookRenameMachine,
+	"enable_firewall":  HookEnableFirewallMachine,
+	"disable_firewall": HookDisableFirewallMachine,
+}
+
+// requestOperations returns the operations a request calls, that of its route
+// and, for an UpdateMachine request, that of its action, and the machine it is
+// about if any
+func requestOperations(operation hook.ControlPoint, r *http.Request, p httprouter.Params) ([]string, string) {
+	operations := []string{string(operation)}
+	if action, ok := machineActions[r.URL.Query().Get("action")]; ok && operation == HookUpdateMachine {
+		operations = append(operations, string(action))
+	}
+	var machineID string
+	if parts := strings.Split(r.URL.Path, "/"); len(parts) > 3 && parts[2] == "machines" {
+		machineID = p.ByName("id")
+	}
+	return operations, machineID
+}
@@ -11,100 +11,146 @@ import (
 // FirewallRule APIs
 
 // ListFirewallRules gets a list of firewall rules from the double
-func (c *CloudAPI) ListFirewallRules() ([]*cloudapi.FirewallRule, error) {
-	if err := c.ProcessFunctionHook(c); err != nil {
+func (c *CloudAPI) ListFirewallRules() (result []*cloudapi.FirewallRule, err error) {
+	call, err := c.StartCall(HookListFirewallRules, c)
+	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	out := make([]*cloudapi.FirewallRule, len(c.firewallRules))
+	for i, r := range c.firewallRules {
+		rule := *r
+		out[i] = &rule
+	}
 
-	return c.firewallRules, nil
+	return out, nil
 }
 
 // GetFirewallRule gets a single firewall rule by ID
-func (c *CloudAPI) GetFirewallRule(fwRuleID string) (*cloudapi.FirewallRule, error) {
-	if err := c.ProcessFunctionHook(c, fwRuleID); err != nil {
+func (c *CloudAPI) GetFirewallRule(fwRuleID string) (result *cloudapi.FirewallRule, err error) {
+	call, err := c.StartCall(HookGetFirewallRule, c, fwRuleID)
+	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
 	for _, r := range c.firewallRules {
 		if strings.EqualFold(r.Id, fwRuleID) {
-			return r, nil
+			rule := *r
+			return &rule, nil
 		}
 	}
 
-	return nil, fmt.Errorf("Firewall rule %s not found", fwRuleID)
+	return nil, notFoundError("Firewall rule %s not found", fwRuleID)
 }
 
 // CreateFirewallRule creates a new firewall rule and returns it
-func (c *CloudAPI) CreateFirewallRule(rule string, enabled bool) (*cloudapi.FirewallRule, error) {
-	if err := c.ProcessFunctionHook(c, rule, enabled); err != nil {
+func (c *CloudAPI) CreateFirewallRule(rule string, enabled bool) (result *cloudapi.FirewallRule, err error) {
+	call, err := c.StartCall(HookCreateFirewallRule, c, rule, enabled)
+	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
 
 	fwRuleID, err := localservices.NewUUID()
 	if err != nil {
 		return nil, fmt.Errorf("Error creating firewall rule: %q", err)
 	}
 
-	fwRule := &cloudapi.FirewallRule{Id: fwRuleID, Rule: rule, Enabled: enabled}
-	c.firewallRules = append(c.firewallRules, fwRule)
+	fwRule := cloudapi.FirewallRule{Id: fwRuleID, Rule: rule, Enabled: enabled}
+	stored := fwRule
 
-	return fwRule, nil
+	c.mu.Lock()
+	c.firewallRules = append(c.firewallRules, &stored)
+	c.mu.Unlock()
+
+	return &fwRule, nil
 }
 
 // UpdateFirewallRule makes changes to a given firewall rule
-func (c *CloudAPI) UpdateFirewallRule(fwRuleID, rule string, enabled bool) (*cloudapi.FirewallRule, error) {
-	if err := c.ProcessFunctionHook(c, fwRuleID, rule, enabled); err != nil {
+func (c *CloudAPI) UpdateFirewallRule(fwRuleID, rule string, enabled bool) (result *cloudapi.FirewallRule, err error) {
+	call, err := c.StartCall(HookUpdateFirewallRule, c, fwRuleID, rule, enabled)
+	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	for _, r := range c.firewallRules {
 		if strings.EqualFold(r.Id, fwRuleID) {
 			r.Rule = rule
 			r.Enabled = enabled
-			return r, nil
+			out := *r
+			return &out, nil
 		}
 	}
 
-	return nil, fmt.Errorf("Firewall rule %s not found", fwRuleID)
+	return nil, notFoundError("Firewall rule %s not found", fwRuleID)
 }
 
 // EnableFirewallRule enables the given firewall rule
-func (c *CloudAPI) EnableFirewallRule(fwRuleID string) (*cloudapi.FirewallRule, error) {
-	if err := c.ProcessFunctionHook(c, fwRuleID); err != nil {
+func (c *CloudAPI) EnableFirewallRule(fwRuleID string) (result *cloudapi.FirewallRule, err error) {
+	call, err := c.StartCall(HookEnableFirewallRule, c, fwRuleID)
+	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	for _, r := range c.firewallRules {
 		if strings.EqualFold(r.Id, fwRuleID) {
 			r.Enabled = true
-			return r, nil
+			out := *r
+			return &out, nil
 		}
 	}
 
-	return nil, fmt.Errorf("Firewall rule %s not found", fwRuleID)
+	return nil, notFoundError("Firewall rule %s not found", fwRuleID)
 }
 
 // DisableFirewallRule disables the given firewall rule
-func (c *CloudAPI) DisableFirewallRule(fwRuleID string) (*cloudapi.FirewallRule, error) {
-	if err := c.ProcessFunctionHook(c, fwRuleID); err != nil {
+func (c *CloudAPI) DisableFirewallRule(fwRuleID string) (result *cloudapi.FirewallRule, err error) {
+	call, err := c.StartCall(HookDisableFirewallRule, c, fwRuleID)
+	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	for _, r := range c.firewallRules {
 		if strings.EqualFold(r.Id, fwRuleID) {
 			r.Enabled = false
-			return r, nil
+			out := *r
+			return &out, nil
 		}
 	}
 
-	return nil, fmt.Errorf("Firewall rule %s not found", fwRuleID)
+	return nil, notFoundError("Firewall rule %s not found", fwRuleID)
 }
 
 // DeleteFirewallRule deletes the given firewall rule
-func (c *CloudAPI) DeleteFirewallRule(fwRuleID string) error {
-	if err := c.ProcessFunctionHook(c, fwRuleID); err != nil {
+func (c *CloudAPI) DeleteFirewallRule(fwRuleID string) (err error) {
+	call, err := c.StartCall(HookDeleteFirewallRule, c, fwRuleID)
+	if err != nil {
 		return err
 	}
+	defer c.ProcessAfterHook(call, c, nil, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	for i, r := range c.firewallRules {
 		if strings.EqualFold(r.Id, fwRuleID) {
@@ -113,19 +159,27 @@ func (c *CloudAPI) DeleteFirewallRule(fwRuleID string) error {
 		}
 	}
 
-	return fmt.Errorf("Firewall rule %s not found", fwRuleID)
+	return notFoundError("Firewall rule %s not found", fwRuleID)
 }
 
 // ListFirewallRuleMachines should list the machines that are affected by a
 // given firewall rule. In this double, it just returns all the machines.
-func (c *CloudAPI) ListFirewallRuleMachines(fwRuleID string) ([]*cloudapi.Machine, error) {
-	if err := c.ProcessFunctionHook(c, fwRuleID); err != nil {
+func (c *CloudAPI) ListFirewallRuleMachines(fwRuleID string) (result []*cloudapi.Machine, err error) {
+	call, err := c.StartCall(HookListFirewallRuleMachines, c, fwRuleID)
+	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.settleMachines()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
-	out := make([]*cloudapi.Machine, len(c.machines))
-	for i, machine := range c.machines {
-		out[i] = &machine.Machine
+	machines := c.liveMachines()
+	out := make([]*cloudapi.Machine, len(machines))
+	for i, machine := range machines {
+		out[i] = copyMachine(&machine.Machine)
 	}
 
 	return out, nil
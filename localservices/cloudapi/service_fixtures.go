@@ -0,0 +1,605 @@
+//
+// gosdc - Go library to interact with the Joyent CloudAPI
+//
+// CloudAPI double testing service - fixtures
+//
+// Copyright (c) Joyent Inc.
+//
+
+package cloudapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/joyent/gosdc/cloudapi"
+	"github.com/joyent/gosdc/localservices"
+	"gopkg.in/yaml.v2"
+)
+
+// Fixture describes the resources of a double. It is read from and written
+// to JSON or YAML documents, with resources in the same shape as the cloudapi
+// types.
+//
+// A section left out of a fixture leaves that part of the double as it is
+// when the fixture is loaded, while an empty section empties it. Faults
+// are loaded as with AddFault, limits as with SetLimits and compute nodes as
+// with SetComputeNodes. Packages, images and networks are those of every
+// account of the double.
+type Fixture struct {
+	Packages      []cloudapi.Package      `json:"packages"`
+	Images        []cloudapi.Image        `json:"images"`
+	Networks      []cloudapi.Network      `json:"networks"`
+	FabricVLANs   []FixtureVLAN           `json:"fabric_vlans"`
+	Keys          []cloudapi.Key          `json:"keys"`
+	Machines      []FixtureMachine        `json:"machines"`
+	FirewallRules []cloudapi.FirewallRule `json:"firewall_rules"`
+	Faults        []Fault                 `json:"faults"`
+	Limits        *Limits                 `json:"limits"`
+	ComputeNodes  []ComputeNode           `json:"compute_nodes"`
+}
+
+// FixtureVLAN is a fabric VLAN along with its networks
+type FixtureVLAN struct {
+	cloudapi.FabricVLAN
+	Networks []cloudapi.FabricNetwork `json:"networks"`
+}
+
+// FixtureMachine is a machine along with its NICs. A machine given without
+// NICs gets one on each of its networks, with addresses allocated as by
+// CreateMachine.
+type FixtureMachine struct {
+	cloudapi.Machine
+	NICs []cloudapi.NIC `json:"nics"`
+}
+
+// DefaultFixture returns the resources a new double starts with
+func DefaultFixture() *Fixture {
+	return &Fixture{
+		Packages:      initPackages(),
+		Images:        initImages(),
+		Networks:      initNetworks(),
+		FabricVLANs:   []FixtureVLAN{},
+		Keys:          []cloudapi.Key{},
+		Machines:      []FixtureMachine{},
+		FirewallRules: []cloudapi.FirewallRule{},
+		Faults:        []Fault{},
+		Limits:        &Limits{},
+		ComputeNodes:  []ComputeNode{},
+	}
+}
+
+// ParseFixture reads a fixture from a JSON or YAML document
+func ParseFixture(data []byte) (*Fixture, error) {
+	doc := bytes.TrimSpace(data)
+	if !bytes.HasPrefix(doc, []byte("{")) {
+		var raw interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, NewError(CodeInvalidContent, "Cannot parse fixture: %s", err)
+		}
+		var err error
+		if doc, err = json.Marshal(fromYAML(raw)); err != nil {
+			return nil, NewError(CodeInvalidContent, "Cannot parse fixture: %s", err)
+		}
+	}
+
+	f := &Fixture{}
+	if err := json.Unmarshal(doc, f); err != nil {
+		return nil, NewError(CodeInvalidContent, "Cannot parse fixture: %s", err)
+	}
+	return f, nil
+}
+
+// JSON returns the fixture as an indented JSON document
+func (f *Fixture) JSON() ([]byte, error) {
+	return json.MarshalIndent(f, "", "  ")
+}
+
+// YAML returns the fixture as a YAML document
+func (f *Fixture) YAML() ([]byte, error) {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(toYAML(raw))
+}
+
+// fromYAML turns a decoded YAML document into one that encodes to JSON
+func fromYAML(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			out[fmt.Sprint(k)] = fromYAML(e)
+		}
+		return out
+	case []interface{}:
+		for i, e := range t {
+			t[i] = fromYAML(e)
+		}
+	}
+	return v
+}
+
+// toYAML turns a JSON document decoded with UseNumber into one that encodes
+// to YAML with plain numbers
+func toYAML(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = toYAML(e)
+		}
+	case []interface{}:
+		for i, e := range t {
+			t[i] = toYAML(e)
+		}
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return i
+		}
+		f, _ := t.Float64()
+		return f
+	}
+	return v
+}
+
+// LoadFixture replaces the resources of the double with those of the
+// fixture, section by section. Machines are loaded in the state they are
+// given in, running if none, and lose their snapshots. Machines given without
+// a compute node are placed as by CreateMachine. Networks can only be removed
+// along with the NICs on them, so a fixture removing a network some machine
+// it leaves has a NIC on is invalid. The fixture is loaded whole or, if any
+// of it is invalid, not at all.
+func (c *CloudAPI) LoadFixture(f *Fixture) error {
+	var (
+		vlans         map[int16]*fabricVLAN
+		machines      []*machine
+		firewallRules []*cloudapi.FirewallRule
+		computeNodes  []ComputeNode
+	)
+
+	if f.FabricVLANs != nil {
+		vlans = map[int16]*fabricVLAN{}
+		vlanNames, names := map[string]bool{}, map[string]bool{}
+		for _, v := range f.FabricVLANs {
+			if err := v.FabricVLAN.Validate(); err != nil {
+				return validationError(err)
+			}
+			if _, present := vlans[v.Id]; present {
+				return invalidArgumentError("VLAN %d is in the fixture twice", v.Id)
+			}
+			if vlanNames[v.Name] {
+				return invalidArgumentError("VLAN %s is in the fixture twice", v.Name)
+			}
+			vlanNames[v.Name] = true
+			vlan := &fabricVLAN{FabricVLAN: v.FabricVLAN, Networks: map[string]*cloudapi.FabricNetwork{}}
+			for _, n := range v.Networks {
+				network := copyFabricNetwork(&n)
+				if network.Id == "" {
+					id, err := localservices.NewUUID()
+					if err != nil {
+						return err
+					}
+					network.Id = id
+				}
+				if names[network.Name] {
+					return invalidArgumentError("Network %s is in the fixture twice", network.Name)
+				}
+				names[network.Name] = true
+				network.Fabric = true
+				network.VLANId = v.Id
+				vlan.Networks[network.Id] = network
+			}
+			vlans[v.Id] = vlan
+		}
+	}
+
+	if f.Machines != nil {
+		machines = []*machine{}
+		for _, fm := range f.Machines {
+			m, err := fixtureMachine(fm)
+			if err != nil {
+				return err
+			}
+			machines = append(machines, m)
+		}
+	}
+
+	if f.FirewallRules != nil {
+		firewallRules = []*cloudapi.FirewallRule{}
+		for _, r := range f.FirewallRules {
+			rule := r
+			if rule.Id == "" {
+				id, err := localservices.NewUUID()
+				if err != nil {
+					return err
+				}
+				rule.Id = id
+			}
+			firewallRules = append(firewallRules, &rule)
+		}
+	}
+
+	if f.Faults != nil {
+		for i := range f.Faults {
+			if err := f.Faults[i].validate(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if f.Limits != nil {
+		if err := f.Limits.validate(); err != nil {
+			return err
+		}
+	}
+
+	if f.ComputeNodes != nil {
+		var err error
+		if computeNodes, err = newComputeNodes(f.ComputeNodes); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The fixture is loaded into copies of the state of the account and of
+	// the catalog, which replace them once the whole fixture is loaded.
+	next := c.state.copy()
+	catalog := next
+	if c.primary != c {
+		catalog = c.primary.state.copy()
+	}
+	if f.Packages != nil {
+		catalog.packages = append([]cloudapi.Package{}, f.Packages...)
+	}
+	if f.Images != nil {
+		catalog.images = append([]cloudapi.Image{}, f.Images...)
+	}
+	if f.Networks != nil {
+		catalog.networks = copyNetworks(f.Networks)
+	}
+	if vlans != nil {
+		next.fabricVLANs = vlans
+	}
+	if f.Keys != nil {
+		next.keys = append([]cloudapi.Key{}, f.Keys...)
+	}
+	if firewallRules != nil {
+		next.firewallRules = firewallRules
+	}
+	if computeNodes == nil {
+		computeNodes = c.computeNodes
+	}
+	if machines != nil {
+		now := c.now().UTC().Format(timeLayout)
+		for _, m := range machines {
+			if m.Created == "" {
+				m.Created = now
+			}
+		}
+		next.machines = machines
+		next.snapshots = map[string][]*snapshot{}
+		if err := c.loadMachines(next, catalog, computeNodes); err != nil {
+			return err
+		}
+	}
+	if f.Networks != nil || vlans != nil {
+		if err := c.checkKeptNICs(next, catalog, machines != nil); err != nil {
+			return err
+		}
+	}
+
+	c.primary.state = *catalog
+	c.state = *next
+	c.computeNodes = computeNodes
+	if f.Faults != nil {
+		c.faults = nil
+		for _, fault := range f.Faults {
+			fault := fault
+			c.faultSeq++
+			fault.Id = strconv.Itoa(c.faultSeq)
+			c.faults = append(c.faults, &fault)
+		}
+	}
+	if f.Limits != nil {
+		c.limits = *f.Limits
+	}
+
+	return nil
+}
+
+// fixtureMachine builds a machine of the double from a fixture
+func fixtureMachine(fm FixtureMachine) (*machine, error) {
+	m := &machine{Machine: *copyMachine(&fm.Machine)}
+	if m.Id == "" {
+		id, err := localservices.NewUUID()
+		if err != nil {
+			return nil, err
+		}
+		m.Id = id
+	}
+	if m.State == "" {
+		m.State = "running"
+	}
+	if m.Metadata == nil {
+		m.Metadata = map[string]string{}
+	}
+	if m.Tags == nil {
+		m.Tags = map[string]string{}
+	}
+	if m.Networks == nil {
+		m.Networks = []string{}
+	}
+
+	// NICs are given addresses once the networks of the fixture are loaded
+	if fm.NICs == nil {
+		return m, nil
+	}
+
+	m.NICs = map[string]*cloudapi.NIC{}
+	m.NetworkNICs = map[string]string{}
+	for _, n := range fm.NICs {
+		nic := n
+		if nic.MAC == "" {
+			return nil, invalidArgumentError("NIC of machine %s has no MAC", m.Id)
+		}
+		if nic.State == "" {
+			nic.State = cloudapi.NICStateRunning
+		}
+		m.NICs[nic.MAC] = copyNIC(&nic)
+		m.NetworkNICs[nic.MAC] = nic.Network
+	}
+
+	return m, nil
+}
+
+// loadMachines places the machines of the given state of the account on the
+// compute nodes and gives them NICs, seeing the double as if the given states
+// and compute nodes were its own. The double is left as it was. The caller
+// must hold c.mu.
+func (c *CloudAPI) loadMachines(next, catalog *state, nodes []ComputeNode) error {
+	prev, prevCatalog, prevNodes := c.state, c.primary.state, c.computeNodes
+	defer func() {
+		c.primary.state = prevCatalog
+		c.state = prev
+		c.computeNodes = prevNodes
+	}()
+	c.primary.state = *catalog
+	c.state = *next
+	c.computeNodes = nodes
+
+	for _, m := range next.machines {
+		if err := c.loadPlacement(m); err != nil {
+			return err
+		}
+	}
+	// NICs given by the fixture take their addresses before any is allocated
+	taken := map[string]map[netip.Addr]string{}
+	for _, m := range next.machines {
+		if m.NICs != nil {
+			if err := c.checkNICs(m, taken); err != nil {
+				return err
+			}
+		}
+	}
+	used := c.usedIPs()
+	for _, m := range next.machines {
+		if err := c.loadNICs(m, used); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadPlacement places a machine of a fixture on the first compute node with
+// room for it, unless it is given one or has failed. The caller must hold
+// c.mu.
+func (c *CloudAPI) loadPlacement(m *machine) error {
+	if m.ComputeNode != "" {
+		for _, node := range c.computeNodes {
+			if node.Id == m.ComputeNode {
+				return nil
+			}
+		}
+		return invalidArgumentError("Machine %s is on compute node %s, which is not in the fixture", m.Id, m.ComputeNode)
+	}
+	if m.State == "failed" {
+		return nil
+	}
+	nodeID, err := c.placeMachine(m.Memory, m.Disk)
+	if err != nil {
+		return err
+	}
+	m.ComputeNode = nodeID
+	return nil
+}
+
+// checkNICs returns an error unless the NICs of a machine of a fixture are
+// on networks of the double, with addresses in those networks that no other
+// NIC of the fixture has. The caller must hold c.mu.
+func (c *CloudAPI) checkNICs(m *machine, taken map[string]map[netip.Addr]string) error {
+	for _, nic := range m.NICs {
+		if _, err := c.findNetwork(nic.Network); err != nil {
+			return invalidArgumentError("NIC %s of machine %s is on network %s, which is not found", nic.MAC, m.Id, nic.Network)
+		}
+		if taken[nic.Network] == nil {
+			taken[nic.Network] = map[netip.Addr]string{}
+		}
+		for _, addr := range nicAddrs(nic) {
+			if _, _, err := c.addrRange(nic.Network, addr.String()); err != nil {
+				return invalidArgumentError("NIC %s of machine %s has address %s outside network %s", nic.MAC, m.Id, addr, nic.Network)
+			}
+			if other, present := taken[nic.Network][addr]; present {
+				return invalidArgumentError("NIC %s of machine %s has address %s, which machine %s has too", nic.MAC, m.Id, addr, other)
+			}
+			taken[nic.Network][addr] = m.Id
+		}
+	}
+	return nil
+}
+
+// checkKeptNICs returns an error if a machine the fixture leaves in place has
+// a NIC on a network of neither the given catalog nor its account. The
+// machines of the account are in next, and are left out if they are those of
+// the fixture. The caller must hold c.mu.
+func (c *CloudAPI) checkKeptNICs(next, catalog *state, loaded bool) error {
+	for _, account := range c.accountList() {
+		machines, vlans := account.machines, account.fabricVLANs
+		if account == c {
+			if loaded {
+				continue
+			}
+			machines, vlans = next.machines, next.fabricVLANs
+		}
+		for _, m := range machines {
+			for _, nic := range m.NICs {
+				if !hasNetwork(catalog.networks, vlans, nic.Network) {
+					return invalidArgumentError("NIC %s of machine %s is on network %s, which is not in the fixture", nic.MAC, m.Id, nic.Network)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hasNetwork reports whether the network is one of the given networks or of
+// the given fabric VLANs
+func hasNetwork(networks []cloudapi.Network, vlans map[int16]*fabricVLAN, networkID string) bool {
+	for _, n := range networks {
+		if strings.EqualFold(n.Id, networkID) {
+			return true
+		}
+	}
+	for _, vlan := range vlans {
+		for _, n := range vlan.Networks {
+			if strings.EqualFold(n.Id, networkID) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loadNICs gives a machine of a fixture NICs on its networks when the
+// fixture has none for it, taking their addresses from used, and IPs when it
+// has none. The caller must hold c.mu.
+func (c *CloudAPI) loadNICs(m *machine, used *ipUsage) error {
+	if m.NICs == nil {
+		ips, networks := m.IPs, m.Networks
+		m.Networks = []string{}
+		if err := c.attachNICs(m, networks, used); err != nil {
+			return err
+		}
+		if ips != nil {
+			m.IPs = ips
+		}
+	}
+	if m.IPs == nil {
+		c.updateIPs(m)
+	}
+	return nil
+}
+
+// DumpFixture returns the resources of the double as a fixture. Loading it
+// into a new double gives back the same resources. Machines in the middle of
+// an action are dumped as they will be once it completes, since the action
+// cannot be dumped with them.
+func (c *CloudAPI) DumpFixture() *Fixture {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.settle()
+
+	f := &Fixture{
+		Packages:      append([]cloudapi.Package{}, c.primary.packages...),
+		Images:        append([]cloudapi.Image{}, c.primary.images...),
+		Networks:      copyNetworks(c.primary.networks),
+		FabricVLANs:   []FixtureVLAN{},
+		Keys:          append([]cloudapi.Key{}, c.keys...),
+		Machines:      []FixtureMachine{},
+		FirewallRules: []cloudapi.FirewallRule{},
+		Faults:        []Fault{},
+		Limits:        &Limits{},
+		ComputeNodes:  append([]ComputeNode{}, c.computeNodes...),
+	}
+	*f.Limits = c.limits
+	ids := make([]int, 0, len(c.fabricVLANs))
+	for id := range c.fabricVLANs {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		vlan := c.fabricVLANs[int16(id)]
+		v := FixtureVLAN{FabricVLAN: vlan.FabricVLAN, Networks: []cloudapi.FabricNetwork{}}
+		for _, network := range vlan.Networks {
+			v.Networks = append(v.Networks, *copyFabricNetwork(network))
+		}
+		sort.Sort(fabricNetworksByID(v.Networks))
+		f.FabricVLANs = append(f.FabricVLANs, v)
+	}
+
+	for _, m := range c.machines {
+		if m = completedMachine(m); m == nil {
+			continue
+		}
+		fm := FixtureMachine{Machine: *copyMachine(&m.Machine), NICs: []cloudapi.NIC{}}
+		for _, nic := range m.NICs {
+			fm.NICs = append(fm.NICs, *copyNIC(nic))
+		}
+		sort.Sort(nicsByMAC(fm.NICs))
+		f.Machines = append(f.Machines, fm)
+	}
+
+	for _, r := range c.firewallRules {
+		f.FirewallRules = append(f.FirewallRules, *r)
+	}
+
+	for _, fault := range c.faults {
+		f.Faults = append(f.Faults, *fault)
+	}
+
+	return f
+}
+
+// completedMachine returns a copy of a machine as it will be once its action
+// in progress completes, or nil if the action deletes it
+func completedMachine(m *machine) *machine {
+	out := copyMachineWrapper(m)
+	if t := out.pending; t != nil {
+		out.pending = nil
+		if t.apply != nil {
+			t.apply(out)
+		}
+		if t.state == "" {
+			return nil
+		}
+		out.State = t.state
+	}
+	return out
+}
+
+type fabricNetworksByID []cloudapi.FabricNetwork
+
+func (n fabricNetworksByID) Len() int           { return len(n) }
+func (n fabricNetworksByID) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+func (n fabricNetworksByID) Less(i, j int) bool { return n[i].Id < n[j].Id }
+
+type nicsByMAC []cloudapi.NIC
+
+func (n nicsByMAC) Len() int           { return len(n) }
+func (n nicsByMAC) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+func (n nicsByMAC) Less(i, j int) bool { return n[i].MAC < n[j].MAC }
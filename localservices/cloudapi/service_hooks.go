@@ -0,0 +1,1149 @@
+//
+// gosdc - Go library to interact with the Joyent CloudAPI
+//
+// CloudAPI double testing service - control points
+//
+// Copyright (c) Joyent Inc.
+//
+
+package cloudapi
+
+import (
+	"github.com/joyent/gosdc/cloudapi"
+	"github.com/joyent/gosdc/localservices/hook"
+)
+
+// Control points of the double, one per operation. Each operation reaches its
+// control point with its leading arguments before doing anything, and runs the
+// After hooks of the control point when it returns. CreateImageFromMachine and
+// DeleteImage, which the double does not implement, only name their requests
+// for faults to match.
+const (
+	HookListKeys                         hook.ControlPoint = "ListKeys"
+	HookGetKey                           hook.ControlPoint = "GetKey"
+	HookCreateKey                        hook.ControlPoint = "CreateKey"
+	HookDeleteKey                        hook.ControlPoint = "DeleteKey"
+	HookListImages                       hook.ControlPoint = "ListImages"
+	HookGetImage                         hook.ControlPoint = "GetImage"
+	HookCreateImageFromMachine           hook.ControlPoint = "CreateImageFromMachine"
+	HookDeleteImage                      hook.ControlPoint = "DeleteImage"
+	HookListPackages                     hook.ControlPoint = "ListPackages"
+	HookGetPackage                       hook.ControlPoint = "GetPackage"
+	HookListMachines                     hook.ControlPoint = "ListMachines"
+	HookCountMachines                    hook.ControlPoint = "CountMachines"
+	HookGetMachine                       hook.ControlPoint = "GetMachine"
+	HookCreateMachine                    hook.ControlPoint = "CreateMachine"
+	HookUpdateMachine                    hook.ControlPoint = "UpdateMachine"
+	HookStopMachine                      hook.ControlPoint = "StopMachine"
+	HookStartMachine                     hook.ControlPoint = "StartMachine"
+	HookRebootMachine                    hook.ControlPoint = "RebootMachine"
+	HookResizeMachine                    hook.ControlPoint = "ResizeMachine"
+	HookRenameMachine                    hook.ControlPoint = "RenameMachine"
+	HookListMachineFirewallRules         hook.ControlPoint = "ListMachineFirewallRules"
+	HookEnableFirewallMachine            hook.ControlPoint = "EnableFirewallMachine"
+	HookDisableFirewallMachine           hook.ControlPoint = "DisableFirewallMachine"
+	HookDeleteMachine                    hook.ControlPoint = "DeleteMachine"
+	HookGetMachineMetadata               hook.ControlPoint = "GetMachineMetadata"
+	HookUpdateMachineMetadata            hook.ControlPoint = "UpdateMachineMetadata"
+	HookDeleteMachineMetadata            hook.ControlPoint = "DeleteMachineMetadata"
+	HookDeleteAllMachineMetadata         hook.ControlPoint = "DeleteAllMachineMetadata"
+	HookListMachineTags                  hook.ControlPoint = "ListMachineTags"
+	HookGetMachineTag                    hook.ControlPoint = "GetMachineTag"
+	HookAddMachineTags                   hook.ControlPoint = "AddMachineTags"
+	HookReplaceMachineTags               hook.ControlPoint = "ReplaceMachineTags"
+	HookDeleteMachineTag                 hook.ControlPoint = "DeleteMachineTag"
+	HookDeleteMachineTags                hook.ControlPoint = "DeleteMachineTags"
+	HookListMachineSnapshots             hook.ControlPoint = "ListMachineSnapshots"
+	HookGetMachineSnapshot               hook.ControlPoint = "GetMachineSnapshot"
+	HookCreateMachineSnapshot            hook.ControlPoint = "CreateMachineSnapshot"
+	HookStartMachineFromSnapshot         hook.ControlPoint = "StartMachineFromSnapshot"
+	HookDeleteMachineSnapshot            hook.ControlPoint = "DeleteMachineSnapshot"
+	HookListNICs                         hook.ControlPoint = "ListNICs"
+	HookGetNIC                           hook.ControlPoint = "GetNIC"
+	HookAddNIC                           hook.ControlPoint = "AddNIC"
+	HookRemoveNIC                        hook.ControlPoint = "RemoveNIC"
+	HookListFirewallRules                hook.ControlPoint = "ListFirewallRules"
+	HookGetFirewallRule                  hook.ControlPoint = "GetFirewallRule"
+	HookCreateFirewallRule               hook.ControlPoint = "CreateFirewallRule"
+	HookUpdateFirewallRule               hook.ControlPoint = "UpdateFirewallRule"
+	HookEnableFirewallRule               hook.ControlPoint = "EnableFirewallRule"
+	HookDisableFirewallRule              hook.ControlPoint = "DisableFirewallRule"
+	HookDeleteFirewallRule               hook.ControlPoint = "DeleteFirewallRule"
+	HookListFirewallRuleMachines         hook.ControlPoint = "ListFirewallRuleMachines"
+	HookListNetworks                     hook.ControlPoint = "ListNetworks"
+	HookGetNetwork                       hook.ControlPoint = "GetNetwork"
+	HookListNetworkIPs                   hook.ControlPoint = "ListNetworkIPs"
+	HookGetNetworkIP                     hook.ControlPoint = "GetNetworkIP"
+	HookUpdateNetworkIP                  hook.ControlPoint = "UpdateNetworkIP"
+	HookListFabricVLANs                  hook.ControlPoint = "ListFabricVLANs"
+	HookGetFabricVLAN                    hook.ControlPoint = "GetFabricVLAN"
+	HookCreateFabricVLAN                 hook.ControlPoint = "CreateFabricVLAN"
+	HookUpdateFabricVLAN                 hook.ControlPoint = "UpdateFabricVLAN"
+	HookDeleteFabricVLAN                 hook.ControlPoint = "DeleteFabricVLAN"
+	HookListFabricNetworks               hook.ControlPoint = "ListFabricNetworks"
+	HookGetFabricNetwork                 hook.ControlPoint = "GetFabricNetwork"
+	HookCreateFabricNetwork              hook.ControlPoint = "CreateFabricNetwork"
+	HookUpdateFabricNetwork              hook.ControlPoint = "UpdateFabricNetwork"
+	HookDeleteFabricNetwork              hook.ControlPoint = "DeleteFabricNetwork"
+	HookDescribeAnalytics                hook.ControlPoint = "DescribeAnalytics"
+	HookListInstrumentations             hook.ControlPoint = "ListInstrumentations"
+	HookGetInstrumentation               hook.ControlPoint = "GetInstrumentation"
+	HookCreateInstrumentation            hook.ControlPoint = "CreateInstrumentation"
+	HookDeleteInstrumentation            hook.ControlPoint = "DeleteInstrumentation"
+	HookGetInstrumentationValue          hook.ControlPoint = "GetInstrumentationValue"
+	HookGetInstrumentationHeatmap        hook.ControlPoint = "GetInstrumentationHeatmap"
+	HookGetInstrumentationHeatmapDetails hook.ControlPoint = "GetInstrumentationHeatmapDetails"
+	HookListDatacenters                  hook.ControlPoint = "ListDatacenters"
+	HookGetDatacenter                    hook.ControlPoint = "GetDatacenter"
+	HookListServices                     hook.ControlPoint = "ListServices"
+)
+
+// BeforeListKeys adds a Before hook to ListKeys, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeListKeys(fn func() error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookListKeys, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn()
+	}, opts...)
+}
+
+// AfterListKeys adds an After hook to ListKeys, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterListKeys(fn func(result []cloudapi.Key, err error) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookListKeys, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.([]cloudapi.Key), err)
+	}, opts...)
+}
+
+// BeforeGetKey adds a Before hook to GetKey, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeGetKey(fn func(keyName string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookGetKey, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterGetKey adds an After hook to GetKey, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterGetKey(fn func(result *cloudapi.Key, err error, keyName string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookGetKey, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.Key), err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeCreateKey adds a Before hook to CreateKey, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeCreateKey(fn func(keyName, key string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookCreateKey, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// AfterCreateKey adds an After hook to CreateKey, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterCreateKey(fn func(result *cloudapi.Key, err error, keyName, key string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookCreateKey, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.Key), err, args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// BeforeDeleteKey adds a Before hook to DeleteKey, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeDeleteKey(fn func(keyName string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookDeleteKey, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterDeleteKey adds an After hook to DeleteKey, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterDeleteKey(fn func(err error, keyName string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookDeleteKey, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeListImages adds a Before hook to ListImages, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeListImages(fn func(filters map[string]string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookListImages, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(map[string]string))
+	}, opts...)
+}
+
+// AfterListImages adds an After hook to ListImages, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterListImages(fn func(result []cloudapi.Image, err error, filters map[string]string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookListImages, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.([]cloudapi.Image), err, args[0].(map[string]string))
+	}, opts...)
+}
+
+// BeforeGetImage adds a Before hook to GetImage, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeGetImage(fn func(imageID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookGetImage, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterGetImage adds an After hook to GetImage, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterGetImage(fn func(result *cloudapi.Image, err error, imageID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookGetImage, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.Image), err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeListPackages adds a Before hook to ListPackages, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeListPackages(fn func(filters map[string]string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookListPackages, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(map[string]string))
+	}, opts...)
+}
+
+// AfterListPackages adds an After hook to ListPackages, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterListPackages(fn func(result []cloudapi.Package, err error, filters map[string]string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookListPackages, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.([]cloudapi.Package), err, args[0].(map[string]string))
+	}, opts...)
+}
+
+// BeforeGetPackage adds a Before hook to GetPackage, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeGetPackage(fn func(packageName string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookGetPackage, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterGetPackage adds an After hook to GetPackage, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterGetPackage(fn func(result *cloudapi.Package, err error, packageName string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookGetPackage, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.Package), err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeListMachines adds a Before hook to ListMachines, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeListMachines(fn func(filters map[string]string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookListMachines, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(map[string]string))
+	}, opts...)
+}
+
+// AfterListMachines adds an After hook to ListMachines, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterListMachines(fn func(result []*cloudapi.Machine, err error, filters map[string]string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookListMachines, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.([]*cloudapi.Machine), err, args[0].(map[string]string))
+	}, opts...)
+}
+
+// BeforeCountMachines adds a Before hook to CountMachines, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeCountMachines(fn func() error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookCountMachines, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn()
+	}, opts...)
+}
+
+// AfterCountMachines adds an After hook to CountMachines, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterCountMachines(fn func(result int, err error) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookCountMachines, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(int), err)
+	}, opts...)
+}
+
+// BeforeGetMachine adds a Before hook to GetMachine, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeGetMachine(fn func(machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookGetMachine, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterGetMachine adds an After hook to GetMachine, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterGetMachine(fn func(result *cloudapi.Machine, err error, machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookGetMachine, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.Machine), err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeCreateMachine adds a Before hook to CreateMachine, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeCreateMachine(fn func(name, pkg, image string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookCreateMachine, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(string), args[2].(string))
+	}, opts...)
+}
+
+// AfterCreateMachine adds an After hook to CreateMachine, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterCreateMachine(fn func(result *cloudapi.Machine, err error, name, pkg, image string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookCreateMachine, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.Machine), err, args[0].(string), args[1].(string), args[2].(string))
+	}, opts...)
+}
+
+// BeforeUpdateMachine adds a Before hook to UpdateMachine, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeUpdateMachine(fn func(machineID, action string, options map[string]string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookUpdateMachine, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(string), args[2].(map[string]string))
+	}, opts...)
+}
+
+// AfterUpdateMachine adds an After hook to UpdateMachine, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterUpdateMachine(fn func(err error, machineID, action string, options map[string]string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookUpdateMachine, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(err, args[0].(string), args[1].(string), args[2].(map[string]string))
+	}, opts...)
+}
+
+// BeforeStopMachine adds a Before hook to StopMachine, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeStopMachine(fn func(machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookStopMachine, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterStopMachine adds an After hook to StopMachine, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterStopMachine(fn func(err error, machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookStopMachine, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeStartMachine adds a Before hook to StartMachine, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeStartMachine(fn func(machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookStartMachine, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterStartMachine adds an After hook to StartMachine, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterStartMachine(fn func(err error, machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookStartMachine, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeRebootMachine adds a Before hook to RebootMachine, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeRebootMachine(fn func(machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookRebootMachine, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterRebootMachine adds an After hook to RebootMachine, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterRebootMachine(fn func(err error, machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookRebootMachine, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeResizeMachine adds a Before hook to ResizeMachine, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeResizeMachine(fn func(machineID, packageName string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookResizeMachine, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// AfterResizeMachine adds an After hook to ResizeMachine, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterResizeMachine(fn func(err error, machineID, packageName string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookResizeMachine, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(err, args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// BeforeRenameMachine adds a Before hook to RenameMachine, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeRenameMachine(fn func(machineID, newName string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookRenameMachine, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// AfterRenameMachine adds an After hook to RenameMachine, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterRenameMachine(fn func(err error, machineID, newName string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookRenameMachine, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(err, args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// BeforeListMachineFirewallRules adds a Before hook to ListMachineFirewallRules, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeListMachineFirewallRules(fn func(machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookListMachineFirewallRules, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterListMachineFirewallRules adds an After hook to ListMachineFirewallRules, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterListMachineFirewallRules(fn func(result []*cloudapi.FirewallRule, err error, machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookListMachineFirewallRules, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.([]*cloudapi.FirewallRule), err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeEnableFirewallMachine adds a Before hook to EnableFirewallMachine, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeEnableFirewallMachine(fn func(machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookEnableFirewallMachine, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterEnableFirewallMachine adds an After hook to EnableFirewallMachine, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterEnableFirewallMachine(fn func(err error, machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookEnableFirewallMachine, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeDisableFirewallMachine adds a Before hook to DisableFirewallMachine, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeDisableFirewallMachine(fn func(machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookDisableFirewallMachine, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterDisableFirewallMachine adds an After hook to DisableFirewallMachine, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterDisableFirewallMachine(fn func(err error, machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookDisableFirewallMachine, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeDeleteMachine adds a Before hook to DeleteMachine, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeDeleteMachine(fn func(machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookDeleteMachine, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterDeleteMachine adds an After hook to DeleteMachine, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterDeleteMachine(fn func(err error, machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookDeleteMachine, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeGetMachineMetadata adds a Before hook to GetMachineMetadata, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeGetMachineMetadata(fn func(machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookGetMachineMetadata, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterGetMachineMetadata adds an After hook to GetMachineMetadata, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterGetMachineMetadata(fn func(result map[string]string, err error, machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookGetMachineMetadata, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(map[string]string), err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeUpdateMachineMetadata adds a Before hook to UpdateMachineMetadata, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeUpdateMachineMetadata(fn func(machineID string, metadata map[string]string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookUpdateMachineMetadata, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(map[string]string))
+	}, opts...)
+}
+
+// AfterUpdateMachineMetadata adds an After hook to UpdateMachineMetadata, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterUpdateMachineMetadata(fn func(result map[string]string, err error, machineID string, metadata map[string]string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookUpdateMachineMetadata, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(map[string]string), err, args[0].(string), args[1].(map[string]string))
+	}, opts...)
+}
+
+// BeforeDeleteMachineMetadata adds a Before hook to DeleteMachineMetadata, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeDeleteMachineMetadata(fn func(machineID, key string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookDeleteMachineMetadata, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// AfterDeleteMachineMetadata adds an After hook to DeleteMachineMetadata, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterDeleteMachineMetadata(fn func(err error, machineID, key string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookDeleteMachineMetadata, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(err, args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// BeforeDeleteAllMachineMetadata adds a Before hook to DeleteAllMachineMetadata, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeDeleteAllMachineMetadata(fn func(machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookDeleteAllMachineMetadata, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterDeleteAllMachineMetadata adds an After hook to DeleteAllMachineMetadata, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterDeleteAllMachineMetadata(fn func(err error, machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookDeleteAllMachineMetadata, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeListMachineTags adds a Before hook to ListMachineTags, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeListMachineTags(fn func(machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookListMachineTags, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterListMachineTags adds an After hook to ListMachineTags, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterListMachineTags(fn func(result map[string]string, err error, machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookListMachineTags, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(map[string]string), err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeGetMachineTag adds a Before hook to GetMachineTag, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeGetMachineTag(fn func(machineID, tagKey string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookGetMachineTag, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// AfterGetMachineTag adds an After hook to GetMachineTag, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterGetMachineTag(fn func(result string, err error, machineID, tagKey string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookGetMachineTag, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(string), err, args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// BeforeAddMachineTags adds a Before hook to AddMachineTags, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeAddMachineTags(fn func(machineID string, tags map[string]string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookAddMachineTags, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(map[string]string))
+	}, opts...)
+}
+
+// AfterAddMachineTags adds an After hook to AddMachineTags, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterAddMachineTags(fn func(result map[string]string, err error, machineID string, tags map[string]string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookAddMachineTags, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(map[string]string), err, args[0].(string), args[1].(map[string]string))
+	}, opts...)
+}
+
+// BeforeReplaceMachineTags adds a Before hook to ReplaceMachineTags, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeReplaceMachineTags(fn func(machineID string, tags map[string]string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookReplaceMachineTags, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(map[string]string))
+	}, opts...)
+}
+
+// AfterReplaceMachineTags adds an After hook to ReplaceMachineTags, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterReplaceMachineTags(fn func(result map[string]string, err error, machineID string, tags map[string]string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookReplaceMachineTags, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(map[string]string), err, args[0].(string), args[1].(map[string]string))
+	}, opts...)
+}
+
+// BeforeDeleteMachineTag adds a Before hook to DeleteMachineTag, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeDeleteMachineTag(fn func(machineID, tagKey string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookDeleteMachineTag, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// AfterDeleteMachineTag adds an After hook to DeleteMachineTag, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterDeleteMachineTag(fn func(err error, machineID, tagKey string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookDeleteMachineTag, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(err, args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// BeforeDeleteMachineTags adds a Before hook to DeleteMachineTags, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeDeleteMachineTags(fn func(machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookDeleteMachineTags, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterDeleteMachineTags adds an After hook to DeleteMachineTags, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterDeleteMachineTags(fn func(err error, machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookDeleteMachineTags, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeListMachineSnapshots adds a Before hook to ListMachineSnapshots, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeListMachineSnapshots(fn func(machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookListMachineSnapshots, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterListMachineSnapshots adds an After hook to ListMachineSnapshots, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterListMachineSnapshots(fn func(result []cloudapi.Snapshot, err error, machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookListMachineSnapshots, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.([]cloudapi.Snapshot), err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeGetMachineSnapshot adds a Before hook to GetMachineSnapshot, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeGetMachineSnapshot(fn func(machineID, name string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookGetMachineSnapshot, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// AfterGetMachineSnapshot adds an After hook to GetMachineSnapshot, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterGetMachineSnapshot(fn func(result *cloudapi.Snapshot, err error, machineID, name string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookGetMachineSnapshot, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.Snapshot), err, args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// BeforeCreateMachineSnapshot adds a Before hook to CreateMachineSnapshot, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeCreateMachineSnapshot(fn func(machineID, name string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookCreateMachineSnapshot, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// AfterCreateMachineSnapshot adds an After hook to CreateMachineSnapshot, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterCreateMachineSnapshot(fn func(result *cloudapi.Snapshot, err error, machineID, name string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookCreateMachineSnapshot, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.Snapshot), err, args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// BeforeStartMachineFromSnapshot adds a Before hook to StartMachineFromSnapshot, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeStartMachineFromSnapshot(fn func(machineID, name string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookStartMachineFromSnapshot, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// AfterStartMachineFromSnapshot adds an After hook to StartMachineFromSnapshot, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterStartMachineFromSnapshot(fn func(err error, machineID, name string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookStartMachineFromSnapshot, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(err, args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// BeforeDeleteMachineSnapshot adds a Before hook to DeleteMachineSnapshot, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeDeleteMachineSnapshot(fn func(machineID, name string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookDeleteMachineSnapshot, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// AfterDeleteMachineSnapshot adds an After hook to DeleteMachineSnapshot, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterDeleteMachineSnapshot(fn func(err error, machineID, name string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookDeleteMachineSnapshot, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(err, args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// BeforeListNICs adds a Before hook to ListNICs, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeListNICs(fn func(machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookListNICs, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterListNICs adds an After hook to ListNICs, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterListNICs(fn func(result []cloudapi.NIC, err error, machineID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookListNICs, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.([]cloudapi.NIC), err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeGetNIC adds a Before hook to GetNIC, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeGetNIC(fn func(machineID, MAC string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookGetNIC, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// AfterGetNIC adds an After hook to GetNIC, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterGetNIC(fn func(result *cloudapi.NIC, err error, machineID, MAC string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookGetNIC, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.NIC), err, args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// BeforeAddNIC adds a Before hook to AddNIC, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeAddNIC(fn func(machineID, networkID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookAddNIC, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// AfterAddNIC adds an After hook to AddNIC, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterAddNIC(fn func(result *cloudapi.NIC, err error, machineID, networkID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookAddNIC, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.NIC), err, args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// BeforeRemoveNIC adds a Before hook to RemoveNIC, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeRemoveNIC(fn func(machineID, MAC string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookRemoveNIC, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// AfterRemoveNIC adds an After hook to RemoveNIC, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterRemoveNIC(fn func(err error, machineID, MAC string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookRemoveNIC, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(err, args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// BeforeListFirewallRules adds a Before hook to ListFirewallRules, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeListFirewallRules(fn func() error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookListFirewallRules, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn()
+	}, opts...)
+}
+
+// AfterListFirewallRules adds an After hook to ListFirewallRules, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterListFirewallRules(fn func(result []*cloudapi.FirewallRule, err error) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookListFirewallRules, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.([]*cloudapi.FirewallRule), err)
+	}, opts...)
+}
+
+// BeforeGetFirewallRule adds a Before hook to GetFirewallRule, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeGetFirewallRule(fn func(fwRuleID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookGetFirewallRule, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterGetFirewallRule adds an After hook to GetFirewallRule, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterGetFirewallRule(fn func(result *cloudapi.FirewallRule, err error, fwRuleID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookGetFirewallRule, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.FirewallRule), err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeCreateFirewallRule adds a Before hook to CreateFirewallRule, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeCreateFirewallRule(fn func(rule string, enabled bool) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookCreateFirewallRule, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(bool))
+	}, opts...)
+}
+
+// AfterCreateFirewallRule adds an After hook to CreateFirewallRule, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterCreateFirewallRule(fn func(result *cloudapi.FirewallRule, err error, rule string, enabled bool) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookCreateFirewallRule, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.FirewallRule), err, args[0].(string), args[1].(bool))
+	}, opts...)
+}
+
+// BeforeUpdateFirewallRule adds a Before hook to UpdateFirewallRule, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeUpdateFirewallRule(fn func(fwRuleID, rule string, enabled bool) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookUpdateFirewallRule, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(string), args[2].(bool))
+	}, opts...)
+}
+
+// AfterUpdateFirewallRule adds an After hook to UpdateFirewallRule, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterUpdateFirewallRule(fn func(result *cloudapi.FirewallRule, err error, fwRuleID, rule string, enabled bool) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookUpdateFirewallRule, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.FirewallRule), err, args[0].(string), args[1].(string), args[2].(bool))
+	}, opts...)
+}
+
+// BeforeEnableFirewallRule adds a Before hook to EnableFirewallRule, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeEnableFirewallRule(fn func(fwRuleID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookEnableFirewallRule, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterEnableFirewallRule adds an After hook to EnableFirewallRule, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterEnableFirewallRule(fn func(result *cloudapi.FirewallRule, err error, fwRuleID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookEnableFirewallRule, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.FirewallRule), err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeDisableFirewallRule adds a Before hook to DisableFirewallRule, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeDisableFirewallRule(fn func(fwRuleID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookDisableFirewallRule, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterDisableFirewallRule adds an After hook to DisableFirewallRule, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterDisableFirewallRule(fn func(result *cloudapi.FirewallRule, err error, fwRuleID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookDisableFirewallRule, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.FirewallRule), err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeDeleteFirewallRule adds a Before hook to DeleteFirewallRule, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeDeleteFirewallRule(fn func(fwRuleID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookDeleteFirewallRule, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterDeleteFirewallRule adds an After hook to DeleteFirewallRule, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterDeleteFirewallRule(fn func(err error, fwRuleID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookDeleteFirewallRule, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeListFirewallRuleMachines adds a Before hook to ListFirewallRuleMachines, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeListFirewallRuleMachines(fn func(fwRuleID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookListFirewallRuleMachines, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterListFirewallRuleMachines adds an After hook to ListFirewallRuleMachines, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterListFirewallRuleMachines(fn func(result []*cloudapi.Machine, err error, fwRuleID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookListFirewallRuleMachines, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.([]*cloudapi.Machine), err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeListNetworks adds a Before hook to ListNetworks, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeListNetworks(fn func() error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookListNetworks, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn()
+	}, opts...)
+}
+
+// AfterListNetworks adds an After hook to ListNetworks, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterListNetworks(fn func(result []cloudapi.Network, err error) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookListNetworks, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.([]cloudapi.Network), err)
+	}, opts...)
+}
+
+// BeforeGetNetwork adds a Before hook to GetNetwork, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeGetNetwork(fn func(networkID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookGetNetwork, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterGetNetwork adds an After hook to GetNetwork, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterGetNetwork(fn func(result *cloudapi.Network, err error, networkID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookGetNetwork, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.Network), err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeListNetworkIPs adds a Before hook to ListNetworkIPs, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeListNetworkIPs(fn func(networkID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookListNetworkIPs, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterListNetworkIPs adds an After hook to ListNetworkIPs, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterListNetworkIPs(fn func(result []cloudapi.NetworkIP, err error, networkID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookListNetworkIPs, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.([]cloudapi.NetworkIP), err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeGetNetworkIP adds a Before hook to GetNetworkIP, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeGetNetworkIP(fn func(networkID, ipAddress string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookGetNetworkIP, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// AfterGetNetworkIP adds an After hook to GetNetworkIP, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterGetNetworkIP(fn func(result *cloudapi.NetworkIP, err error, networkID, ipAddress string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookGetNetworkIP, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.NetworkIP), err, args[0].(string), args[1].(string))
+	}, opts...)
+}
+
+// BeforeUpdateNetworkIP adds a Before hook to UpdateNetworkIP, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeUpdateNetworkIP(fn func(networkID, ipAddress string, reserved bool) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookUpdateNetworkIP, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(string), args[2].(bool))
+	}, opts...)
+}
+
+// AfterUpdateNetworkIP adds an After hook to UpdateNetworkIP, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterUpdateNetworkIP(fn func(result *cloudapi.NetworkIP, err error, networkID, ipAddress string, reserved bool) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookUpdateNetworkIP, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.NetworkIP), err, args[0].(string), args[1].(string), args[2].(bool))
+	}, opts...)
+}
+
+// BeforeListFabricVLANs adds a Before hook to ListFabricVLANs, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeListFabricVLANs(fn func() error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookListFabricVLANs, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn()
+	}, opts...)
+}
+
+// AfterListFabricVLANs adds an After hook to ListFabricVLANs, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterListFabricVLANs(fn func(result []cloudapi.FabricVLAN, err error) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookListFabricVLANs, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.([]cloudapi.FabricVLAN), err)
+	}, opts...)
+}
+
+// BeforeGetFabricVLAN adds a Before hook to GetFabricVLAN, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeGetFabricVLAN(fn func(vlanID int16) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookGetFabricVLAN, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(int16))
+	}, opts...)
+}
+
+// AfterGetFabricVLAN adds an After hook to GetFabricVLAN, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterGetFabricVLAN(fn func(result *cloudapi.FabricVLAN, err error, vlanID int16) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookGetFabricVLAN, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.FabricVLAN), err, args[0].(int16))
+	}, opts...)
+}
+
+// BeforeCreateFabricVLAN adds a Before hook to CreateFabricVLAN, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeCreateFabricVLAN(fn func(vlan cloudapi.FabricVLAN) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookCreateFabricVLAN, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(cloudapi.FabricVLAN))
+	}, opts...)
+}
+
+// AfterCreateFabricVLAN adds an After hook to CreateFabricVLAN, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterCreateFabricVLAN(fn func(result *cloudapi.FabricVLAN, err error, vlan cloudapi.FabricVLAN) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookCreateFabricVLAN, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.FabricVLAN), err, args[0].(cloudapi.FabricVLAN))
+	}, opts...)
+}
+
+// BeforeUpdateFabricVLAN adds a Before hook to UpdateFabricVLAN, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeUpdateFabricVLAN(fn func(vlan cloudapi.FabricVLAN) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookUpdateFabricVLAN, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(cloudapi.FabricVLAN))
+	}, opts...)
+}
+
+// AfterUpdateFabricVLAN adds an After hook to UpdateFabricVLAN, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterUpdateFabricVLAN(fn func(result *cloudapi.FabricVLAN, err error, vlan cloudapi.FabricVLAN) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookUpdateFabricVLAN, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.FabricVLAN), err, args[0].(cloudapi.FabricVLAN))
+	}, opts...)
+}
+
+// BeforeDeleteFabricVLAN adds a Before hook to DeleteFabricVLAN, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeDeleteFabricVLAN(fn func(vlanID int16) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookDeleteFabricVLAN, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(int16))
+	}, opts...)
+}
+
+// AfterDeleteFabricVLAN adds an After hook to DeleteFabricVLAN, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterDeleteFabricVLAN(fn func(err error, vlanID int16) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookDeleteFabricVLAN, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(err, args[0].(int16))
+	}, opts...)
+}
+
+// BeforeListFabricNetworks adds a Before hook to ListFabricNetworks, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeListFabricNetworks(fn func(vlanID int16) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookListFabricNetworks, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(int16))
+	}, opts...)
+}
+
+// AfterListFabricNetworks adds an After hook to ListFabricNetworks, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterListFabricNetworks(fn func(result []cloudapi.FabricNetwork, err error, vlanID int16) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookListFabricNetworks, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.([]cloudapi.FabricNetwork), err, args[0].(int16))
+	}, opts...)
+}
+
+// BeforeGetFabricNetwork adds a Before hook to GetFabricNetwork, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeGetFabricNetwork(fn func(vlanID int16, networkID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookGetFabricNetwork, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(int16), args[1].(string))
+	}, opts...)
+}
+
+// AfterGetFabricNetwork adds an After hook to GetFabricNetwork, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterGetFabricNetwork(fn func(result *cloudapi.FabricNetwork, err error, vlanID int16, networkID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookGetFabricNetwork, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.FabricNetwork), err, args[0].(int16), args[1].(string))
+	}, opts...)
+}
+
+// BeforeCreateFabricNetwork adds a Before hook to CreateFabricNetwork, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeCreateFabricNetwork(fn func(vlanID int16, opts cloudapi.CreateFabricNetworkOpts) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookCreateFabricNetwork, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(int16), args[1].(cloudapi.CreateFabricNetworkOpts))
+	}, opts...)
+}
+
+// AfterCreateFabricNetwork adds an After hook to CreateFabricNetwork, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterCreateFabricNetwork(fn func(result *cloudapi.FabricNetwork, err error, vlanID int16, opts cloudapi.CreateFabricNetworkOpts) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookCreateFabricNetwork, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.FabricNetwork), err, args[0].(int16), args[1].(cloudapi.CreateFabricNetworkOpts))
+	}, opts...)
+}
+
+// BeforeUpdateFabricNetwork adds a Before hook to UpdateFabricNetwork, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeUpdateFabricNetwork(fn func(vlanID int16, networkID string, opts cloudapi.UpdateFabricNetworkOpts) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookUpdateFabricNetwork, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(int16), args[1].(string), args[2].(cloudapi.UpdateFabricNetworkOpts))
+	}, opts...)
+}
+
+// AfterUpdateFabricNetwork adds an After hook to UpdateFabricNetwork, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterUpdateFabricNetwork(fn func(result *cloudapi.FabricNetwork, err error, vlanID int16, networkID string, opts cloudapi.UpdateFabricNetworkOpts) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookUpdateFabricNetwork, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.FabricNetwork), err, args[0].(int16), args[1].(string), args[2].(cloudapi.UpdateFabricNetworkOpts))
+	}, opts...)
+}
+
+// BeforeDeleteFabricNetwork adds a Before hook to DeleteFabricNetwork, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeDeleteFabricNetwork(fn func(vlanID int16, networkID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookDeleteFabricNetwork, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(int16), args[1].(string))
+	}, opts...)
+}
+
+// AfterDeleteFabricNetwork adds an After hook to DeleteFabricNetwork, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterDeleteFabricNetwork(fn func(err error, vlanID int16, networkID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookDeleteFabricNetwork, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(err, args[0].(int16), args[1].(string))
+	}, opts...)
+}
+
+// BeforeDescribeAnalytics adds a Before hook to DescribeAnalytics, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeDescribeAnalytics(fn func() error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookDescribeAnalytics, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn()
+	}, opts...)
+}
+
+// AfterDescribeAnalytics adds an After hook to DescribeAnalytics, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterDescribeAnalytics(fn func(result *cloudapi.Analytics, err error) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookDescribeAnalytics, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.Analytics), err)
+	}, opts...)
+}
+
+// BeforeListInstrumentations adds a Before hook to ListInstrumentations, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeListInstrumentations(fn func() error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookListInstrumentations, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn()
+	}, opts...)
+}
+
+// AfterListInstrumentations adds an After hook to ListInstrumentations, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterListInstrumentations(fn func(result []cloudapi.Instrumentation, err error) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookListInstrumentations, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.([]cloudapi.Instrumentation), err)
+	}, opts...)
+}
+
+// BeforeGetInstrumentation adds a Before hook to GetInstrumentation, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeGetInstrumentation(fn func(instrumentationID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookGetInstrumentation, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterGetInstrumentation adds an After hook to GetInstrumentation, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterGetInstrumentation(fn func(result *cloudapi.Instrumentation, err error, instrumentationID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookGetInstrumentation, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.Instrumentation), err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeCreateInstrumentation adds a Before hook to CreateInstrumentation, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeCreateInstrumentation(fn func(opts cloudapi.CreateInstrumentationOpts) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookCreateInstrumentation, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(cloudapi.CreateInstrumentationOpts))
+	}, opts...)
+}
+
+// AfterCreateInstrumentation adds an After hook to CreateInstrumentation, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterCreateInstrumentation(fn func(result *cloudapi.Instrumentation, err error, opts cloudapi.CreateInstrumentationOpts) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookCreateInstrumentation, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.Instrumentation), err, args[0].(cloudapi.CreateInstrumentationOpts))
+	}, opts...)
+}
+
+// BeforeDeleteInstrumentation adds a Before hook to DeleteInstrumentation, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeDeleteInstrumentation(fn func(instrumentationID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookDeleteInstrumentation, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterDeleteInstrumentation adds an After hook to DeleteInstrumentation, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterDeleteInstrumentation(fn func(err error, instrumentationID string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookDeleteInstrumentation, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeGetInstrumentationValue adds a Before hook to GetInstrumentationValue, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeGetInstrumentationValue(fn func(instrumentationID string, startTime int) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookGetInstrumentationValue, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(int))
+	}, opts...)
+}
+
+// AfterGetInstrumentationValue adds an After hook to GetInstrumentationValue, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterGetInstrumentationValue(fn func(result *cloudapi.InstrumentationValue, err error, instrumentationID string, startTime int) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookGetInstrumentationValue, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.InstrumentationValue), err, args[0].(string), args[1].(int))
+	}, opts...)
+}
+
+// BeforeGetInstrumentationHeatmap adds a Before hook to GetInstrumentationHeatmap, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeGetInstrumentationHeatmap(fn func(instrumentationID string, opts cloudapi.HeatmapOpts) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookGetInstrumentationHeatmap, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(cloudapi.HeatmapOpts))
+	}, opts...)
+}
+
+// AfterGetInstrumentationHeatmap adds an After hook to GetInstrumentationHeatmap, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterGetInstrumentationHeatmap(fn func(result *cloudapi.Heatmap, err error, instrumentationID string, opts cloudapi.HeatmapOpts) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookGetInstrumentationHeatmap, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.Heatmap), err, args[0].(string), args[1].(cloudapi.HeatmapOpts))
+	}, opts...)
+}
+
+// BeforeGetInstrumentationHeatmapDetails adds a Before hook to GetInstrumentationHeatmapDetails, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeGetInstrumentationHeatmapDetails(fn func(instrumentationID string, opts cloudapi.HeatmapOpts) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookGetInstrumentationHeatmapDetails, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string), args[1].(cloudapi.HeatmapOpts))
+	}, opts...)
+}
+
+// AfterGetInstrumentationHeatmapDetails adds an After hook to GetInstrumentationHeatmapDetails, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterGetInstrumentationHeatmapDetails(fn func(result *cloudapi.Heatmap, err error, instrumentationID string, opts cloudapi.HeatmapOpts) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookGetInstrumentationHeatmapDetails, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(*cloudapi.Heatmap), err, args[0].(string), args[1].(cloudapi.HeatmapOpts))
+	}, opts...)
+}
+
+// BeforeListDatacenters adds a Before hook to ListDatacenters, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeListDatacenters(fn func() error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookListDatacenters, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn()
+	}, opts...)
+}
+
+// AfterListDatacenters adds an After hook to ListDatacenters, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterListDatacenters(fn func(result map[string]string, err error) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookListDatacenters, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(map[string]string), err)
+	}, opts...)
+}
+
+// BeforeGetDatacenter adds a Before hook to GetDatacenter, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeGetDatacenter(fn func(name string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookGetDatacenter, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn(args[0].(string))
+	}, opts...)
+}
+
+// AfterGetDatacenter adds an After hook to GetDatacenter, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterGetDatacenter(fn func(result string, err error, name string) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookGetDatacenter, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(string), err, args[0].(string))
+	}, opts...)
+}
+
+// BeforeListServices adds a Before hook to ListServices, see hook.TestService.AddBeforeHook.
+func (c *CloudAPI) BeforeListServices(fn func() error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddBeforeHook(HookListServices, func(sc hook.ServiceControl, args ...interface{}) error {
+		return fn()
+	}, opts...)
+}
+
+// AfterListServices adds an After hook to ListServices, see hook.TestService.AddAfterHook.
+func (c *CloudAPI) AfterListServices(fn func(result map[string]string, err error) error, opts ...hook.HookOption) hook.ControlHookCleanup {
+	return c.AddAfterHook(HookListServices, func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fn(result.(map[string]string), err)
+	}, opts...)
+}
@@ -16,6 +16,7 @@ import (
 	"strings"
 
 	"github.com/joyent/gosdc/cloudapi"
+	"github.com/joyent/gosdc/localservices/hook"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -31,34 +32,13 @@ type ErrorResponse struct {
 
 var (
 	// ErrNotAllowed is returned when the request's method is not allowed
-	ErrNotAllowed = &ErrorResponse{
-		http.StatusMethodNotAllowed,
-		"Method is not allowed",
-		"text/plain; charset=UTF-8",
-		"MethodNotAllowedError",
-		nil,
-		nil,
-	}
+	ErrNotAllowed = NewError(CodeBadMethod, "Method is not allowed")
 
 	// ErrNotFound is returned when the requested resource is not found
-	ErrNotFound = &ErrorResponse{
-		http.StatusNotFound,
-		"Resource Not Found",
-		"text/plain; charset=UTF-8",
-		"NotFoundError",
-		nil,
-		nil,
-	}
+	ErrNotFound = NewError(CodeResourceNotFound, "Resource Not Found")
 
 	// ErrBadRequest is returned when the request is malformed or incorrect
-	ErrBadRequest = &ErrorResponse{
-		http.StatusBadRequest,
-		"Malformed request url",
-		"text/plain; charset=UTF-8",
-		"BadRequestError",
-		nil,
-		nil,
-	}
+	ErrBadRequest = NewError(CodeBadRequest, "Malformed request")
 )
 
 func (e *ErrorResponse) Error() string {
@@ -86,34 +66,43 @@ func (e *ErrorResponse) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 type cloudapiHandler struct {
-	cloudapi *CloudAPI
-	method   func(m *CloudAPI, w http.ResponseWriter, r *http.Request, p httprouter.Params) error
+	cloudapi  *CloudAPI
+	method    func(m *CloudAPI, w http.ResponseWriter, r *http.Request, p httprouter.Params) error
+	admin     bool // admin endpoints are neither authenticated nor faulted
+	operation hook.ControlPoint
 }
 
 func (h *cloudapiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	path := r.URL.Path
 	// handle trailing slash in the path
 	if strings.HasSuffix(path, "/") && path != "/" {
-		ErrNotFound.ServeHTTP(w, r)
+		toHTTPError(ErrNotFound).ServeHTTP(w, r)
 		return
 	}
-	err := h.method(h.cloudapi, w, r, p)
+	if !h.admin {
+		operations, machineID := requestOperations(h.operation, r, p)
+		if f := h.cloudapi.fault(r, operations, machineID); f != nil {
+			serve := func(w http.ResponseWriter) { h.serve(w, r, p) }
+			if h.cloudapi.injectFault(f, w, r, serve) {
+				return
+			}
+		}
+	}
+	h.serve(w, r, p)
+}
+
+func (h *cloudapiHandler) serve(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	var err error
+	if !h.admin {
+		err = h.cloudapi.authenticate(r)
+	}
 	if err == nil {
-		return
+		err = h.method(h.cloudapi, w, r, p)
 	}
-	var resp http.Handler
-	resp, _ = err.(http.Handler)
-	if resp == nil {
-		resp = &ErrorResponse{
-			http.StatusInternalServerError,
-			`{"internalServerError":{"message":"Unkown Error",code:500}}`,
-			"application/json",
-			err.Error(),
-			nil,
-			h.cloudapi,
-		}
+	if err == nil {
+		return
 	}
-	resp.ServeHTTP(w, r)
+	toHTTPError(err).ServeHTTP(w, r)
 }
 
 func writeResponse(w http.ResponseWriter, code int, body []byte) {
@@ -146,8 +135,13 @@ func processFilter(rawQuery string) map[string]string {
 	return filters
 }
 
-func (c *CloudAPI) handler(method func(m *CloudAPI, w http.ResponseWriter, r *http.Request, p httprouter.Params) error) httprouter.Handle {
-	handler := &cloudapiHandler{c, method}
+func (c *CloudAPI) handler(operation hook.ControlPoint, method func(m *CloudAPI, w http.ResponseWriter, r *http.Request, p httprouter.Params) error) httprouter.Handle {
+	handler := &cloudapiHandler{c, method, false, operation}
+	return handler.ServeHTTP
+}
+
+func (c *CloudAPI) adminHandler(method func(m *CloudAPI, w http.ResponseWriter, r *http.Request, p httprouter.Params) error) httprouter.Handle {
+	handler := &cloudapiHandler{c, method, true, ""}
 	return handler.ServeHTTP
 }
 
@@ -167,7 +161,7 @@ func (c *CloudAPI) handleListKeys(w http.ResponseWriter, r *http.Request, params
 func (c *CloudAPI) handleGetKey(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
 	key, err := c.GetKey(params.ByName("id"))
 	if err != nil {
-		return err // TODO: 404 if key not found
+		return err
 	}
 	if key == nil {
 		key = &cloudapi.Key{}
@@ -202,7 +196,7 @@ func (c *CloudAPI) handleCreateKey(w http.ResponseWriter, r *http.Request, param
 func (c *CloudAPI) handleDeleteKey(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
 	err := c.DeleteKey(params.ByName("id"))
 	if err != nil {
-		return err // TODO: handle 404
+		return err
 	}
 
 	return sendJSON(http.StatusNoContent, nil, w, r)
@@ -224,7 +218,7 @@ func (c *CloudAPI) handleListImages(w http.ResponseWriter, r *http.Request, para
 func (c *CloudAPI) handleGetImage(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
 	image, err := c.GetImage(params.ByName("id"))
 	if err != nil {
-		return err // TODO: 404
+		return err
 	}
 	if image == nil {
 		image = &cloudapi.Image{}
@@ -240,7 +234,7 @@ func (c *CloudAPI) handleDeleteImage(w http.ResponseWriter, r *http.Request, par
 	// TODO: implement c.DeleteImage
 	// err := c.DeleteImage(params.ByName("id"))
 	// if err != nil {
-	// 	return err // TODO: 404
+	// 	return err
 	// }
 	// return sendJSON(http.StatusNoContent, nil, w, r)
 	return ErrNotAllowed
@@ -262,7 +256,7 @@ func (c *CloudAPI) handleListPackages(w http.ResponseWriter, r *http.Request, pa
 func (c *CloudAPI) handleGetPackage(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
 	pkg, err := c.GetPackage(params.ByName("id"))
 	if err != nil {
-		return err // TODO: 404
+		return err
 	}
 	if pkg == nil {
 		pkg = &cloudapi.Package{}
@@ -294,7 +288,7 @@ func (c *CloudAPI) handleCountMachines(w http.ResponseWriter, r *http.Request, p
 func (c *CloudAPI) handleGetMachine(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
 	machine, err := c.GetMachine(params.ByName("id"))
 	if err != nil {
-		return err // TODO: 404
+		return err
 	}
 	if machine == nil {
 		machine = &cloudapi.Machine{}
@@ -364,38 +358,15 @@ func (c *CloudAPI) handleCreateMachine(w http.ResponseWriter, r *http.Request, p
 }
 
 func (c *CloudAPI) handleUpdateMachine(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
-	var (
-		err error
-		id  = params.ByName("id")
-	)
-
-	switch r.URL.Query().Get("action") {
-	case "stop":
-		err = c.StopMachine(id)
-
-	case "start":
-		err = c.StartMachine(id)
-
-	case "reboot":
-		err = c.RebootMachine(id)
-
-	case "resize":
-		err = c.ResizeMachine(id, r.URL.Query().Get("package"))
-
-	case "rename":
-		err = c.RenameMachine(id, r.URL.Query().Get("name"))
-
-	case "enable_firewall":
-		err = c.EnableFirewallMachine(id)
-
-	case "disable_firewall":
-		err = c.DisableFirewallMachine(id)
-
-	default:
+	query := r.URL.Query()
+	if _, ok := machineActions[query.Get("action")]; !ok {
 		return ErrNotAllowed
 	}
-
-	if err != nil {
+	options := map[string]string{
+		"package": query.Get("package"),
+		"name":    query.Get("name"),
+	}
+	if err := c.UpdateMachine(params.ByName("id"), query.Get("action"), options); err != nil {
 		return err
 	}
 	return sendJSON(http.StatusAccepted, nil, w, r)
@@ -404,15 +375,15 @@ func (c *CloudAPI) handleUpdateMachine(w http.ResponseWriter, r *http.Request, p
 func (c *CloudAPI) handleDeleteMachine(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
 	err := c.DeleteMachine(params.ByName("id"))
 	if err != nil {
-		return err // TODO: 404
+		return err
 	}
 	return sendJSON(http.StatusNoContent, nil, w, r)
 }
 
-func (c *CloudAPI) handleMachineFirewallRules(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+func (c *CloudAPI) handleListMachineFirewallRules(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
 	rules, err := c.ListMachineFirewallRules(params.ByName("id"))
 	if err != nil {
-		return err // TODO: 404
+		return err
 	}
 	if rules == nil {
 		rules = []*cloudapi.FirewallRule{}
@@ -557,6 +528,65 @@ func (c *CloudAPI) handleGetMachineTag(w http.ResponseWriter, r *http.Request, p
 	return nil
 }
 
+// machine snapshots
+
+func (c *CloudAPI) handleListMachineSnapshots(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	snapshots, err := c.ListMachineSnapshots(params.ByName("id"))
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(http.StatusOK, snapshots, w, r)
+}
+
+func (c *CloudAPI) handleCreateMachineSnapshot(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	opts := new(cloudapi.SnapshotOpts)
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		return err
+	}
+	if len(body) > 0 {
+		if err = json.Unmarshal(body, opts); err != nil {
+			return err
+		}
+	}
+
+	snapshot, err := c.CreateMachineSnapshot(params.ByName("id"), opts.Name)
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(http.StatusCreated, snapshot, w, r)
+}
+
+func (c *CloudAPI) handleGetMachineSnapshot(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	snapshot, err := c.GetMachineSnapshot(params.ByName("id"), params.ByName("name"))
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(http.StatusOK, snapshot, w, r)
+}
+
+func (c *CloudAPI) handleStartMachineFromSnapshot(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	err := c.StartMachineFromSnapshot(params.ByName("id"), params.ByName("name"))
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(http.StatusAccepted, nil, w, r)
+}
+
+func (c *CloudAPI) handleDeleteMachineSnapshot(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	err := c.DeleteMachineSnapshot(params.ByName("id"), params.ByName("name"))
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(http.StatusNoContent, nil, w, r)
+}
+
 // NICs
 
 func (c *CloudAPI) handleListNICs(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
@@ -627,7 +657,7 @@ func (c *CloudAPI) handleListFirewallRules(w http.ResponseWriter, r *http.Reques
 func (c *CloudAPI) handleGetFirewallRule(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
 	rule, err := c.GetFirewallRule(params.ByName("id"))
 	if err != nil {
-		return err // TODO: 404
+		return err
 	}
 	if rule == nil {
 		rule = &cloudapi.FirewallRule{}
@@ -673,7 +703,7 @@ func (c *CloudAPI) handleUpdateFirewallRule(w http.ResponseWriter, r *http.Reque
 
 	rule, err := c.UpdateFirewallRule(params.ByName("id"), opts.Rule, opts.Enabled)
 	if err != nil {
-		return err // TODO: 404
+		return err
 	}
 	if rule == nil {
 		rule = new(cloudapi.FirewallRule)
@@ -692,7 +722,7 @@ func (c *CloudAPI) handleDeleteFirewallRule(w http.ResponseWriter, r *http.Reque
 func (c *CloudAPI) handleEnableFirewallRule(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
 	rule, err := c.EnableFirewallRule(params.ByName("id"))
 	if err != nil {
-		return err // TODO: 404
+		return err
 	}
 	if rule == nil {
 		rule = new(cloudapi.FirewallRule)
@@ -703,7 +733,7 @@ func (c *CloudAPI) handleEnableFirewallRule(w http.ResponseWriter, r *http.Reque
 func (c *CloudAPI) handleDisableFirewallRule(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
 	rule, err := c.DisableFirewallRule(params.ByName("id"))
 	if err != nil {
-		return err // TODO: 404
+		return err
 	}
 	if rule == nil {
 		rule = new(cloudapi.FirewallRule)
@@ -727,7 +757,7 @@ func (c *CloudAPI) handleListNetworks(w http.ResponseWriter, r *http.Request, pa
 func (c *CloudAPI) handleGetNetwork(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
 	network, err := c.GetNetwork(params.ByName("id"))
 	if err != nil {
-		return err // TODO: 404
+		return err
 	}
 	if network == nil {
 		network = new(cloudapi.Network)
@@ -735,9 +765,56 @@ func (c *CloudAPI) handleGetNetwork(w http.ResponseWriter, r *http.Request, para
 	return sendJSON(http.StatusOK, network, w, r)
 }
 
+func (c *CloudAPI) handleListNetworkIPs(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	ips, err := c.ListNetworkIPs(params.ByName("id"))
+	if err != nil {
+		return err
+	}
+	return sendJSON(http.StatusOK, ips, w, r)
+}
+
+func (c *CloudAPI) handleGetNetworkIP(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	ip, err := c.GetNetworkIP(params.ByName("id"), params.ByName("ip"))
+	if err != nil {
+		return err
+	}
+	return sendJSON(http.StatusOK, ip, w, r)
+}
+
+type updateNetworkIPOptions struct {
+	Reserved *bool `json:"reserved"`
+}
+
+func (c *CloudAPI) handleUpdateNetworkIP(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	opts := new(updateNetworkIPOptions)
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if len(body) == 0 {
+		return ErrBadRequest
+	}
+	if err = json.Unmarshal(body, opts); err != nil {
+		return err
+	}
+	if opts.Reserved == nil {
+		return NewError(CodeMissingParameter, "reserved is required")
+	}
+
+	ip, err := c.UpdateNetworkIP(params.ByName("id"), params.ByName("ip"), *opts.Reserved)
+	if err != nil {
+		return err
+	}
+	return sendJSON(http.StatusOK, ip, w, r)
+}
+
 // Fabrics + VLANs and Networks
 
 func (c *CloudAPI) handleListFabricVLANs(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	if err := checkFabric(params.ByName("fabric")); err != nil {
+		return err
+	}
+
 	vlans, err := c.ListFabricVLANs()
 	if err != nil {
 		return err
@@ -747,6 +824,10 @@ func (c *CloudAPI) handleListFabricVLANs(w http.ResponseWriter, r *http.Request,
 }
 
 func (c *CloudAPI) handleCreateFabricVLAN(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	if err := checkFabric(params.ByName("fabric")); err != nil {
+		return err
+	}
+
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		return err
@@ -769,12 +850,16 @@ func (c *CloudAPI) handleCreateFabricVLAN(w http.ResponseWriter, r *http.Request
 }
 
 func (c *CloudAPI) handleGetFabricVLAN(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
-	id, err := strconv.Atoi(params.ByName("id"))
+	if err := checkFabric(params.ByName("fabric")); err != nil {
+		return err
+	}
+
+	id, err := vlanParam(params)
 	if err != nil {
 		return err
 	}
 
-	vlan, err := c.GetFabricVLAN(int16(id))
+	vlan, err := c.GetFabricVLAN(id)
 	if err != nil {
 		return err
 	}
@@ -783,6 +868,10 @@ func (c *CloudAPI) handleGetFabricVLAN(w http.ResponseWriter, r *http.Request, p
 }
 
 func (c *CloudAPI) handleUpdateFabricVLAN(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	if err := checkFabric(params.ByName("fabric")); err != nil {
+		return err
+	}
+
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		return err
@@ -805,12 +894,16 @@ func (c *CloudAPI) handleUpdateFabricVLAN(w http.ResponseWriter, r *http.Request
 }
 
 func (c *CloudAPI) handleDeleteFabricVLAN(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
-	id, err := strconv.Atoi(params.ByName("id"))
+	if err := checkFabric(params.ByName("fabric")); err != nil {
+		return err
+	}
+
+	id, err := vlanParam(params)
 	if err != nil {
 		return err
 	}
 
-	err = c.DeleteFabricVLAN(int16(id))
+	err = c.DeleteFabricVLAN(id)
 	if err != nil {
 		return err
 	}
@@ -819,12 +912,16 @@ func (c *CloudAPI) handleDeleteFabricVLAN(w http.ResponseWriter, r *http.Request
 }
 
 func (c *CloudAPI) handleListFabricNetworks(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
-	id, err := strconv.Atoi(params.ByName("id"))
+	if err := checkFabric(params.ByName("fabric")); err != nil {
+		return err
+	}
+
+	id, err := vlanParam(params)
 	if err != nil {
 		return err
 	}
 
-	networks, err := c.ListFabricNetworks(int16(id))
+	networks, err := c.ListFabricNetworks(id)
 	if err != nil {
 		return err
 	}
@@ -833,7 +930,11 @@ func (c *CloudAPI) handleListFabricNetworks(w http.ResponseWriter, r *http.Reque
 }
 
 func (c *CloudAPI) handleCreateFabricNetwork(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
-	id, err := strconv.Atoi(params.ByName("id"))
+	if err := checkFabric(params.ByName("fabric")); err != nil {
+		return err
+	}
+
+	id, err := vlanParam(params)
 	if err != nil {
 		return err
 	}
@@ -851,7 +952,7 @@ func (c *CloudAPI) handleCreateFabricNetwork(w http.ResponseWriter, r *http.Requ
 		return err
 	}
 
-	network, err := c.CreateFabricNetwork(int16(id), opts)
+	network, err := c.CreateFabricNetwork(id, opts)
 	if err != nil {
 		return err
 	}
@@ -860,12 +961,16 @@ func (c *CloudAPI) handleCreateFabricNetwork(w http.ResponseWriter, r *http.Requ
 }
 
 func (c *CloudAPI) handleGetFabricNetwork(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
-	id, err := strconv.Atoi(params.ByName("id"))
+	if err := checkFabric(params.ByName("fabric")); err != nil {
+		return err
+	}
+
+	id, err := vlanParam(params)
 	if err != nil {
 		return err
 	}
 
-	network, err := c.GetFabricNetwork(int16(id), params.ByName("network"))
+	network, err := c.GetFabricNetwork(id, params.ByName("network"))
 	if err != nil {
 		return err
 	}
@@ -873,13 +978,48 @@ func (c *CloudAPI) handleGetFabricNetwork(w http.ResponseWriter, r *http.Request
 	return sendJSON(http.StatusOK, network, w, r)
 }
 
+func (c *CloudAPI) handleUpdateFabricNetwork(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	if err := checkFabric(params.ByName("fabric")); err != nil {
+		return err
+	}
+
+	id, err := vlanParam(params)
+	if err != nil {
+		return err
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if len(body) == 0 {
+		return ErrBadRequest
+	}
+
+	var opts cloudapi.UpdateFabricNetworkOpts
+	if err = json.Unmarshal(body, &opts); err != nil {
+		return err
+	}
+
+	network, err := c.UpdateFabricNetwork(id, params.ByName("network"), opts)
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(http.StatusAccepted, network, w, r)
+}
+
 func (c *CloudAPI) handleDeleteFabricNetwork(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
-	id, err := strconv.Atoi(params.ByName("id"))
+	if err := checkFabric(params.ByName("fabric")); err != nil {
+		return err
+	}
+
+	id, err := vlanParam(params)
 	if err != nil {
 		return err
 	}
 
-	err = c.DeleteFabricNetwork(int16(id), params.ByName("network"))
+	err = c.DeleteFabricNetwork(id, params.ByName("network"))
 	if err != nil {
 		return err
 	}
@@ -887,12 +1027,196 @@ func (c *CloudAPI) handleDeleteFabricNetwork(w http.ResponseWriter, r *http.Requ
 	return sendJSON(http.StatusNoContent, nil, w, r)
 }
 
+// Analytics
+
+func (c *CloudAPI) handleDescribeAnalytics(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	analytics, err := c.DescribeAnalytics()
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(http.StatusOK, analytics, w, r)
+}
+
+func (c *CloudAPI) handleListInstrumentations(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instrumentations, err := c.ListInstrumentations()
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(http.StatusOK, instrumentations, w, r)
+}
+
+func (c *CloudAPI) handleCreateInstrumentation(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	var opts cloudapi.CreateInstrumentationOpts
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+	if err != nil {
+		return err
+	}
+	if len(body) > 0 {
+		if err = json.Unmarshal(body, &opts); err != nil {
+			return err
+		}
+		// The double does not apply transformations, so it refuses those
+		// requested rather than dropping them.
+		var requested struct {
+			Transformations []string `json:"transformations"`
+		}
+		if err = json.Unmarshal(body, &requested); err != nil {
+			return err
+		}
+		if len(requested.Transformations) > 0 {
+			return invalidArgumentError("Transformations cannot be requested when creating an instrumentation")
+		}
+	}
+
+	instrumentation, err := c.CreateInstrumentation(opts)
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(http.StatusCreated, instrumentation, w, r)
+}
+
+func (c *CloudAPI) handleGetInstrumentation(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instrumentation, err := c.GetInstrumentation(params.ByName("id"))
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(http.StatusOK, instrumentation, w, r)
+}
+
+func (c *CloudAPI) handleDeleteInstrumentation(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	err := c.DeleteInstrumentation(params.ByName("id"))
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(http.StatusNoContent, nil, w, r)
+}
+
+// queryInt returns the integer value of a query parameter, or 0 if it is not set
+func queryInt(r *http.Request, name string) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, invalidArgumentError("Invalid %s %q", name, value)
+	}
+	return n, nil
+}
+
+// vlanParam returns the VLAN ID of the request path
+func vlanParam(params httprouter.Params) (int16, error) {
+	id, err := strconv.ParseInt(params.ByName("id"), 10, 16)
+	if err != nil {
+		return 0, invalidArgumentError("Invalid VLAN id %q", params.ByName("id"))
+	}
+	return int16(id), nil
+}
+
+// heatmapOpts reads heatmap options from the request query
+func heatmapOpts(r *http.Request) (cloudapi.HeatmapOpts, error) {
+	var (
+		opts cloudapi.HeatmapOpts
+		err  error
+	)
+	fields := map[string]*int{
+		"height":   &opts.Height,
+		"width":    &opts.Width,
+		"ymin":     &opts.Ymin,
+		"ymax":     &opts.Ymax,
+		"nbuckets": &opts.Nbuckets,
+		"x":        &opts.X,
+		"y":        &opts.Y,
+	}
+	for name, field := range fields {
+		if *field, err = queryInt(r, name); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+func (c *CloudAPI) handleGetInstrumentationValue(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	startTime, err := queryInt(r, "start_time")
+	if err != nil {
+		return err
+	}
+
+	value, err := c.GetInstrumentationValue(params.ByName("id"), startTime)
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(http.StatusOK, value, w, r)
+}
+
+func (c *CloudAPI) handleGetInstrumentationHeatmap(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	opts, err := heatmapOpts(r)
+	if err != nil {
+		return err
+	}
+
+	heatmap, err := c.GetInstrumentationHeatmap(params.ByName("id"), opts)
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(http.StatusOK, heatmap, w, r)
+}
+
+func (c *CloudAPI) handleGetInstrumentationHeatmapDetails(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	opts, err := heatmapOpts(r)
+	if err != nil {
+		return err
+	}
+
+	heatmap, err := c.GetInstrumentationHeatmapDetails(params.ByName("id"), opts)
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(http.StatusOK, heatmap, w, r)
+}
+
+// Datacenters
+
+func (c *CloudAPI) handleListDatacenters(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	datacenters, err := c.ListDatacenters()
+	if err != nil {
+		return err
+	}
+
+	return sendJSON(http.StatusOK, datacenters, w, r)
+}
+
+func (c *CloudAPI) handleGetDatacenter(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	name := params.ByName("name")
+	url, err := c.GetDatacenter(name)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Location", url)
+	return sendJSON(http.StatusFound, map[string]string{
+		"code":    "ResourceMoved",
+		"message": name + " " + url,
+	}, w, r)
+}
+
 // ListServices handler
 
-func (c *CloudAPI) handleGetServices(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
-	services := map[string]string{
-		"cloudapi": "https://us-west-1.api.example.com",
+func (c *CloudAPI) handleListServices(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	services, err := c.ListServices()
+	if err != nil {
+		return err
 	}
+
 	return sendJSON(http.StatusOK, services, w, r)
 }
 
@@ -901,143 +1225,271 @@ func (c *CloudAPI) handleGetServices(w http.ResponseWriter, r *http.Request, par
 type NotFound struct{}
 
 func (NotFound) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNotFound)
-	w.Write([]byte("Resource Not Found"))
+	toHTTPError(ErrNotFound).ServeHTTP(w, r)
 }
 
 type MethodNotAllowed struct{}
 
 func (MethodNotAllowed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusMethodNotAllowed)
-	w.Write([]byte("Method is not allowed"))
+	toHTTPError(ErrNotAllowed).ServeHTTP(w, r)
 }
 
-// SetupHTTP attaches all the needed handlers to provide the HTTP API.
+// admin
+
+func (c *CloudAPI) handleCreateCheckpoint(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	id := c.Checkpoint()
+	return sendJSON(http.StatusCreated, map[string]string{"id": id}, w, r)
+}
+
+func (c *CloudAPI) handleUpdateCheckpoint(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	switch r.URL.Query().Get("action") {
+	case "restore":
+		if err := c.Restore(params.ByName("id")); err != nil {
+			return err
+		}
+	default:
+		return ErrNotAllowed
+	}
+	return sendJSON(http.StatusNoContent, nil, w, r)
+}
+
+func (c *CloudAPI) handleReset(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	c.Reset()
+	return sendJSON(http.StatusNoContent, nil, w, r)
+}
+
+func (c *CloudAPI) handleListFaults(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	return sendJSON(http.StatusOK, c.Faults(), w, r)
+}
+
+func (c *CloudAPI) handleAddFault(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	fault := Fault{}
+	body, err := ioutil.ReadAll(r.Body)
+	defer r.Body.Close()
+
+	if err != nil {
+		return err
+	}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &fault); err != nil {
+			return err
+		}
+	}
+
+	added, err := c.AddFault(fault)
+	if err != nil {
+		return err
+	}
+	return sendJSON(http.StatusCreated, added, w, r)
+}
+
+func (c *CloudAPI) handleClearFaults(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	c.ClearFaults()
+	return sendJSON(http.StatusNoContent, nil, w, r)
+}
+
+func (c *CloudAPI) handleRemoveFault(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	if err := c.RemoveFault(params.ByName("id")); err != nil {
+		return err
+	}
+	return sendJSON(http.StatusNoContent, nil, w, r)
+}
+
+// SetupHTTP attaches all the needed handlers to provide the HTTP API of
+// every account of the double, including those added later with AddAccount.
 func (c *CloudAPI) SetupHTTP(mux *httprouter.Router) {
-	baseRoute := "/" + c.ServiceInstance.UserAccount
+	c = c.primary
 
-	mux.NotFound = NotFound{}
+	// requests to other accounts fall through the routes of the primary one
+	mux.NotFound = accountsHandler{c}
 	mux.MethodNotAllowed = MethodNotAllowed{}
 
+	c.setupAccountHTTP(mux)
+
+	// admin
+	checkpointsRoute := AdminRoute + "/checkpoints"
+	mux.POST(checkpointsRoute, c.adminHandler((*CloudAPI).handleCreateCheckpoint))
+	mux.POST(checkpointsRoute+"/:id", c.adminHandler((*CloudAPI).handleUpdateCheckpoint))
+	mux.POST(AdminRoute+"/reset", c.adminHandler((*CloudAPI).handleReset))
+	faultsRoute := AdminRoute + "/faults"
+	mux.GET(faultsRoute, c.adminHandler((*CloudAPI).handleListFaults))
+	mux.POST(faultsRoute, c.adminHandler((*CloudAPI).handleAddFault))
+	mux.DELETE(faultsRoute, c.adminHandler((*CloudAPI).handleClearFaults))
+	mux.DELETE(faultsRoute+"/:id", c.adminHandler((*CloudAPI).handleRemoveFault))
+}
+
+// setupAccountHTTP attaches the handlers of the account, rooted at its login.
+func (c *CloudAPI) setupAccountHTTP(mux *httprouter.Router) {
+	baseRoute := "/" + c.ServiceInstance.UserAccount
+
 	// keys
 	keysRoute := baseRoute + "/keys"
-	mux.GET(keysRoute, c.handler((*CloudAPI).handleListKeys))
-	mux.POST(keysRoute, c.handler((*CloudAPI).handleCreateKey))
+	mux.GET(keysRoute, c.handler(HookListKeys, (*CloudAPI).handleListKeys))
+	mux.POST(keysRoute, c.handler(HookCreateKey, (*CloudAPI).handleCreateKey))
 
 	// key
 	keyRoute := keysRoute + "/:id"
-	mux.GET(keyRoute, c.handler((*CloudAPI).handleGetKey))
-	mux.DELETE(keyRoute, c.handler((*CloudAPI).handleDeleteKey))
+	mux.GET(keyRoute, c.handler(HookGetKey, (*CloudAPI).handleGetKey))
+	mux.DELETE(keyRoute, c.handler(HookDeleteKey, (*CloudAPI).handleDeleteKey))
 
 	// images
 	imagesRoute := baseRoute + "/images"
-	mux.GET(imagesRoute, c.handler((*CloudAPI).handleListImages))
+	mux.GET(imagesRoute, c.handler(HookListImages, (*CloudAPI).handleListImages))
 
 	// image
 	imageRoute := imagesRoute + "/:id"
-	mux.GET(imageRoute, c.handler((*CloudAPI).handleGetImage))
-	mux.POST(imageRoute, c.handler((*CloudAPI).handleCreateImageFromMachine))
-	mux.DELETE(imageRoute, c.handler((*CloudAPI).handleDeleteImage))
+	mux.GET(imageRoute, c.handler(HookGetImage, (*CloudAPI).handleGetImage))
+	mux.POST(imageRoute, c.handler(HookCreateImageFromMachine, (*CloudAPI).handleCreateImageFromMachine))
+	mux.DELETE(imageRoute, c.handler(HookDeleteImage, (*CloudAPI).handleDeleteImage))
 
 	// packages
 	packagesRoute := baseRoute + "/packages"
-	mux.GET(packagesRoute, c.handler((*CloudAPI).handleListPackages))
+	mux.GET(packagesRoute, c.handler(HookListPackages, (*CloudAPI).handleListPackages))
 
 	// package
 	packageRoute := packagesRoute + "/:id"
-	mux.GET(packageRoute, c.handler((*CloudAPI).handleGetPackage))
+	mux.GET(packageRoute, c.handler(HookGetPackage, (*CloudAPI).handleGetPackage))
 
 	// machines
 	machinesRoute := baseRoute + "/machines"
-	mux.GET(machinesRoute, c.handler((*CloudAPI).handleListMachines))
-	mux.HEAD(machinesRoute, c.handler((*CloudAPI).handleCountMachines))
-	mux.POST(machinesRoute, c.handler((*CloudAPI).handleCreateMachine))
+	mux.GET(machinesRoute, c.handler(HookListMachines, (*CloudAPI).handleListMachines))
+	mux.HEAD(machinesRoute, c.handler(HookCountMachines, (*CloudAPI).handleCountMachines))
+	mux.POST(machinesRoute, c.handler(HookCreateMachine, (*CloudAPI).handleCreateMachine))
 
 	// machine
 	machineRoute := machinesRoute + "/:id"
-	mux.GET(machineRoute, c.handler((*CloudAPI).handleGetMachine))
-	mux.POST(machineRoute, c.handler((*CloudAPI).handleUpdateMachine))
-	mux.DELETE(machineRoute, c.handler((*CloudAPI).handleDeleteMachine))
+	mux.GET(machineRoute, c.handler(HookGetMachine, (*CloudAPI).handleGetMachine))
+	mux.POST(machineRoute, c.handler(HookUpdateMachine, (*CloudAPI).handleUpdateMachine))
+	mux.DELETE(machineRoute, c.handler(HookDeleteMachine, (*CloudAPI).handleDeleteMachine))
 
 	// machine metadata
 	machineMetadataRoute := machineRoute + "/metadata"
-	mux.GET(machineMetadataRoute, c.handler((*CloudAPI).handleGetMachineMetadata))
-	mux.POST(machineMetadataRoute, c.handler((*CloudAPI).handleUpdateMachineMetadata))
-	mux.DELETE(machineMetadataRoute, c.handler((*CloudAPI).handleDeleteAllMachineMetadata))
+	mux.GET(machineMetadataRoute, c.handler(HookGetMachineMetadata, (*CloudAPI).handleGetMachineMetadata))
+	mux.POST(machineMetadataRoute, c.handler(HookUpdateMachineMetadata, (*CloudAPI).handleUpdateMachineMetadata))
+	mux.DELETE(machineMetadataRoute, c.handler(HookDeleteAllMachineMetadata, (*CloudAPI).handleDeleteAllMachineMetadata))
 
 	// machine metadata (individual key)
 	machineMetadataKeyRoute := machineMetadataRoute + "/:key"
-	mux.DELETE(machineMetadataKeyRoute, c.handler((*CloudAPI).handleDeleteMachineMetadata))
+	mux.DELETE(machineMetadataKeyRoute, c.handler(HookDeleteMachineMetadata, (*CloudAPI).handleDeleteMachineMetadata))
 
 	// machine tags
 	machineTagsRoute := machineRoute + "/tags"
-	mux.GET(machineTagsRoute, c.handler((*CloudAPI).handleListMachineTags))
-	mux.POST(machineTagsRoute, c.handler((*CloudAPI).handleAddMachineTags))
-	mux.PUT(machineTagsRoute, c.handler((*CloudAPI).handleReplaceMachineTags))
-	mux.DELETE(machineTagsRoute, c.handler((*CloudAPI).handleDeleteMachineTags))
+	mux.GET(machineTagsRoute, c.handler(HookListMachineTags, (*CloudAPI).handleListMachineTags))
+	mux.POST(machineTagsRoute, c.handler(HookAddMachineTags, (*CloudAPI).handleAddMachineTags))
+	mux.PUT(machineTagsRoute, c.handler(HookReplaceMachineTags, (*CloudAPI).handleReplaceMachineTags))
+	mux.DELETE(machineTagsRoute, c.handler(HookDeleteMachineTags, (*CloudAPI).handleDeleteMachineTags))
 
 	// machine tag
 	machineTagRoute := machineTagsRoute + "/:tag"
-	mux.GET(machineTagRoute, c.handler((*CloudAPI).handleGetMachineTag))
-	mux.DELETE(machineTagRoute, c.handler((*CloudAPI).handleDeleteMachineTag))
+	mux.GET(machineTagRoute, c.handler(HookGetMachineTag, (*CloudAPI).handleGetMachineTag))
+	mux.DELETE(machineTagRoute, c.handler(HookDeleteMachineTag, (*CloudAPI).handleDeleteMachineTag))
 
 	// machine firewall rules
 	machineFWRulesRoute := machineRoute + "/fwrules"
-	mux.GET(machineFWRulesRoute, c.handler((*CloudAPI).handleMachineFirewallRules))
+	mux.GET(machineFWRulesRoute, c.handler(HookListMachineFirewallRules, (*CloudAPI).handleListMachineFirewallRules))
+
+	// machine snapshots
+	machineSnapshotsRoute := machineRoute + "/snapshots"
+	mux.GET(machineSnapshotsRoute, c.handler(HookListMachineSnapshots, (*CloudAPI).handleListMachineSnapshots))
+	mux.POST(machineSnapshotsRoute, c.handler(HookCreateMachineSnapshot, (*CloudAPI).handleCreateMachineSnapshot))
+
+	// machine snapshot
+	machineSnapshotRoute := machineSnapshotsRoute + "/:name"
+	mux.GET(machineSnapshotRoute, c.handler(HookGetMachineSnapshot, (*CloudAPI).handleGetMachineSnapshot))
+	mux.POST(machineSnapshotRoute, c.handler(HookStartMachineFromSnapshot, (*CloudAPI).handleStartMachineFromSnapshot))
+	mux.DELETE(machineSnapshotRoute, c.handler(HookDeleteMachineSnapshot, (*CloudAPI).handleDeleteMachineSnapshot))
 
 	// machine NICs
 	machineNICsRoute := machineRoute + "/nics"
-	mux.GET(machineNICsRoute, c.handler((*CloudAPI).handleListNICs))
-	mux.POST(machineNICsRoute, c.handler((*CloudAPI).handleAddNIC))
+	mux.GET(machineNICsRoute, c.handler(HookListNICs, (*CloudAPI).handleListNICs))
+	mux.POST(machineNICsRoute, c.handler(HookAddNIC, (*CloudAPI).handleAddNIC))
 
 	// machine NIC
 	machineNICRoute := machineNICsRoute + "/:mac"
-	mux.GET(machineNICRoute, c.handler((*CloudAPI).handleGetNIC))
-	mux.DELETE(machineNICRoute, c.handler((*CloudAPI).handleRemoveNIC))
+	mux.GET(machineNICRoute, c.handler(HookGetNIC, (*CloudAPI).handleGetNIC))
+	mux.DELETE(machineNICRoute, c.handler(HookRemoveNIC, (*CloudAPI).handleRemoveNIC))
 
 	// firewall rules
 	firewallRulesRoute := baseRoute + "/fwrules"
-	mux.GET(firewallRulesRoute, c.handler((*CloudAPI).handleListFirewallRules))
-	mux.POST(firewallRulesRoute, c.handler((*CloudAPI).handleCreateFirewallRule))
+	mux.GET(firewallRulesRoute, c.handler(HookListFirewallRules, (*CloudAPI).handleListFirewallRules))
+	mux.POST(firewallRulesRoute, c.handler(HookCreateFirewallRule, (*CloudAPI).handleCreateFirewallRule))
 
 	// firewall rule
 	firewallRuleRoute := firewallRulesRoute + "/:id"
-	mux.GET(firewallRuleRoute, c.handler((*CloudAPI).handleGetFirewallRule))
-	mux.POST(firewallRuleRoute, c.handler((*CloudAPI).handleUpdateFirewallRule))
-	mux.DELETE(firewallRuleRoute, c.handler((*CloudAPI).handleDeleteFirewallRule))
-	mux.POST(firewallRuleRoute+"/enable", c.handler((*CloudAPI).handleEnableFirewallRule))
-	mux.POST(firewallRuleRoute+"/disable", c.handler((*CloudAPI).handleDisableFirewallRule))
+	mux.GET(firewallRuleRoute, c.handler(HookGetFirewallRule, (*CloudAPI).handleGetFirewallRule))
+	mux.POST(firewallRuleRoute, c.handler(HookUpdateFirewallRule, (*CloudAPI).handleUpdateFirewallRule))
+	mux.DELETE(firewallRuleRoute, c.handler(HookDeleteFirewallRule, (*CloudAPI).handleDeleteFirewallRule))
+	mux.POST(firewallRuleRoute+"/enable", c.handler(HookEnableFirewallRule, (*CloudAPI).handleEnableFirewallRule))
+	mux.POST(firewallRuleRoute+"/disable", c.handler(HookDisableFirewallRule, (*CloudAPI).handleDisableFirewallRule))
 
 	// networks
 	networksRoute := baseRoute + "/networks"
-	mux.GET(networksRoute, c.handler((*CloudAPI).handleListNetworks))
+	mux.GET(networksRoute, c.handler(HookListNetworks, (*CloudAPI).handleListNetworks))
 
 	// network
 	networkRoute := networksRoute + "/:id"
-	mux.GET(networkRoute, c.handler((*CloudAPI).handleGetNetwork))
+	mux.GET(networkRoute, c.handler(HookGetNetwork, (*CloudAPI).handleGetNetwork))
+
+	// network IPs
+	networkIPsRoute := networkRoute + "/ips"
+	mux.GET(networkIPsRoute, c.handler(HookListNetworkIPs, (*CloudAPI).handleListNetworkIPs))
+
+	// network IP
+	networkIPRoute := networkIPsRoute + "/:ip"
+	mux.GET(networkIPRoute, c.handler(HookGetNetworkIP, (*CloudAPI).handleGetNetworkIP))
+	mux.PUT(networkIPRoute, c.handler(HookUpdateNetworkIP, (*CloudAPI).handleUpdateNetworkIP))
 
 	// fabric VLANs
 	fabricVLANsRoute := baseRoute + "/fabrics/:fabric/vlans"
-	mux.GET(fabricVLANsRoute, c.handler((*CloudAPI).handleListFabricVLANs))
-	mux.POST(fabricVLANsRoute, c.handler((*CloudAPI).handleCreateFabricVLAN))
+	mux.GET(fabricVLANsRoute, c.handler(HookListFabricVLANs, (*CloudAPI).handleListFabricVLANs))
+	mux.POST(fabricVLANsRoute, c.handler(HookCreateFabricVLAN, (*CloudAPI).handleCreateFabricVLAN))
 
 	// fabric VLAN
 	fabricVLANRoute := fabricVLANsRoute + "/:id"
-	mux.GET(fabricVLANRoute, c.handler((*CloudAPI).handleGetFabricVLAN))
-	mux.PUT(fabricVLANRoute, c.handler((*CloudAPI).handleUpdateFabricVLAN))
-	mux.DELETE(fabricVLANRoute, c.handler((*CloudAPI).handleDeleteFabricVLAN))
+	mux.GET(fabricVLANRoute, c.handler(HookGetFabricVLAN, (*CloudAPI).handleGetFabricVLAN))
+	mux.PUT(fabricVLANRoute, c.handler(HookUpdateFabricVLAN, (*CloudAPI).handleUpdateFabricVLAN))
+	mux.DELETE(fabricVLANRoute, c.handler(HookDeleteFabricVLAN, (*CloudAPI).handleDeleteFabricVLAN))
 
 	// fabric VLAN networks
 	fabricVLANNetworksRoute := fabricVLANRoute + "/networks"
-	mux.GET(fabricVLANNetworksRoute, c.handler((*CloudAPI).handleListFabricNetworks))
-	mux.POST(fabricVLANNetworksRoute, c.handler((*CloudAPI).handleCreateFabricNetwork))
+	mux.GET(fabricVLANNetworksRoute, c.handler(HookListFabricNetworks, (*CloudAPI).handleListFabricNetworks))
+	mux.POST(fabricVLANNetworksRoute, c.handler(HookCreateFabricNetwork, (*CloudAPI).handleCreateFabricNetwork))
 
 	// fabric VLAN network
 	fabricVLANNetworkRoute := fabricVLANNetworksRoute + "/:network"
-	mux.GET(fabricVLANNetworkRoute, c.handler((*CloudAPI).handleGetFabricNetwork))
-	mux.DELETE(fabricVLANNetworkRoute, c.handler((*CloudAPI).handleDeleteFabricNetwork))
+	mux.GET(fabricVLANNetworkRoute, c.handler(HookGetFabricNetwork, (*CloudAPI).handleGetFabricNetwork))
+	mux.PUT(fabricVLANNetworkRoute, c.handler(HookUpdateFabricNetwork, (*CloudAPI).handleUpdateFabricNetwork))
+	mux.DELETE(fabricVLANNetworkRoute, c.handler(HookDeleteFabricNetwork, (*CloudAPI).handleDeleteFabricNetwork))
+
+	// analytics
+	analyticsRoute := baseRoute + "/analytics"
+	mux.GET(analyticsRoute, c.handler(HookDescribeAnalytics, (*CloudAPI).handleDescribeAnalytics))
+
+	// instrumentations
+	instrumentationsRoute := analyticsRoute + "/instrumentations"
+	mux.GET(instrumentationsRoute, c.handler(HookListInstrumentations, (*CloudAPI).handleListInstrumentations))
+	mux.POST(instrumentationsRoute, c.handler(HookCreateInstrumentation, (*CloudAPI).handleCreateInstrumentation))
+
+	// instrumentation
+	instrumentationRoute := instrumentationsRoute + "/:id"
+	mux.GET(instrumentationRoute, c.handler(HookGetInstrumentation, (*CloudAPI).handleGetInstrumentation))
+	mux.DELETE(instrumentationRoute, c.handler(HookDeleteInstrumentation, (*CloudAPI).handleDeleteInstrumentation))
+
+	// instrumentation values
+	instrumentationValueRoute := instrumentationRoute + "/value"
+	mux.GET(instrumentationValueRoute+"/raw", c.handler(HookGetInstrumentationValue, (*CloudAPI).handleGetInstrumentationValue))
+	mux.GET(instrumentationValueRoute+"/heatmap/image", c.handler(HookGetInstrumentationHeatmap, (*CloudAPI).handleGetInstrumentationHeatmap))
+	mux.GET(instrumentationValueRoute+"/heatmap/details", c.handler(HookGetInstrumentationHeatmapDetails, (*CloudAPI).handleGetInstrumentationHeatmapDetails))
+
+	// datacenters
+	datacentersRoute := baseRoute + "/datacenters"
+	mux.GET(datacentersRoute, c.handler(HookListDatacenters, (*CloudAPI).handleListDatacenters))
+
+	// datacenter
+	datacenterRoute := datacentersRoute + "/:name"
+	mux.GET(datacenterRoute, c.handler(HookGetDatacenter, (*CloudAPI).handleGetDatacenter))
 
 	// services
 	servicesRoute := baseRoute + "/services"
-	mux.GET(servicesRoute, c.handler((*CloudAPI).handleGetServices))
+	mux.GET(servicesRoute, c.handler(HookListServices, (*CloudAPI).handleListServices))
 }
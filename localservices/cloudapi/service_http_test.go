@@ -17,12 +17,14 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	gc "launchpad.net/gocheck"
 
 	"github.com/joyent/gocommon/testing"
 	"github.com/joyent/gosdc/cloudapi"
 	lc "github.com/joyent/gosdc/localservices/cloudapi"
+	"github.com/joyent/gosdc/localservices/hook"
 )
 
 type CloudAPIHTTPSuite struct {
@@ -80,6 +82,15 @@ func assertBody(c *gc.C, resp *http.Response, expected *lc.ErrorResponse) {
 	c.Assert(string(body), gc.Equals, string(expBody))
 }
 
+// errorResponse returns the response the double sends for an error.
+func errorResponse(e *lc.Error) *lc.ErrorResponse {
+	body, err := json.Marshal(e)
+	if err != nil {
+		panic(err)
+	}
+	return &lc.ErrorResponse{Code: e.StatusCode(), Body: string(body)}
+}
+
 // sendRequest constructs an HTTP request from the parameters and
 // sends it, returning the response or an error.
 func (s *CloudAPIHTTPSuite) sendRequest(method, path string, body []byte, headers http.Header) (*http.Response, error) {
@@ -196,109 +207,109 @@ func (s *CloudAPIHTTPSuite) simpleTests() []SimpleTest {
 			method:  "GET",
 			url:     "/",
 			headers: make(http.Header),
-			expect:  lc.ErrNotFound,
+			expect:  errorResponse(lc.ErrNotFound),
 		},
 		{
 			method:  "POST",
 			url:     "/",
 			headers: make(http.Header),
-			expect:  lc.ErrNotFound,
+			expect:  errorResponse(lc.ErrNotFound),
 		},
 		{
 			method:  "DELETE",
 			url:     "/",
 			headers: make(http.Header),
-			expect:  lc.ErrNotFound,
+			expect:  errorResponse(lc.ErrNotFound),
 		},
 		{
 			method:  "PUT",
 			url:     "/",
 			headers: make(http.Header),
-			expect:  lc.ErrNotFound,
+			expect:  errorResponse(lc.ErrNotFound),
 		},
 		{
 			method:  "GET",
 			url:     "/any",
 			headers: make(http.Header),
-			expect:  lc.ErrNotFound,
+			expect:  errorResponse(lc.ErrNotFound),
 		},
 		{
 			method:  "POST",
 			url:     "/any",
 			headers: make(http.Header),
-			expect:  lc.ErrNotFound,
+			expect:  errorResponse(lc.ErrNotFound),
 		},
 		{
 			method:  "DELETE",
 			url:     "/any",
 			headers: make(http.Header),
-			expect:  lc.ErrNotFound,
+			expect:  errorResponse(lc.ErrNotFound),
 		},
 		{
 			method:  "PUT",
 			url:     "/any",
 			headers: make(http.Header),
-			expect:  lc.ErrNotFound,
+			expect:  errorResponse(lc.ErrNotFound),
 		},
 		{
 			method:  "PUT",
 			url:     path.Join(testUserAccount, "keys"),
 			headers: make(http.Header),
-			expect:  lc.ErrNotAllowed,
+			expect:  errorResponse(lc.ErrNotAllowed),
 		},
 		{
 			method:  "PUT",
 			url:     path.Join(testUserAccount, "images"),
 			headers: make(http.Header),
-			expect:  lc.ErrNotAllowed,
+			expect:  errorResponse(lc.ErrNotAllowed),
 		},
 		{
 			method:  "POST",
 			url:     path.Join(testUserAccount, "packages"),
 			headers: make(http.Header),
-			expect:  lc.ErrNotAllowed,
+			expect:  errorResponse(lc.ErrNotAllowed),
 		},
 		{
 			method:  "PUT",
 			url:     path.Join(testUserAccount, "packages"),
 			headers: make(http.Header),
-			expect:  lc.ErrNotAllowed,
+			expect:  errorResponse(lc.ErrNotAllowed),
 		},
 		{
 			method:  "DELETE",
 			url:     path.Join(testUserAccount, "packages"),
 			headers: make(http.Header),
-			expect:  lc.ErrNotAllowed,
+			expect:  errorResponse(lc.ErrNotAllowed),
 		},
 		{
 			method:  "PUT",
 			url:     path.Join(testUserAccount, "machines"),
 			headers: make(http.Header),
-			expect:  lc.ErrNotAllowed,
+			expect:  errorResponse(lc.ErrNotAllowed),
 		},
 		{
 			method:  "PUT",
 			url:     path.Join(testUserAccount, "fwrules"),
 			headers: make(http.Header),
-			expect:  lc.ErrNotAllowed,
+			expect:  errorResponse(lc.ErrNotAllowed),
 		},
 		{
 			method:  "POST",
 			url:     path.Join(testUserAccount, "networks"),
 			headers: make(http.Header),
-			expect:  lc.ErrNotAllowed,
+			expect:  errorResponse(lc.ErrNotAllowed),
 		},
 		{
 			method:  "PUT",
 			url:     path.Join(testUserAccount, "networks"),
 			headers: make(http.Header),
-			expect:  lc.ErrNotAllowed,
+			expect:  errorResponse(lc.ErrNotAllowed),
 		},
 		{
 			method:  "DELETE",
 			url:     path.Join(testUserAccount, "networks"),
 			headers: make(http.Header),
-			expect:  lc.ErrNotAllowed,
+			expect:  errorResponse(lc.ErrNotAllowed),
 		},
 	}
 	return simpleTests
@@ -318,6 +329,7 @@ func (s *CloudAPIHTTPSuite) TestSimpleRequestTests(c *gc.C) {
 		resp, err = s.sendRequest(t.method, t.url, nil, t.headers)
 		c.Assert(err, gc.IsNil)
 		c.Assert(resp.StatusCode, gc.Equals, t.expect.Code)
+		c.Assert(resp.Header.Get("Content-Type"), gc.Equals, "application/json")
 		assertBody(c, resp, t.expect)
 	}
 }
@@ -365,6 +377,343 @@ func (s *CloudAPIHTTPSuite) TestDeleteKey(c *gc.C) {
 	s.deleteKey(c, testKeyName)
 }
 
+func (s *CloudAPIHTTPSuite) TestRequireSignatures(c *gc.C) {
+	s.createKey(c, testKeyName, testKey)
+	defer s.deleteKey(c, testKeyName)
+	s.service.RequireSignatures(true)
+	defer s.service.RequireSignatures(false)
+
+	date := time.Now().UTC().Format(time.RFC1123)
+	signed := func(keyID string) http.Header {
+		headers := make(http.Header)
+		headers.Set("Date", date)
+		headers.Set("Authorization", fmt.Sprintf(`Signature keyId="%s",algorithm="rsa-sha256" c2lnbmF0dXJl`, keyID))
+		return headers
+	}
+	staleHeaders := signed("/" + testUserAccount + "/keys/" + testKeyName)
+	staleHeaders.Set("Date", time.Now().Add(-time.Hour).UTC().Format(time.RFC1123))
+
+	tests := []SimpleTest{
+		{
+			method:  "GET",
+			url:     path.Join(testUserAccount, "keys"),
+			headers: make(http.Header),
+			expect: &lc.ErrorResponse{
+				Code: http.StatusUnauthorized,
+				Body: `{"code":"InvalidCredentials","message":"Authorization header is missing"}`,
+			},
+		},
+		{
+			method:  "GET",
+			url:     path.Join(testUserAccount, "keys"),
+			headers: signed("/" + testUserAccount + "/keys/unknown-key"),
+			expect: &lc.ErrorResponse{
+				Code: http.StatusUnauthorized,
+				Body: `{"code":"InvalidCredentials","message":"Key unknown-key not found"}`,
+			},
+		},
+		{
+			method:  "GET",
+			url:     path.Join(testUserAccount, "keys"),
+			headers: signed("/" + testUserAccount + "/keys/" + testKeyName),
+			expect: &lc.ErrorResponse{
+				Code: http.StatusUnauthorized,
+				Body: `{"code":"InvalidCredentials","message":"The signature we calculated does not match the one you sent"}`,
+			},
+		},
+		{
+			method:  "GET",
+			url:     path.Join(testUserAccount, "keys"),
+			headers: signed("/" + testUserAccount + "/keys/e8:b6:5b:a8:34:be:bc:97:bb:40:ee:4b:9a:a6:5c:37"),
+			expect: &lc.ErrorResponse{
+				Code: http.StatusUnauthorized,
+				Body: `{"code":"InvalidCredentials","message":"The signature we calculated does not match the one you sent"}`,
+			},
+		},
+		{
+			method:  "GET",
+			url:     path.Join(testUserAccount, "keys"),
+			headers: signed("/other/keys/" + testKeyName),
+			expect: &lc.ErrorResponse{
+				Code: http.StatusUnauthorized,
+				Body: `{"code":"InvalidCredentials","message":"Account other not found"}`,
+			},
+		},
+		{
+			method:  "GET",
+			url:     path.Join(testUserAccount, "keys"),
+			headers: staleHeaders,
+			expect: &lc.ErrorResponse{
+				Code: http.StatusUnauthorized,
+				Body: fmt.Sprintf(`{"code":"InvalidCredentials","message":"Date header %s is too far from the server time"}`, staleHeaders.Get("Date")),
+			},
+		},
+	}
+	for i, t := range tests {
+		c.Logf("#%d. %s %s -> %d", i, t.method, t.url, t.expect.Code)
+		resp, err := s.sendRequest(t.method, t.url, nil, t.headers)
+		c.Assert(err, gc.IsNil)
+		c.Assert(resp.StatusCode, gc.Equals, t.expect.Code)
+		assertBody(c, resp, t.expect)
+	}
+}
+
+func (s *CloudAPIHTTPSuite) TestErrorResponses(c *gc.C) {
+	s.createKey(c, testKeyName, testKey)
+	defer s.deleteKey(c, testKeyName)
+	m := s.createMachine(c, testMachineName, testPackage, testImage, nil, nil)
+	defer s.deleteMachine(c, m.Id)
+	defer s.service.RegisterControlPoint("ListNetworks", func(sc hook.ServiceControl, args ...interface{}) error {
+		return fmt.Errorf("networks unavailable")
+	})()
+
+	duplicate, err := json.Marshal(cloudapi.CreateKeyOpts{Name: testKeyName, Key: testKey})
+	c.Assert(err, gc.IsNil)
+	unknownPackage, err := json.Marshal(cloudapi.CreateMachineOpts{Package: "Huge", Image: testImage})
+	c.Assert(err, gc.IsNil)
+
+	tests := []struct {
+		method string
+		url    string
+		body   []byte
+		code   int
+		expect string
+	}{
+		{
+			method: "GET",
+			url:    path.Join(testUserAccount, "keys", "missing-key"),
+			code:   http.StatusNotFound,
+			expect: `{"code":"ResourceNotFound","message":"Key missing-key not found"}`,
+		},
+		{
+			method: "POST",
+			url:    path.Join(testUserAccount, "keys"),
+			body:   duplicate,
+			code:   http.StatusConflict,
+			expect: `{"code":"InUseError","message":"Key name test-key already in use"}`,
+		},
+		{
+			method: "POST",
+			url:    path.Join(testUserAccount, "keys"),
+			body:   []byte("{"),
+			code:   http.StatusBadRequest,
+			expect: `{"code":"InvalidContent","message":"Invalid JSON: unexpected end of JSON input"}`,
+		},
+		{
+			method: "POST",
+			url:    path.Join(testUserAccount, "machines"),
+			body:   unknownPackage,
+			code:   http.StatusConflict,
+			expect: `{"code":"InvalidArgument","message":"Package Huge not found"}`,
+		},
+		{
+			method: "DELETE",
+			url:    path.Join(testUserAccount, "machines", m.Id),
+			code:   http.StatusConflict,
+			expect: fmt.Sprintf(`{"code":"InvalidArgument","message":"Cannot Delete machine %s, machine is not stopped."}`, m.Id),
+		},
+		{
+			method: "GET",
+			url:    path.Join(testUserAccount, "networks"),
+			code:   http.StatusInternalServerError,
+			expect: `{"code":"InternalError","message":"networks unavailable"}`,
+		},
+	}
+	for i, t := range tests {
+		c.Logf("#%d. %s %s -> %d", i, t.method, t.url, t.code)
+		resp, err := s.sendRequest(t.method, t.url, t.body, nil)
+		c.Assert(err, gc.IsNil)
+		c.Assert(resp.StatusCode, gc.Equals, t.code)
+		c.Assert(resp.Header.Get("Content-Type"), gc.Equals, "application/json")
+		assertBody(c, resp, &lc.ErrorResponse{Body: t.expect})
+	}
+}
+
+func (s *CloudAPIHTTPSuite) TestCheckpoints(c *gc.C) {
+	s.service.RequireSignatures(true)
+	defer s.service.RequireSignatures(false)
+
+	resp, err := s.sendRequest("POST", path.Join(lc.AdminRoute, "checkpoints"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusCreated)
+	var checkpoint map[string]string
+	assertJSON(c, resp, &checkpoint)
+	c.Assert(checkpoint["id"], gc.Not(gc.Equals), "")
+
+	_, err = s.service.CreateKey(testKeyName, testKey)
+	c.Assert(err, gc.IsNil)
+
+	resp, err = s.sendRequest("POST", path.Join(lc.AdminRoute, "checkpoints", checkpoint["id"])+"?action=restore", nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusNoContent)
+	keys, err := s.service.ListKeys()
+	c.Assert(err, gc.IsNil)
+	c.Assert(keys, gc.HasLen, 0)
+
+	resp, err = s.sendRequest("POST", path.Join(lc.AdminRoute, "checkpoints", "unknown")+"?action=restore", nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusNotFound)
+	assertBody(c, resp, &lc.ErrorResponse{Body: `{"code":"ResourceNotFound","message":"Checkpoint unknown not found"}`})
+
+	_, err = s.service.CreateFirewallRule(testFwRule, true)
+	c.Assert(err, gc.IsNil)
+	resp, err = s.sendRequest("POST", path.Join(lc.AdminRoute, "reset"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusNoContent)
+	rules, err := s.service.ListFirewallRules()
+	c.Assert(err, gc.IsNil)
+	c.Assert(rules, gc.HasLen, 0)
+}
+
+func (s *CloudAPIHTTPSuite) TestAccounts(c *gc.C) {
+	bob, err := s.service.AddAccount("httpbob")
+	c.Assert(err, gc.IsNil)
+	_, err = bob.CreateKey(testKeyName, testKey)
+	c.Assert(err, gc.IsNil)
+
+	resp, err := s.sendRequest("GET", path.Join("httpbob", "keys"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusOK)
+	var keys []cloudapi.Key
+	assertJSON(c, resp, &keys)
+	c.Assert(keys, gc.HasLen, 1)
+
+	resp, err = s.sendRequest("GET", path.Join(testUserAccount, "keys"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	keys = nil
+	assertJSON(c, resp, &keys)
+	c.Assert(keys, gc.HasLen, 0)
+
+	resp, err = s.sendRequest("GET", path.Join("httpbob", "packages", testPackage), nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusOK)
+	resp.Body.Close()
+
+	resp, err = s.sendRequest("PUT", path.Join("httpbob", "keys"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusMethodNotAllowed)
+	resp.Body.Close()
+
+	resp, err = s.sendRequest("GET", path.Join("nobody", "keys"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusNotFound)
+	resp.Body.Close()
+}
+
+func (s *CloudAPIHTTPSuite) TestQuotaExceeded(c *gc.C) {
+	c.Assert(s.service.SetLimits(lc.Limits{Machines: 1}), gc.IsNil)
+	defer s.service.SetLimits(lc.Limits{})
+
+	m := s.createMachine(c, testMachineName, testPackage, testImage, nil, nil)
+	defer s.deleteMachine(c, m.Id)
+	opts, err := json.Marshal(cloudapi.CreateMachineOpts{Package: testPackage, Image: testImage})
+	c.Assert(err, gc.IsNil)
+	resp, err := s.sendRequest("POST", path.Join(testUserAccount, "machines"), opts, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusForbidden)
+	assertBody(c, resp, &lc.ErrorResponse{Body: `{"code":"QuotaExceeded","message":"Quota exceeded; to have your limits raised please contact Support"}`})
+}
+
+func (s *CloudAPIHTTPSuite) TestFaults(c *gc.C) {
+	defer s.service.ClearFaults()
+
+	resp, err := s.jsonRequest("POST", path.Join(lc.AdminRoute, "faults"), map[string]interface{}{
+		"operation": "CreateKey",
+		"code":      lc.CodeServiceUnavailable,
+		"message":   "Try again later",
+		"latency":   "20ms",
+		"times":     1,
+	}, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusCreated)
+	fault := lc.Fault{}
+	assertJSON(c, resp, &fault)
+	c.Assert(fault.Latency, gc.Equals, 20*time.Millisecond)
+
+	opts, err := json.Marshal(cloudapi.CreateKeyOpts{Name: testKeyName, Key: testKey})
+	c.Assert(err, gc.IsNil)
+	start := time.Now()
+	resp, err = s.sendRequest("POST", path.Join(testUserAccount, "keys"), opts, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(time.Since(start) >= 20*time.Millisecond, gc.Equals, true)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusServiceUnavailable)
+	assertBody(c, resp, &lc.ErrorResponse{Body: `{"code":"ServiceUnavailable","message":"Try again later"}`})
+	c.Assert(s.service.Faults(), gc.HasLen, 0)
+	s.createKey(c, testKeyName, testKey)
+	s.deleteKey(c, testKeyName)
+
+	// faults about one machine
+	m := s.createMachine(c, testMachineName, testPackage, testImage, nil, nil)
+	defer s.deleteMachine(c, m.Id)
+	_, err = s.service.AddFault(lc.Fault{MachineID: m.Id, Operation: "StopMachine", Status: http.StatusInternalServerError})
+	c.Assert(err, gc.IsNil)
+	resp, err = s.sendRequest("POST", path.Join(testUserAccount, "machines", m.Id)+"?action=stop", nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusInternalServerError)
+	resp, err = s.sendRequest("POST", path.Join(testUserAccount, "machines", m.Id)+"?action=reboot", nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusAccepted)
+	// a fault on UpdateMachine applies to every action
+	updateFault, err := s.service.AddFault(lc.Fault{MachineID: m.Id, Operation: "UpdateMachine", Status: http.StatusServiceUnavailable})
+	c.Assert(err, gc.IsNil)
+	resp, err = s.sendRequest("POST", path.Join(testUserAccount, "machines", m.Id)+"?action=rename&name=faulty", nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusServiceUnavailable)
+	c.Assert(s.service.RemoveFault(updateFault.Id), gc.IsNil)
+
+	// faults about an operation other than a machine action
+	_, err = s.service.AddFault(lc.Fault{Operation: "ListFabricVLANs", Status: http.StatusBadGateway})
+	c.Assert(err, gc.IsNil)
+	resp, err = s.sendRequest("GET", path.Join(testUserAccount, "fabrics", "default", "vlans"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusBadGateway)
+
+	// dropped connections and truncated bodies
+	dropped, err := s.service.AddFault(lc.Fault{Route: "/" + testUserAccount + "/packages", Drop: true})
+	c.Assert(err, gc.IsNil)
+	_, err = s.sendRequest("GET", path.Join(testUserAccount, "packages"), nil, nil)
+	c.Assert(err, gc.NotNil)
+	c.Assert(s.service.RemoveFault(dropped.Id), gc.IsNil)
+
+	_, err = s.service.AddFault(lc.Fault{Route: "/" + testUserAccount + "/packages/*", Method: "get", Truncate: true})
+	c.Assert(err, gc.IsNil)
+	resp, err = s.sendRequest("GET", path.Join(testUserAccount, "packages", "Small"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	_, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	c.Assert(err, gc.NotNil)
+
+	// probabilistic failures
+	resp, err = s.sendRequest("DELETE", path.Join(lc.AdminRoute, "faults"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusNoContent)
+	s.service.SetFaultSeed(1)
+	_, err = s.service.AddFault(lc.Fault{Operation: "ListKeys", Code: lc.CodeInternalError, Probability: 0.5})
+	c.Assert(err, gc.IsNil)
+	failed := 0
+	for i := 0; i < 20; i++ {
+		resp, err = s.sendRequest("GET", path.Join(testUserAccount, "keys"), nil, nil)
+		c.Assert(err, gc.IsNil)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusInternalServerError {
+			failed++
+		}
+	}
+	c.Assert(failed > 0 && failed < 20, gc.Equals, true)
+
+	resp, err = s.sendRequest("GET", path.Join(lc.AdminRoute, "faults"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	var faults []lc.Fault
+	assertJSON(c, resp, &faults)
+	c.Assert(faults, gc.HasLen, 1)
+	resp, err = s.sendRequest("DELETE", path.Join(lc.AdminRoute, "faults", faults[0].Id), nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusNoContent)
+	resp, err = s.sendRequest("DELETE", path.Join(lc.AdminRoute, "faults", faults[0].Id), nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusNotFound)
+}
+
 // Tests for Images API
 func (s *CloudAPIHTTPSuite) TestListImages(c *gc.C) {
 	var expected []cloudapi.Image
@@ -575,6 +924,112 @@ func (s *CloudAPIHTTPSuite) TestDeleteMachine(c *gc.C) {
 	s.deleteMachine(c, m.Id)
 }
 
+// Tests for Machine Snapshots API
+func (s *CloudAPIHTTPSuite) TestMachineSnapshots(c *gc.C) {
+	var (
+		snapshot  cloudapi.Snapshot
+		snapshots []cloudapi.Snapshot
+	)
+	m := s.createMachine(c, testMachineName, testPackage, testImage, nil, map[string]string{"env": "test"})
+	defer s.deleteMachine(c, m.Id)
+	snapshotsPath := path.Join(testUserAccount, "machines", m.Id, "snapshots")
+
+	resp, err := s.jsonRequest("POST", snapshotsPath, cloudapi.SnapshotOpts{Name: "test-snapshot"}, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusCreated)
+	assertJSON(c, resp, &snapshot)
+	c.Assert(snapshot, gc.DeepEquals, cloudapi.Snapshot{Name: "test-snapshot", State: "queued"})
+
+	resp, err = s.sendRequest("GET", snapshotsPath, nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusOK)
+	assertJSON(c, resp, &snapshots)
+	c.Assert(snapshots, gc.DeepEquals, []cloudapi.Snapshot{{Name: "test-snapshot", State: "created"}})
+
+	resp, err = s.sendRequest("GET", path.Join(snapshotsPath, "test-snapshot"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusOK)
+
+	resp, err = s.sendRequest("PUT", path.Join(testUserAccount, "machines", m.Id, "tags"), []byte(`{"env":"changed"}`), nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusOK)
+
+	resp, err = s.sendRequest("POST", fmt.Sprintf("%s?action=stop", path.Join(testUserAccount, "machines", m.Id)), nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusAccepted)
+
+	resp, err = s.sendRequest("POST", path.Join(snapshotsPath, "test-snapshot"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusAccepted)
+
+	var machine cloudapi.Machine
+	s.getMachine(c, m.Id, &machine)
+	c.Assert(machine.State, gc.Equals, "running")
+	c.Assert(machine.Tags, gc.DeepEquals, map[string]string{"env": "test"})
+
+	resp, err = s.sendRequest("DELETE", path.Join(snapshotsPath, "test-snapshot"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusNoContent)
+}
+
+// Tests for Analytics API
+func (s *CloudAPIHTTPSuite) TestInstrumentations(c *gc.C) {
+	var (
+		analytics cloudapi.Analytics
+		inst      cloudapi.Instrumentation
+		insts     []cloudapi.Instrumentation
+		value     cloudapi.InstrumentationValue
+		heatmap   cloudapi.Heatmap
+	)
+	analyticsPath := path.Join(testUserAccount, "analytics")
+
+	resp, err := s.sendRequest("GET", analyticsPath, nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusOK)
+	assertJSON(c, resp, &analytics)
+	c.Assert(analytics.Metrics["syscall"], gc.NotNil)
+
+	opts := cloudapi.CreateInstrumentationOpts{Module: "syscall", Stat: "syscalls", Decomposition: "latency", Granularity: 5}
+	resp, err = s.jsonRequest("POST", path.Join(analyticsPath, "instrumentations"), opts, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusCreated)
+	assertJSON(c, resp, &inst)
+	c.Assert(inst.Granularity, gc.Equals, 5)
+	instPath := path.Join(analyticsPath, "instrumentations", inst.Id)
+
+	resp, err = s.sendRequest("POST", path.Join(analyticsPath, "instrumentations"), []byte(`{"module":"tcp","stat":"connections","transformations":["geolocate"]}`), nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusConflict)
+	assertBody(c, resp, &lc.ErrorResponse{Body: `{"code":"InvalidArgument","message":"Transformations cannot be requested when creating an instrumentation"}`})
+
+	resp, err = s.sendRequest("GET", path.Join(analyticsPath, "instrumentations"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusOK)
+	assertJSON(c, resp, &insts)
+	c.Assert(insts, gc.DeepEquals, []cloudapi.Instrumentation{inst})
+
+	resp, err = s.sendRequest("GET", path.Join(instPath, "value", "raw"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusOK)
+	assertJSON(c, resp, &value)
+	c.Assert(value.Duration, gc.Equals, 5)
+	resp, err = s.sendRequest("GET", path.Join(instPath, "value", "raw")+"?start_time=soon", nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusConflict)
+	assertBody(c, resp, &lc.ErrorResponse{Body: `{"code":"InvalidArgument","message":"Invalid start_time \"soon\""}`})
+
+	resp, err = s.sendRequest("GET", path.Join(instPath, "value", "heatmap", "details")+"?width=10&height=10&nbuckets=5&y=9", nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusOK)
+	assertJSON(c, resp, &heatmap)
+	c.Assert(heatmap.BucketYmin, gc.Equals, 0)
+	c.Assert(heatmap.BucketYmax, gc.Equals, 200000)
+
+	resp, err = s.sendRequest("DELETE", instPath, nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusNoContent)
+}
+
 // Tests for FirewallRules API
 func (s *CloudAPIHTTPSuite) TestCreateFirewallRule(c *gc.C) {
 	testFwRule := s.createFirewallRule(c)
@@ -668,17 +1123,126 @@ func (s *CloudAPIHTTPSuite) TestGetNetwork(c *gc.C) {
 	c.Assert(resp.StatusCode, gc.Equals, http.StatusOK)
 	assertJSON(c, resp, &expected)
 	c.Assert(expected, gc.DeepEquals, cloudapi.Network{
-		Id:          testNetworkID,
-		Name:        "Test-Joyent-Public",
-		Public:      true,
-		Description: "",
+		Id:               testNetworkID,
+		Name:             "Test-Joyent-Public",
+		Public:           true,
+		Description:      "",
+		Subnet:           "32.151.0.0/16",
+		ProvisionStartIp: "32.151.0.10",
+		ProvisionEndIp:   "32.151.255.250",
+		Gateway:          "32.151.0.1",
 	})
 }
 
+func (s *CloudAPIHTTPSuite) TestNetworkIPs(c *gc.C) {
+	ipPath := path.Join(testUserAccount, "networks", testNetworkID, "ips", "32.151.250.1")
+
+	resp, err := s.sendRequest("PUT", ipPath, []byte(`{"reserved": true}`), nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusOK)
+	defer s.sendRequest("PUT", ipPath, []byte(`{"reserved": false}`), nil)
+	var ip cloudapi.NetworkIP
+	assertJSON(c, resp, &ip)
+	c.Assert(ip.Reserved, gc.Equals, true)
+
+	resp, err = s.sendRequest("GET", ipPath, nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusOK)
+	ip = cloudapi.NetworkIP{}
+	assertJSON(c, resp, &ip)
+	c.Assert(ip, gc.DeepEquals, cloudapi.NetworkIP{IP: "32.151.250.1", Reserved: true, OwnerUUID: s.service.AccountID()})
+
+	resp, err = s.sendRequest("GET", path.Join(testUserAccount, "networks", testNetworkID, "ips"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusOK)
+	var ips []cloudapi.NetworkIP
+	assertJSON(c, resp, &ips)
+	c.Assert(ips, gc.Not(gc.HasLen), 0)
+
+	resp, err = s.sendRequest("PUT", ipPath, []byte(`{}`), nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusConflict)
+}
+
+func (s *CloudAPIHTTPSuite) TestFabrics(c *gc.C) {
+	// the double has the default fabric only
+	resp, err := s.sendRequest("GET", path.Join(testUserAccount, "fabrics", "other", "vlans"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusNotFound)
+
+	// a VLAN ID that is not a number is an invalid argument
+	resp, err = s.sendRequest("GET", path.Join(testUserAccount, "fabrics", "default", "vlans", "abc"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusConflict)
+	assertBody(c, resp, &lc.ErrorResponse{Body: `{"code":"InvalidArgument","message":"Invalid VLAN id \"abc\""}`})
+
+	vlan, err := s.service.CreateFabricVLAN(cloudapi.FabricVLAN{Name: "http-fabric"})
+	c.Assert(err, gc.IsNil)
+	defer s.service.DeleteFabricVLAN(vlan.Id)
+	network, err := s.service.CreateFabricNetwork(vlan.Id, cloudapi.CreateFabricNetworkOpts{Name: "http-fabric-net", Subnet: "10.130.0.0/24"})
+	c.Assert(err, gc.IsNil)
+	defer s.service.DeleteFabricNetwork(vlan.Id, network.Id)
+
+	// bad options are rejected by the same validation as in the client
+	networksPath := path.Join(testUserAccount, "fabrics", "default", "vlans", strconv.Itoa(int(vlan.Id)), "networks")
+	resp, err = s.sendRequest("POST", networksPath, []byte(`{"name": "bad", "subnet": "10.131.0.0/24", "gateway": "10.132.0.1"}`), nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusConflict)
+
+	networkPath := path.Join(networksPath, network.Id)
+	resp, err = s.sendRequest("PUT", networkPath, []byte(`{"description": "updated"}`), nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusAccepted)
+	var updated cloudapi.FabricNetwork
+	assertJSON(c, resp, &updated)
+	c.Assert(updated.Description, gc.Equals, "updated")
+	c.Assert(updated.Name, gc.Equals, "http-fabric-net")
+
+	// fields sent empty are cleared, those left out are not
+	resp, err = s.sendRequest("PUT", networkPath, []byte(`{"description": "", "routes": {}}`), nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusAccepted)
+	updated = cloudapi.FabricNetwork{}
+	assertJSON(c, resp, &updated)
+	c.Assert(updated.Description, gc.Equals, "")
+	c.Assert(updated.Routes, gc.HasLen, 0)
+	c.Assert(updated.Name, gc.Equals, "http-fabric-net")
+
+	resp, err = s.sendRequest("GET", path.Join(testUserAccount, "fabrics", "other", "vlans", strconv.Itoa(int(vlan.Id)), "networks", network.Id), nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusNotFound)
+}
+
 func (s *CloudAPIHTTPSuite) TestGetServices(c *gc.C) {
-	//var expected cloudapi.ServiceInstance
+	var expected map[string]string
 	resp, err := s.sendRequest("GET", path.Join(testUserAccount, "services"), nil, nil)
 	c.Assert(err, gc.IsNil)
 	c.Assert(resp.StatusCode, gc.Equals, http.StatusOK)
+	assertJSON(c, resp, &expected)
+	c.Assert(expected, gc.DeepEquals, map[string]string{"cloudapi": s.Server.URL})
+}
+
+// Tests for Datacenters API
+func (s *CloudAPIHTTPSuite) TestListDatacenters(c *gc.C) {
+	var expected map[string]string
+	resp, err := s.sendRequest("GET", path.Join(testUserAccount, "datacenters"), nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusOK)
+	assertJSON(c, resp, &expected)
+	c.Assert(expected, gc.DeepEquals, map[string]string{lc.DefaultDatacenter: s.Server.URL})
+}
+
+func (s *CloudAPIHTTPSuite) TestGetDatacenter(c *gc.C) {
+	s.service.SetDatacenters(map[string]string{"us-east-1": "https://us-east-1.api.example.com"})
+	defer s.service.SetDatacenters(map[string]string{lc.DefaultDatacenter: s.Server.URL})
 
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(s.Server.URL + "/" + path.Join(testUserAccount, "datacenters", "us-east-1"))
+	c.Assert(err, gc.IsNil)
+	c.Assert(resp.StatusCode, gc.Equals, http.StatusFound)
+	c.Assert(resp.Header.Get("Location"), gc.Equals, "https://us-east-1.api.example.com")
 }
@@ -7,12 +7,22 @@ import (
 )
 
 // ListImages returns a list of images in the double
-func (c *CloudAPI) ListImages(filters map[string]string) ([]cloudapi.Image, error) {
-	if err := c.ProcessFunctionHook(c, filters); err != nil {
+func (c *CloudAPI) ListImages(filters map[string]string) (result []cloudapi.Image, err error) {
+	call, err := c.StartCall(HookListImages, c, filters)
+	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
 
-	availableImages := c.images
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	availableImages := []cloudapi.Image{}
+	for _, image := range c.primary.images {
+		if c.canSee(&image) {
+			availableImages = append(availableImages, image)
+		}
+	}
 
 	if filters != nil {
 		for k, f := range filters {
@@ -46,16 +56,21 @@ func (c *CloudAPI) ListImages(filters map[string]string) ([]cloudapi.Image, erro
 }
 
 // GetImage gets a single image by name from the double
-func (c *CloudAPI) GetImage(imageID string) (*cloudapi.Image, error) {
-	if err := c.ProcessFunctionHook(c, imageID); err != nil {
+func (c *CloudAPI) GetImage(imageID string) (result *cloudapi.Image, err error) {
+	call, err := c.StartCall(HookGetImage, c, imageID)
+	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
-	for _, image := range c.images {
-		if image.Id == imageID {
+	for _, image := range c.primary.images {
+		if image.Id == imageID && c.canSee(&image) {
 			return &image, nil
 		}
 	}
 
-	return nil, fmt.Errorf("Image %s not found", imageID)
+	return nil, notFoundError("Image %s not found", imageID)
 }
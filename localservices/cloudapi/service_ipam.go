@@ -0,0 +1,362 @@
+//
+// gosdc - Go library to interact with the Joyent CloudAPI
+//
+// CloudAPI double testing service - IP address management
+//
+// Copyright (c) Joyent Inc.
+//
+
+package cloudapi
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/joyent/gosdc/cloudapi"
+	"github.com/joyent/gosdc/localservices"
+)
+
+// defaultSubnet is where addresses come from on networks given without a
+// subnet
+const defaultSubnet = "10.88.0.0/16"
+
+// ipRange is the addresses a network hands out to NICs
+type ipRange struct {
+	networkID string
+	public    bool
+	prefix    netip.Prefix
+	start     netip.Addr
+	end       netip.Addr
+	gateway   netip.Addr
+}
+
+// subnetFullError is the error a NIC cannot be added with once every address
+// of its network is taken
+func subnetFullError(networkID string) *Error {
+	return NewError(CodeSubnetFull, "No more free IPs available on network %s", networkID)
+}
+
+// networkRange returns the IPv4 addresses of a network of the double or of a
+// fabric network of the account. The caller must hold c.mu.
+func (c *CloudAPI) networkRange(networkID string) (*ipRange, error) {
+	n, err := c.findNetwork(networkID)
+	if err != nil {
+		return nil, err
+	}
+	return newIPRange(n)
+}
+
+// networkRanges returns the IPv4 addresses of a network and, if it is
+// dual-stack, its IPv6 addresses. The caller must hold c.mu.
+func (c *CloudAPI) networkRanges(networkID string) ([]*ipRange, error) {
+	n, err := c.findNetwork(networkID)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newIPRange(n)
+	if err != nil {
+		return nil, err
+	}
+	if n.Subnet6 == "" {
+		return []*ipRange{r}, nil
+	}
+	r6, err := newRange(n.Id, n.Public, n.Subnet6, n.ProvisionStartIp6, n.ProvisionEndIp6, n.Gateway6)
+	if err != nil {
+		return nil, err
+	}
+	return []*ipRange{r, r6}, nil
+}
+
+// addrRange returns the range of a network an address is in, along with the
+// parsed address. The caller must hold c.mu.
+func (c *CloudAPI) addrRange(networkID, ipAddress string) (*ipRange, netip.Addr, error) {
+	ranges, err := c.networkRanges(networkID)
+	if err != nil {
+		return nil, netip.Addr{}, err
+	}
+	if addr, err := netip.ParseAddr(ipAddress); err == nil {
+		for _, r := range ranges {
+			if r.prefix.Contains(addr) {
+				return r, addr, nil
+			}
+		}
+	}
+	return nil, netip.Addr{}, notFoundError("IP %s not found on network %s", ipAddress, networkID)
+}
+
+// newIPRange returns the IPv4 addresses of a network. The provisioning range
+// defaults to the whole subnet but for its first and last addresses.
+func newIPRange(n *cloudapi.Network) (*ipRange, error) {
+	subnet := n.Subnet
+	if subnet == "" {
+		subnet = defaultSubnet
+	}
+	return newRange(n.Id, n.Public, subnet, n.ProvisionStartIp, n.ProvisionEndIp, n.Gateway)
+}
+
+// newRange returns the addresses of a subnet of a network, as newIPRange
+func newRange(networkID string, public bool, subnet, start, end, gateway string) (*ipRange, error) {
+	prefix, err := netip.ParsePrefix(subnet)
+	if err != nil {
+		return nil, invalidArgumentError("Network %s has an invalid subnet %q", networkID, subnet)
+	}
+	r := &ipRange{
+		networkID: networkID,
+		public:    public,
+		prefix:    prefix.Masked(),
+		start:     prefix.Masked().Addr().Next(),
+		end:       cloudapi.LastAddr(prefix.Masked()).Prev(),
+	}
+	for _, a := range []struct {
+		addr *netip.Addr
+		s    string
+	}{{&r.start, start}, {&r.end, end}, {&r.gateway, gateway}} {
+		if a.s == "" {
+			continue
+		}
+		addr, err := netip.ParseAddr(a.s)
+		if err != nil || !r.prefix.Contains(addr) {
+			return nil, invalidArgumentError("Network %s has an invalid address %q", networkID, a.s)
+		}
+		*a.addr = addr
+	}
+	return r, nil
+}
+
+// ipUsage is the addresses taken on the networks of the double, built once
+// by usedIPs for all the NICs an operation attaches
+type ipUsage struct {
+	used map[string]map[netip.Addr]bool // by network ID in lower case
+	next map[ipRangeKey]netip.Addr      // where the search for a free address resumes
+}
+
+type ipRangeKey struct {
+	networkID string
+	prefix    netip.Prefix
+}
+
+// usedIPs returns the addresses taken by the NICs of the machines of every
+// account, or reserved by an account. The caller must hold c.mu.
+func (c *CloudAPI) usedIPs() *ipUsage {
+	u := &ipUsage{used: map[string]map[netip.Addr]bool{}, next: map[ipRangeKey]netip.Addr{}}
+	for _, account := range c.accountList() {
+		for networkID, ips := range account.reservedIPs {
+			for ip := range ips {
+				if addr, err := netip.ParseAddr(ip); err == nil {
+					u.add(networkID, addr)
+				}
+			}
+		}
+	}
+	for _, m := range c.allMachines() {
+		for _, nic := range m.NICs {
+			for _, addr := range nicAddrs(nic) {
+				u.add(nic.Network, addr)
+			}
+		}
+	}
+	return u
+}
+
+// add marks an address of a network as taken
+func (u *ipUsage) add(networkID string, addr netip.Addr) {
+	networkID = strings.ToLower(networkID)
+	if u.used[networkID] == nil {
+		u.used[networkID] = map[netip.Addr]bool{}
+	}
+	u.used[networkID][addr] = true
+}
+
+// allocate takes the first free address of a range. Addresses are only ever
+// taken while the usage is in use, so the search resumes after the address
+// last taken from the range.
+func (u *ipUsage) allocate(r *ipRange) (netip.Addr, error) {
+	key := ipRangeKey{strings.ToLower(r.networkID), r.prefix}
+	addr, ok := u.next[key]
+	if !ok {
+		addr = r.start
+	}
+	used := u.used[key.networkID]
+	for ; addr.IsValid() && addr.Compare(r.end) <= 0; addr = addr.Next() {
+		if addr != r.gateway && !used[addr] {
+			u.add(r.networkID, addr)
+			u.next[key] = addr.Next()
+			return addr, nil
+		}
+	}
+	return netip.Addr{}, subnetFullError(r.networkID)
+}
+
+// nicAddrs returns the addresses of a NIC, its IPv4 address first. Addresses
+// given in IPs may be in CIDR notation or not.
+func nicAddrs(nic *cloudapi.NIC) []netip.Addr {
+	var addrs []netip.Addr
+	seen := map[netip.Addr]bool{}
+	for _, ip := range append([]string{nic.IP}, nic.IPs...) {
+		addr, err := netip.ParseAddr(ip)
+		if prefix, perr := netip.ParsePrefix(ip); perr == nil {
+			addr, err = prefix.Addr(), nil
+		}
+		if err == nil && !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// copyNIC returns a deep copy of a NIC
+func copyNIC(nic *cloudapi.NIC) *cloudapi.NIC {
+	out := *nic
+	out.IPs = copyStrings(nic.IPs)
+	out.Gateways = copyStrings(nic.Gateways)
+	return &out
+}
+
+// attachNIC adds to a machine a NIC on the given network with the first free
+// address of the network, and the first free IPv6 address too if the network
+// is dual-stack, taking the addresses from used. The caller must hold c.mu.
+func (c *CloudAPI) attachNIC(m *machine, networkID string, used *ipUsage) (*cloudapi.NIC, error) {
+	ranges, err := c.networkRanges(networkID)
+	if err != nil {
+		return nil, asInvalidArgument(err)
+	}
+	addrs := make([]netip.Addr, len(ranges))
+	for i, r := range ranges {
+		if addrs[i], err = used.allocate(r); err != nil {
+			return nil, err
+		}
+	}
+	mac, err := localservices.NewMAC()
+	if err != nil {
+		return nil, err
+	}
+
+	r, addr := ranges[0], addrs[0]
+	nic := &cloudapi.NIC{
+		IP:      addr.String(),
+		MAC:     mac,
+		Primary: len(m.NICs) == 0,
+		Netmask: net.IP(net.CIDRMask(r.prefix.Bits(), addr.BitLen())).String(),
+		State:   cloudapi.NICStateRunning,
+		Network: r.networkID,
+	}
+	if r.gateway.IsValid() {
+		nic.Gateway = r.gateway.String()
+	}
+	for i, r := range ranges {
+		nic.IPs = append(nic.IPs, netip.PrefixFrom(addrs[i], r.prefix.Bits()).String())
+		if r.gateway.IsValid() {
+			nic.Gateways = append(nic.Gateways, r.gateway.String())
+		}
+	}
+	if m.NICs == nil {
+		m.NICs = map[string]*cloudapi.NIC{}
+		m.NetworkNICs = map[string]string{}
+	}
+	m.NICs[mac] = nic
+	m.NetworkNICs[mac] = r.networkID
+	m.Networks = append(m.Networks, r.networkID)
+	c.updateIPs(m)
+	return nic, nil
+}
+
+// attachNICs adds to a machine a NIC on each of the given networks, as
+// attachNIC. The caller must hold c.mu.
+func (c *CloudAPI) attachNICs(m *machine, networks []string, used *ipUsage) error {
+	for _, network := range networks {
+		if _, err := c.attachNIC(m, network, used); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateIPs sets the IPs of a machine from its NICs, in the order of its
+// networks, with the IPv6 addresses of a NIC after its IPv4 one. The primary
+// IP is the first public IPv4 one, if any. The caller must hold c.mu.
+func (c *CloudAPI) updateIPs(m *machine) {
+	m.IPs = []string{}
+	m.PrimaryIP = ""
+	for _, network := range m.Networks {
+		for mac, nicNetwork := range m.NetworkNICs {
+			if nicNetwork != network {
+				continue
+			}
+			nic := m.NICs[mac]
+			for _, addr := range nicAddrs(nic) {
+				m.IPs = append(m.IPs, addr.String())
+			}
+			if m.PrimaryIP == "" && nic.IP != "" && c.isPublicNetwork(network) {
+				m.PrimaryIP = nic.IP
+			}
+		}
+	}
+	if m.PrimaryIP == "" && len(m.IPs) > 0 {
+		m.PrimaryIP = m.IPs[0]
+	}
+}
+
+// isPublicNetwork reports whether a network is public. The caller must hold
+// c.mu.
+func (c *CloudAPI) isPublicNetwork(networkID string) bool {
+	r, err := c.networkRange(networkID)
+	return err == nil && r.public
+}
+
+// networkIPs returns the addresses of a network that are managed by the
+// datacenter, reserved or in use, by any account. The caller must hold c.mu.
+func (c *CloudAPI) networkIPs(r *ipRange) map[netip.Addr]*cloudapi.NetworkIP {
+	ips := map[netip.Addr]*cloudapi.NetworkIP{}
+	ip := func(addr netip.Addr) *cloudapi.NetworkIP {
+		if ips[addr] == nil {
+			ips[addr] = &cloudapi.NetworkIP{IP: addr.String()}
+		}
+		return ips[addr]
+	}
+
+	managed := []netip.Addr{r.prefix.Addr(), cloudapi.LastAddr(r.prefix)}
+	if r.gateway.IsValid() {
+		managed = append(managed, r.gateway)
+	}
+	for _, addr := range managed {
+		ip(addr).Managed = true
+		ip(addr).Reserved = true
+	}
+
+	for _, account := range c.accountList() {
+		for s := range account.reservedIPs[r.networkID] {
+			if addr, err := netip.ParseAddr(s); err == nil && r.prefix.Contains(addr) {
+				ip(addr).Reserved = true
+				ip(addr).OwnerUUID = account.accountID
+			}
+		}
+		for _, m := range account.machines {
+			for _, nic := range m.NICs {
+				if !strings.EqualFold(nic.Network, r.networkID) {
+					continue
+				}
+				for _, addr := range nicAddrs(nic) {
+					if !r.prefix.Contains(addr) {
+						continue
+					}
+					ip(addr).OwnerUUID = account.accountID
+					ip(addr).BelongsToUUID = m.Id
+					ip(addr).BelongsToType = "zone"
+				}
+			}
+		}
+	}
+	return ips
+}
+
+// visibleIP returns what the account sees of an address: who uses the
+// addresses of other accounts on a shared network is not shown.
+func (c *CloudAPI) visibleIP(ip *cloudapi.NetworkIP) cloudapi.NetworkIP {
+	out := *ip
+	if out.OwnerUUID != "" && out.OwnerUUID != c.accountID {
+		out.OwnerUUID, out.BelongsToUUID, out.BelongsToType = "", "", ""
+	}
+	return out
+}
@@ -1,25 +1,36 @@
 package cloudapi
 
 import (
-	"fmt"
-
 	"github.com/joyent/gosdc/cloudapi"
 )
 
 // ListKeys lists keys in the double
-func (c *CloudAPI) ListKeys() ([]cloudapi.Key, error) {
-	if err := c.ProcessFunctionHook(c); err != nil {
+func (c *CloudAPI) ListKeys() (result []cloudapi.Key, err error) {
+	call, err := c.StartCall(HookListKeys, c)
+	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	out := make([]cloudapi.Key, len(c.keys))
+	copy(out, c.keys)
 
-	return c.keys, nil
+	return out, nil
 }
 
 // GetKey gets a single key from the double by name
-func (c *CloudAPI) GetKey(keyName string) (*cloudapi.Key, error) {
-	if err := c.ProcessFunctionHook(c, keyName); err != nil {
+func (c *CloudAPI) GetKey(keyName string) (result *cloudapi.Key, err error) {
+	call, err := c.StartCall(HookGetKey, c, keyName)
+	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
 	for _, key := range c.keys {
 		if key.Name == keyName {
@@ -27,22 +38,27 @@ func (c *CloudAPI) GetKey(keyName string) (*cloudapi.Key, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("Key %s not found", keyName)
+	return nil, notFoundError("Key %s not found", keyName)
 }
 
 // CreateKey creates a new key in the double
-func (c *CloudAPI) CreateKey(keyName, key string) (*cloudapi.Key, error) {
-	if err := c.ProcessFunctionHook(c, keyName, key); err != nil {
+func (c *CloudAPI) CreateKey(keyName, key string) (result *cloudapi.Key, err error) {
+	call, err := c.StartCall(HookCreateKey, c, keyName, key)
+	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	// check if key already exists or keyName already in use
 	for _, k := range c.keys {
 		if k.Name == keyName {
-			return nil, fmt.Errorf("Key name %s already in use", keyName)
+			return nil, conflictError("Key name %s already in use", keyName)
 		}
 		if k.Key == key {
-			return nil, fmt.Errorf("Key %s already exists", key)
+			return nil, conflictError("Key %s already exists", key)
 		}
 	}
 
@@ -53,10 +69,15 @@ func (c *CloudAPI) CreateKey(keyName, key string) (*cloudapi.Key, error) {
 }
 
 // DeleteKey deletes an existing key from the double
-func (c *CloudAPI) DeleteKey(keyName string) error {
-	if err := c.ProcessFunctionHook(c, keyName); err != nil {
+func (c *CloudAPI) DeleteKey(keyName string) (err error) {
+	call, err := c.StartCall(HookDeleteKey, c, keyName)
+	if err != nil {
 		return err
 	}
+	defer c.ProcessAfterHook(call, c, nil, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	for i, key := range c.keys {
 		if key.Name == keyName {
@@ -65,5 +86,5 @@ func (c *CloudAPI) DeleteKey(keyName string) error {
 		}
 	}
 
-	return fmt.Errorf("Key %s not found", keyName)
+	return notFoundError("Key %s not found", keyName)
 }
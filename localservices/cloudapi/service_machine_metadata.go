@@ -1,48 +1,73 @@
 package cloudapi
 
-import (
-	"fmt"
-	"time"
-)
-
 // GetMachineMetadata returns the complete set of metadata associated with the
 // specified machine.
-func (c *CloudAPI) GetMachineMetadata(machineID string) (map[string]string, error) {
-	machine, err := c.GetMachine(machineID)
+func (c *CloudAPI) GetMachineMetadata(machineID string) (result map[string]string, err error) {
+	call, err := c.StartCall(HookGetMachineMetadata, c, machineID)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	machine, err := c.getMachineWrapper(machineID)
 	if err != nil {
 		return nil, err
 	}
 
-	return machine.Metadata, nil
+	return copyStringMap(machine.Metadata), nil
 }
 
 // UpdateMachineMetadata updates the metadata for a given machine.
 // Any metadata keys passed in here are created if they do not exist, and
 // overwritten if they do.
-func (c *CloudAPI) UpdateMachineMetadata(machineID string, metadata map[string]string) (map[string]string, error) {
-	machine, err := c.GetMachine(machineID)
+func (c *CloudAPI) UpdateMachineMetadata(machineID string, metadata map[string]string) (result map[string]string, err error) {
+	call, err := c.StartCall(HookUpdateMachineMetadata, c, machineID, metadata)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	machine, err := c.getMachineWrapper(machineID)
 	if err != nil {
 		return nil, err
 	}
 
+	if machine.Metadata == nil {
+		machine.Metadata = map[string]string{}
+	}
 	for k, v := range metadata {
 		machine.Metadata[k] = v
 	}
-	machine.Updated = time.Now().Format("2013-11-26T19:47:13.448Z")
+	machine.Updated = c.now().UTC().Format(timeLayout)
 
 	return metadata, nil
 }
 
 // DeleteMachineMetadata deletes a single metadata key from the specified machine
-func (c *CloudAPI) DeleteMachineMetadata(machineID string, key string) error {
-	machine, err := c.GetMachine(machineID)
+func (c *CloudAPI) DeleteMachineMetadata(machineID string, key string) (err error) {
+	call, err := c.StartCall(HookDeleteMachineMetadata, c, machineID, key)
+	if err != nil {
+		return err
+	}
+	defer c.ProcessAfterHook(call, c, nil, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	machine, err := c.getMachineWrapper(machineID)
 	if err != nil {
 		return err
 	}
 
 	_, ok := machine.Metadata[key]
 	if !ok {
-		return fmt.Errorf(`"%s" is not a metadata key`, key)
+		return notFoundError(`"%s" is not a metadata key`, key)
 	}
 
 	delete(machine.Metadata, key)
@@ -50,8 +75,17 @@ func (c *CloudAPI) DeleteMachineMetadata(machineID string, key string) error {
 }
 
 // DeleteAllMachineMetadata deletes all metadata keys from the specified machine.
-func (c *CloudAPI) DeleteAllMachineMetadata(machineID string) error {
-	machine, err := c.GetMachine(machineID)
+func (c *CloudAPI) DeleteAllMachineMetadata(machineID string) (err error) {
+	call, err := c.StartCall(HookDeleteAllMachineMetadata, c, machineID)
+	if err != nil {
+		return err
+	}
+	defer c.ProcessAfterHook(call, c, nil, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	machine, err := c.getMachineWrapper(machineID)
 	if err != nil {
 		return err
 	}
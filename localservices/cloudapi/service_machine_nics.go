@@ -1,14 +1,21 @@
 package cloudapi
 
 import (
-	"fmt"
-	"time"
+	"strings"
 
 	"github.com/joyent/gosdc/cloudapi"
-	"github.com/joyent/gosdc/localservices"
 )
 
-func (c *CloudAPI) ListNICs(machineID string) ([]cloudapi.NIC, error) {
+func (c *CloudAPI) ListNICs(machineID string) (result []cloudapi.NIC, err error) {
+	call, err := c.StartCall(HookListNICs, c, machineID)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	machine, err := c.getMachineWrapper(machineID)
 	if err != nil {
 		return nil, err
@@ -16,13 +23,22 @@ func (c *CloudAPI) ListNICs(machineID string) ([]cloudapi.NIC, error) {
 
 	out := []cloudapi.NIC{}
 	for _, nic := range machine.NICs {
-		out = append(out, *nic)
+		out = append(out, *copyNIC(nic))
 	}
 
 	return out, nil
 }
 
-func (c *CloudAPI) GetNIC(machineID, MAC string) (*cloudapi.NIC, error) {
+func (c *CloudAPI) GetNIC(machineID, MAC string) (result *cloudapi.NIC, err error) {
+	call, err := c.StartCall(HookGetNIC, c, machineID, MAC)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	machine, err := c.getMachineWrapper(machineID)
 	if err != nil {
 		return nil, err
@@ -30,56 +46,61 @@ func (c *CloudAPI) GetNIC(machineID, MAC string) (*cloudapi.NIC, error) {
 
 	nic, present := machine.NICs[MAC]
 	if !present {
-		return nil, fmt.Errorf("NIC with MAC %s not found", MAC)
+		return nil, notFoundError("NIC with MAC %s not found", MAC)
 	}
 
-	return nic, nil
+	return copyNIC(nic), nil
 }
 
-func (c *CloudAPI) AddNIC(machineID, networkID string) (*cloudapi.NIC, error) {
-	machine, err := c.getMachineWrapper(machineID)
+func (c *CloudAPI) AddNIC(machineID, networkID string) (result *cloudapi.NIC, err error) {
+	call, err := c.StartCall(HookAddNIC, c, machineID, networkID)
 	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
 
 	// make sure that we're getting a real network
-	_, err = c.GetNetwork(networkID)
+	if _, err := c.GetNetwork(networkID); err != nil {
+		return nil, asInvalidArgument(err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	machine, err := c.getMachineWrapper(machineID)
 	if err != nil {
 		return nil, err
 	}
 
 	found := false
 	for _, network := range machine.Networks {
-		if network == networkID {
+		if strings.EqualFold(network, networkID) {
 			found = true
 		}
 	}
 	if found {
-		return nil, fmt.Errorf("Machine %s is already in network %s", machineID, networkID)
+		return nil, conflictError("Machine %s is already in network %s", machineID, networkID)
 	}
 
-	mac, err := localservices.NewMAC()
+	nic, err := c.attachNIC(machine, networkID, c.usedIPs())
 	if err != nil {
 		return nil, err
 	}
+	machine.Updated = c.now().UTC().Format(timeLayout)
 
-	machine.NICs[mac] = &cloudapi.NIC{
-		IP:      "10.88.88.100",
-		MAC:     mac,
-		Primary: false,
-		Netmask: "255.255.255.0",
-		Gateway: "10.88.88.2",
-		State:   cloudapi.NICStateRunning,
-		Network: networkID,
+	return copyNIC(nic), nil
+}
+
+func (c *CloudAPI) RemoveNIC(machineID, MAC string) (err error) {
+	call, err := c.StartCall(HookRemoveNIC, c, machineID, MAC)
+	if err != nil {
+		return err
 	}
-	machine.Updated = time.Now().Format("2013-11-26T19:47:13.448Z")
-	machine.Networks = append(machine.Networks, networkID)
-	machine.NetworkNICs[mac] = networkID
+	defer c.ProcessAfterHook(call, c, nil, &err)
 
-	return machine.NICs[mac], nil
-}
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-func (c *CloudAPI) RemoveNIC(machineID, MAC string) error {
 	machine, err := c.getMachineWrapper(machineID)
 	if err != nil {
 		return err
@@ -87,10 +108,10 @@ func (c *CloudAPI) RemoveNIC(machineID, MAC string) error {
 
 	_, present := machine.NICs[MAC]
 	if !present {
-		return fmt.Errorf("NIC with MAC %s not found", MAC)
+		return notFoundError("NIC with MAC %s not found", MAC)
 	}
 
-	machine.Updated = time.Now().Format("2013-11-26T19:47:13.448Z")
+	machine.Updated = c.now().UTC().Format(timeLayout)
 	destNetwork := machine.NetworkNICs[MAC]
 
 	for i, network := range machine.Networks {
@@ -99,8 +120,10 @@ func (c *CloudAPI) RemoveNIC(machineID, MAC string) error {
 		}
 	}
 
+	// the address of the NIC is free again once it is gone
 	delete(machine.NICs, MAC)
 	delete(machine.NetworkNICs, MAC)
+	c.updateIPs(machine)
 
 	return nil
 }
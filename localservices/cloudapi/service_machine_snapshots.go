@@ -0,0 +1,193 @@
+package cloudapi
+
+import (
+	"github.com/joyent/gosdc/cloudapi"
+	"github.com/joyent/gosdc/localservices"
+)
+
+const (
+	snapshotStateQueued  = "queued"
+	snapshotStateCreated = "created"
+)
+
+// snapshot is a machine snapshot along with the machine state it captured
+type snapshot struct {
+	cloudapi.Snapshot
+	Metadata map[string]string `json:"-"`
+	Tags     map[string]string `json:"-"`
+	pending  *transition
+}
+
+// getSnapshot finds a snapshot of a machine by name. The caller must hold
+// c.mu.
+func (c *CloudAPI) getSnapshot(machineID, name string) (*snapshot, error) {
+	if _, err := c.getMachineWrapper(machineID); err != nil {
+		return nil, err
+	}
+
+	for _, s := range c.snapshots[machineID] {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+
+	return nil, notFoundError("Snapshot %s not found for machine %s", name, machineID)
+}
+
+// ListMachineSnapshots returns the snapshots of the given machine
+func (c *CloudAPI) ListMachineSnapshots(machineID string) (result []cloudapi.Snapshot, err error) {
+	call, err := c.StartCall(HookListMachineSnapshots, c, machineID)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.settle()
+	if _, err := c.getMachineWrapper(machineID); err != nil {
+		return nil, err
+	}
+
+	snapshots := c.snapshots[machineID]
+	out := make([]cloudapi.Snapshot, len(snapshots))
+	for i, s := range snapshots {
+		out[i] = s.Snapshot
+	}
+
+	return out, nil
+}
+
+// GetMachineSnapshot returns a single snapshot of the given machine
+func (c *CloudAPI) GetMachineSnapshot(machineID, name string) (result *cloudapi.Snapshot, err error) {
+	call, err := c.StartCall(HookGetMachineSnapshot, c, machineID, name)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.settle()
+	s, err := c.getSnapshot(machineID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	out := s.Snapshot
+	return &out, nil
+}
+
+// CreateMachineSnapshot snapshots the metadata and tags of the given machine.
+// A name is generated if none is given. The new snapshot is queued until the
+// duration of the ActionSnapshot transition has passed on the double's clock,
+// when it is created, or failed if the transition fails.
+func (c *CloudAPI) CreateMachineSnapshot(machineID, name string) (result *cloudapi.Snapshot, err error) {
+	call, err := c.StartCall(HookCreateMachineSnapshot, c, machineID, name)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	if name == "" {
+		id, err := localservices.NewUUID()
+		if err != nil {
+			return nil, err
+		}
+		name = id
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	machine, err := c.getMachineWrapper(machineID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range c.snapshots[machineID] {
+		if s.Name == name {
+			return nil, conflictError("Snapshot %s already exists for machine %s", name, machineID)
+		}
+	}
+
+	s := &snapshot{
+		Snapshot: cloudapi.Snapshot{Name: name, State: snapshotStateQueued},
+		Metadata: copyStringMap(machine.Metadata),
+		Tags:     copyStringMap(machine.Tags),
+		pending:  c.newTransition(ActionSnapshot, snapshotStateCreated, nil),
+	}
+	c.snapshots[machineID] = append(c.snapshots[machineID], s)
+
+	out := s.Snapshot
+	return &out, nil
+}
+
+// StartMachineFromSnapshot boots a stopped machine from the given snapshot,
+// restoring the metadata and tags it had when the snapshot was taken. It plays
+// out like StartMachine.
+func (c *CloudAPI) StartMachineFromSnapshot(machineID, name string) (err error) {
+	call, err := c.StartCall(HookStartMachineFromSnapshot, c, machineID, name)
+	if err != nil {
+		return err
+	}
+	defer c.ProcessAfterHook(call, c, nil, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.settle()
+	s, err := c.getSnapshot(machineID, name)
+	if err != nil {
+		return err
+	}
+	if s.State != snapshotStateCreated {
+		return stateError("Cannot start machine %s from snapshot %s, snapshot is %s.", machineID, name, s.State)
+	}
+
+	wrapper, err := c.getMachineWrapper(machineID)
+	if err != nil {
+		return err
+	}
+	if err := checkIdle(wrapper); err != nil {
+		return err
+	}
+	if wrapper.State != "stopped" {
+		return stateError("Cannot start machine %s from snapshot, machine is not stopped.", machineID)
+	}
+
+	c.startTransition(wrapper, ActionStart, wrapper.State, "running", func(m *machine) {
+		m.Metadata = copyStringMap(s.Metadata)
+		m.Tags = copyStringMap(s.Tags)
+	})
+
+	return nil
+}
+
+// DeleteMachineSnapshot deletes a snapshot of the given machine
+func (c *CloudAPI) DeleteMachineSnapshot(machineID, name string) (err error) {
+	call, err := c.StartCall(HookDeleteMachineSnapshot, c, machineID, name)
+	if err != nil {
+		return err
+	}
+	defer c.ProcessAfterHook(call, c, nil, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.getMachineWrapper(machineID); err != nil {
+		return err
+	}
+
+	snapshots := c.snapshots[machineID]
+	for i, s := range snapshots {
+		if s.Name == name {
+			c.snapshots[machineID] = append(snapshots[:i], snapshots[i+1:]...)
+			return nil
+		}
+	}
+
+	return notFoundError("Snapshot %s not found for machine %s", name, machineID)
+}
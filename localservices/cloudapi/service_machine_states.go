@@ -0,0 +1,195 @@
+package cloudapi
+
+import (
+	"sync"
+	"time"
+)
+
+// Machine actions whose transitions can be configured with SetTransition
+const (
+	ActionProvision = "provision"
+	ActionStart     = "start"
+	ActionStop      = "stop"
+	ActionReboot    = "reboot"
+	ActionResize    = "resize"
+	ActionDelete    = "delete"
+	ActionSnapshot  = "snapshot"
+)
+
+// timeLayout is the layout of the creation and update times of machines,
+// formatted in UTC
+const timeLayout = "2006-01-02T15:04:05.000Z"
+
+// Clock tells the double what time it is. Machine transitions complete once
+// their duration has passed on the double's clock.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// FakeClock is a Clock that only moves when told to, so tests can step
+// machines through their transitions deterministically.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFakeClock returns a FakeClock set to the given time
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the current time of the clock
+func (f *FakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// Advance moves the clock forward by d
+func (f *FakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+}
+
+// Transition configures how a machine action plays out in the double.
+//
+// While the action is in progress the machine reports an intermediate state:
+// provisioning when provisioning, stopping when stopping or rebooting,
+// deleted when deleting, and its current state otherwise. Once Duration has
+// passed the machine reaches the action's final state and deleted machines
+// disappear. A zero Duration completes the action straight away. Snapshots
+// are queued while the snapshot action is in progress and created once done.
+type Transition struct {
+	Duration time.Duration
+
+	// Failures is the number of upcoming runs of the action that fail;
+	// a negative value makes every run fail. A failed action has no effect
+	// other than leaving the machine in FailState, "failed" by default.
+	Failures  int
+	FailState string
+}
+
+// transition is a machine action in progress
+type transition struct {
+	action string
+	done   time.Time
+	state  string         // state once done, empty to remove the machine
+	apply  func(*machine) // effects of the action, nil if it failed
+}
+
+// SetClock sets the clock the double runs on
+func (c *CloudAPI) SetClock(clock Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.clock = clock
+}
+
+// SetTransition configures how the given machine action plays out
+func (c *CloudAPI) SetTransition(action string, t Transition) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.transitions[action] = t
+}
+
+// now returns the time on the double's clock. The caller must hold c.mu.
+func (c *CloudAPI) now() time.Time {
+	return c.clock.Now()
+}
+
+// newTransition schedules a run of an action ending in the final state, or in
+// the fail state of the action if the run fails. The caller must hold c.mu
+// for writing.
+func (c *CloudAPI) newTransition(action, final string, apply func(*machine)) *transition {
+	t := c.transitions[action]
+	if t.Failures != 0 {
+		final, apply = t.FailState, nil
+		if final == "" {
+			final = "failed"
+		}
+		if t.Failures > 0 {
+			t.Failures--
+			c.transitions[action] = t
+		}
+	}
+
+	return &transition{
+		action: action,
+		done:   c.now().Add(t.Duration),
+		state:  final,
+		apply:  apply,
+	}
+}
+
+// startTransition puts a machine in the intermediate state of an action and
+// schedules its completion. The caller must hold c.mu for writing.
+func (c *CloudAPI) startTransition(m *machine, action, intermediate, final string, apply func(*machine)) {
+	m.State = intermediate
+	m.Updated = c.now().UTC().Format(timeLayout)
+	m.pending = c.newTransition(action, final, apply)
+
+	c.settle()
+}
+
+// checkIdle returns an error if the machine is in the middle of an action.
+// The caller must hold c.mu.
+func checkIdle(m *machine) error {
+	if m.pending != nil {
+		return stateError("Machine %s is %s, wait for it to %s", m.Id, m.State, m.pending.action)
+	}
+	return nil
+}
+
+// settle completes the machine and snapshot transitions that are due. The
+// caller must hold c.mu for writing.
+func (c *CloudAPI) settle() {
+	now := c.now()
+	for _, snapshots := range c.snapshots {
+		for _, s := range snapshots {
+			if t := s.pending; t != nil && !now.Before(t.done) {
+				s.pending = nil
+				s.State = t.state
+			}
+		}
+	}
+
+	machines := c.machines[:0]
+	for _, m := range c.machines {
+		if t := m.pending; t != nil && !now.Before(t.done) {
+			m.pending = nil
+			if t.apply != nil {
+				t.apply(m)
+			}
+			if t.state == "" {
+				delete(c.snapshots, m.Id)
+				continue
+			}
+			m.State = t.state
+			m.Updated = now.UTC().Format(timeLayout)
+		}
+		machines = append(machines, m)
+	}
+
+	for i := len(machines); i < len(c.machines); i++ {
+		c.machines[i] = nil
+	}
+	c.machines = machines
+}
+
+// settleMachines completes the machine transitions that are due
+func (c *CloudAPI) settleMachines() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.settle()
+}
@@ -1,90 +1,156 @@
 package cloudapi
 
-import "fmt"
+// getMachineTags returns the tags of a machine. The caller must hold c.mu.
+func (c *CloudAPI) getMachineTags(machineID string) (map[string]string, error) {
+	machine, err := c.getMachineWrapper(machineID)
+	if err != nil {
+		return nil, err
+	}
+
+	if machine.Tags == nil {
+		machine.Tags = map[string]string{}
+	}
+
+	return machine.Tags, nil
+}
 
 // ListMachineTags returns the complete set of tags associated with the specified machine.
-func (c *CloudAPI) ListMachineTags(machineID string) (map[string]string, error) {
-	machine, err := c.GetMachine(machineID)
+func (c *CloudAPI) ListMachineTags(machineID string) (result map[string]string, err error) {
+	call, err := c.StartCall(HookListMachineTags, c, machineID)
 	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
 
-	return machine.Tags, nil
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	machine, err := c.getMachineWrapper(machineID)
+	if err != nil {
+		return nil, err
+	}
+
+	return copyStringMap(machine.Tags), nil
 }
 
 // AddMachineTags adds additional tags to the specified machine.
 // This API lets you append new tags, not overwrite existing tags.
-func (c *CloudAPI) AddMachineTags(machineID string, tags map[string]string) (map[string]string, error) {
-	machine, err := c.GetMachine(machineID)
+func (c *CloudAPI) AddMachineTags(machineID string, tags map[string]string) (result map[string]string, err error) {
+	call, err := c.StartCall(HookAddMachineTags, c, machineID, tags)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	machineTags, err := c.getMachineTags(machineID)
 	if err != nil {
 		return nil, err
 	}
 
 	for tag, value := range tags {
-		if _, present := machine.Tags[tag]; !present {
-			machine.Tags[tag] = value
+		if _, present := machineTags[tag]; !present {
+			machineTags[tag] = value
 		}
 	}
 
-	return machine.Tags, nil
+	return copyStringMap(machineTags), nil
 }
 
 // ReplaceMachineTags replaces existing tags for the specified machine.
 // This API lets you overwrite existing tags, not append to existing tags.
-func (c *CloudAPI) ReplaceMachineTags(machineID string, tags map[string]string) (map[string]string, error) {
-	machine, err := c.GetMachine(machineID)
+func (c *CloudAPI) ReplaceMachineTags(machineID string, tags map[string]string) (result map[string]string, err error) {
+	call, err := c.StartCall(HookReplaceMachineTags, c, machineID, tags)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	machineTags, err := c.getMachineTags(machineID)
 	if err != nil {
 		return nil, err
 	}
 
 	for tag, value := range tags {
-		if _, present := machine.Tags[tag]; present {
-			machine.Tags[tag] = value
+		if _, present := machineTags[tag]; present {
+			machineTags[tag] = value
 		}
 	}
 
-	return machine.Tags, nil
+	return copyStringMap(machineTags), nil
 }
 
 // DeleteMachineTags deletes all tags from the specified machine.
-func (c *CloudAPI) DeleteMachineTags(machineID string) error {
-	machine, err := c.GetMachine(machineID)
+func (c *CloudAPI) DeleteMachineTags(machineID string) (err error) {
+	call, err := c.StartCall(HookDeleteMachineTags, c, machineID)
+	if err != nil {
+		return err
+	}
+	defer c.ProcessAfterHook(call, c, nil, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	machineTags, err := c.getMachineTags(machineID)
 	if err != nil {
 		return err
 	}
 
-	for tag := range machine.Tags {
-		delete(machine.Tags, tag)
+	for tag := range machineTags {
+		delete(machineTags, tag)
 	}
 
 	return nil
 }
 
-func (c *CloudAPI) DeleteMachineTag(machineID, tagKey string) error {
-	machine, err := c.GetMachine(machineID)
+func (c *CloudAPI) DeleteMachineTag(machineID, tagKey string) (err error) {
+	call, err := c.StartCall(HookDeleteMachineTag, c, machineID, tagKey)
 	if err != nil {
 		return err
 	}
+	defer c.ProcessAfterHook(call, c, nil, &err)
 
-	_, present := machine.Tags[tagKey]
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	machineTags, err := c.getMachineTags(machineID)
+	if err != nil {
+		return err
+	}
+
+	_, present := machineTags[tagKey]
 	if !present {
-		return fmt.Errorf(`tag "%s" not found`, tagKey)
+		return notFoundError(`tag "%s" not found`, tagKey)
 	}
 
-	delete(machine.Tags, tagKey)
+	delete(machineTags, tagKey)
 	return nil
 }
 
 // GetMachineTag returns the value for a single tag on the specified machine.
-func (c *CloudAPI) GetMachineTag(machineID, tagKey string) (string, error) {
-	machine, err := c.GetMachine(machineID)
+func (c *CloudAPI) GetMachineTag(machineID, tagKey string) (result string, err error) {
+	call, err := c.StartCall(HookGetMachineTag, c, machineID, tagKey)
+	if err != nil {
+		return "", err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	machine, err := c.getMachineWrapper(machineID)
 	if err != nil {
 		return "", err
 	}
 
 	val, ok := machine.Tags[tagKey]
 	if !ok {
-		return "", fmt.Errorf(`tag "%s" not found`, tagKey)
+		return "", notFoundError(`tag "%s" not found`, tagKey)
 	}
 
 	return val, nil
@@ -1,22 +1,27 @@
 package cloudapi
 
 import (
-	"fmt"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/joyent/gosdc/cloudapi"
 	"github.com/joyent/gosdc/localservices"
 )
 
 // ListMachines returns a list of machines in the double
-func (c *CloudAPI) ListMachines(filters map[string]string) ([]*cloudapi.Machine, error) {
-	if err := c.ProcessFunctionHook(c, filters); err != nil {
+func (c *CloudAPI) ListMachines(filters map[string]string) (result []*cloudapi.Machine, err error) {
+	call, err := c.StartCall(HookListMachines, c, filters)
+	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.settleMachines()
 
-	availableMachines := c.machines
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	availableMachines := c.liveMachines()
 
 	if filters != nil {
 		for k, f := range filters {
@@ -53,50 +58,97 @@ func (c *CloudAPI) ListMachines(filters map[string]string) ([]*cloudapi.Machine,
 
 	out := make([]*cloudapi.Machine, len(availableMachines))
 	for i, machine := range availableMachines {
-		out[i] = &machine.Machine
+		out[i] = copyMachine(&machine.Machine)
 	}
 
 	return out, nil
 }
 
 // CountMachines returns a count of machines the double knows about
-func (c *CloudAPI) CountMachines() (int, error) {
-	if err := c.ProcessFunctionHook(c); err != nil {
+func (c *CloudAPI) CountMachines() (result int, err error) {
+	call, err := c.StartCall(HookCountMachines, c)
+	if err != nil {
 		return 0, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
 
-	return len(c.machines), nil
+	c.settleMachines()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return len(c.liveMachines()), nil
 }
 
-func (c *CloudAPI) getMachineWrapper(machineID string) (*machine, error) {
-	if err := c.ProcessFunctionHook(c, machineID); err != nil {
-		return nil, err
+// liveMachines returns the machines that are not being deleted. The caller
+// must hold c.mu.
+func (c *CloudAPI) liveMachines() []*machine {
+	machines := make([]*machine, 0, len(c.machines))
+	for _, m := range c.machines {
+		if m.State != "deleted" {
+			machines = append(machines, m)
+		}
 	}
+	return machines
+}
 
+// findMachine finds a machine by ID, including one being deleted. The caller
+// must hold c.mu.
+func (c *CloudAPI) findMachine(machineID string) (*machine, error) {
 	for _, machine := range c.machines {
 		if machine.Id == machineID {
 			return machine, nil
 		}
 	}
 
-	return nil, fmt.Errorf("Machine %s not found", machineID)
+	return nil, notFoundError("Machine %s not found", machineID)
 }
 
-// GetMachine gets a single machine by ID from the double
-func (c *CloudAPI) GetMachine(machineID string) (*cloudapi.Machine, error) {
-	wrapper, err := c.getMachineWrapper(machineID)
+// getMachineWrapper finds a machine by ID. Machines being deleted are not
+// found. The caller must hold c.mu.
+func (c *CloudAPI) getMachineWrapper(machineID string) (*machine, error) {
+	machine, err := c.findMachine(machineID)
+	if err != nil {
+		return nil, err
+	}
+	if machine.State == "deleted" {
+		return nil, notFoundError("Machine %s has been deleted", machineID)
+	}
+
+	return machine, nil
+}
+
+// GetMachine gets a single machine by ID from the double. A machine being
+// deleted is returned in the "deleted" state.
+func (c *CloudAPI) GetMachine(machineID string) (result *cloudapi.Machine, err error) {
+	call, err := c.StartCall(HookGetMachine, c, machineID)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.settleMachines()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	wrapper, err := c.findMachine(machineID)
 	if err != nil {
 		return nil, err
 	}
 
-	return &wrapper.Machine, nil
+	return copyMachine(&wrapper.Machine), nil
 }
 
-// CreateMachine creates a new machine in the double. It will be running immediately.
-func (c *CloudAPI) CreateMachine(name, pkg, image string, networks []string, metadata, tags map[string]string) (*cloudapi.Machine, error) {
-	if err := c.ProcessFunctionHook(c, name, pkg, image); err != nil {
+// CreateMachine creates a new machine in the double. It is provisioning until
+// the ActionProvision transition completes, and running after that. Created
+// on no network, the machine gets NICs on the default networks of the double.
+func (c *CloudAPI) CreateMachine(name, pkg, image string, networks []string, metadata, tags map[string]string) (result *cloudapi.Machine, err error) {
+	call, err := c.StartCall(HookCreateMachine, c, name, pkg, image)
+	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
 
 	machineID, err := localservices.NewUUID()
 	if err != nil {
@@ -105,173 +157,257 @@ func (c *CloudAPI) CreateMachine(name, pkg, image string, networks []string, met
 
 	mPkg, err := c.GetPackage(pkg)
 	if err != nil {
-		return nil, err
+		return nil, asInvalidArgument(err)
 	}
 
 	mImg, err := c.GetImage(image)
 	if err != nil {
-		return nil, err
+		return nil, asInvalidArgument(err)
 	}
 
 	mNetworks := []string{}
 	for _, network := range networks {
 		mNetwork, err := c.GetNetwork(network)
 		if err != nil {
-			return nil, err
+			return nil, asInvalidArgument(err)
 		}
 
 		mNetworks = append(mNetworks, mNetwork.Id)
 	}
 
-	publicIP := generatePublicIPAddress()
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	if tags == nil {
+		tags = map[string]string{}
+	}
 
 	newMachine := cloudapi.Machine{
-		Id:        machineID,
-		Name:      name,
-		Type:      mImg.Type,
-		State:     "running",
-		Memory:    mPkg.Memory,
-		Disk:      mPkg.Disk,
-		IPs:       []string{publicIP, generatePrivateIPAddress()},
-		Created:   time.Now().Format("2013-11-26T19:47:13.448Z"),
-		Package:   pkg,
-		Image:     image,
-		Metadata:  metadata,
-		Tags:      tags,
-		PrimaryIP: publicIP,
-		Networks:  mNetworks,
-	}
-
-	nics := map[string]*cloudapi.NIC{}
-	nicNetworks := map[string]string{}
-	for i, network := range mNetworks {
-		mac, err := localservices.NewMAC()
-		if err != nil {
-			return nil, err
-		}
+		Id:       machineID,
+		Name:     name,
+		Type:     mImg.Type,
+		Memory:   mPkg.Memory,
+		Disk:     mPkg.Disk,
+		Package:  pkg,
+		Image:    image,
+		Metadata: copyStringMap(metadata),
+		Tags:     copyStringMap(tags),
+		Networks: []string{},
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.settleAll()
+	if err := c.checkLimits(1, mPkg.Memory, mPkg.Disk); err != nil {
+		return nil, err
+	}
 
-		nics[mac] = &cloudapi.NIC{
-			IP:      fmt.Sprintf("10.88.88.%d", i),
-			MAC:     mac,
-			Primary: i == 0,
-			Netmask: "255.255.255.0",
-			Gateway: "10.88.88.2",
-			State:   cloudapi.NICStateRunning,
-			Network: network,
-		}
-		nicNetworks[mac] = network
+	if len(mNetworks) == 0 {
+		mNetworks = c.defaultNetworks()
+	}
+	m := &machine{Machine: newMachine, NICs: map[string]*cloudapi.NIC{}, NetworkNICs: map[string]string{}}
+	if err := c.attachNICs(m, mNetworks, c.usedIPs()); err != nil {
+		return nil, err
+	}
+	m.Created = c.now().UTC().Format(timeLayout)
+	c.machines = append(c.machines, m)
+	if m.ComputeNode, m.provisionError = c.placeMachine(m.Memory, m.Disk); m.provisionError != nil {
+		// The machine is accepted, but no compute node can take it
+		c.startTransition(m, ActionProvision, "provisioning", "failed", nil)
+	} else {
+		c.startTransition(m, ActionProvision, "provisioning", "running", nil)
 	}
 
-	c.machines = append(c.machines, &machine{newMachine, nics, nicNetworks})
+	return copyMachine(&m.Machine), nil
+}
 
-	return &newMachine, nil
+// UpdateMachine performs an action on a machine, as the POST requests of
+// the machine do: stop, start, reboot, resize with the "package" option,
+// rename with the "name" option, enable_firewall or disable_firewall. It
+// calls the operation of the action, which reaches its own control point.
+func (c *CloudAPI) UpdateMachine(machineID, action string, options map[string]string) (err error) {
+	call, err := c.StartCall(HookUpdateMachine, c, machineID, action, options)
+	if err != nil {
+		return err
+	}
+	defer c.ProcessAfterHook(call, c, nil, &err)
+
+	switch action {
+	case "stop":
+		return c.StopMachine(machineID)
+	case "start":
+		return c.StartMachine(machineID)
+	case "reboot":
+		return c.RebootMachine(machineID)
+	case "resize":
+		return c.ResizeMachine(machineID, options["package"])
+	case "rename":
+		return c.RenameMachine(machineID, options["name"])
+	case "enable_firewall":
+		return c.EnableFirewallMachine(machineID)
+	case "disable_firewall":
+		return c.DisableFirewallMachine(machineID)
+	}
+	return invalidArgumentError("%s is not a valid action", action)
 }
 
-// StopMachine changes a machine's status to "stopped"
-func (c *CloudAPI) StopMachine(machineID string) error {
-	if err := c.ProcessFunctionHook(c, machineID); err != nil {
+// StopMachine stops a machine. It is stopping until the ActionStop transition
+// completes, and stopped after that.
+func (c *CloudAPI) StopMachine(machineID string) (err error) {
+	call, err := c.StartCall(HookStopMachine, c, machineID)
+	if err != nil {
 		return err
 	}
+	defer c.ProcessAfterHook(call, c, nil, &err)
 
-	for _, machine := range c.machines {
-		if machine.Id == machineID {
-			machine.State = "stopped"
-			machine.Updated = time.Now().Format("2013-11-26T19:47:13.448Z")
-			return nil
-		}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.settle()
+	machine, err := c.getMachineWrapper(machineID)
+	if err != nil {
+		return err
+	}
+	if err := checkIdle(machine); err != nil {
+		return err
 	}
 
-	return fmt.Errorf("Machine %s not found", machineID)
+	c.startTransition(machine, ActionStop, "stopping", "stopped", nil)
+	return nil
 }
 
-// StartMachine changes a machine's state to "running"
-func (c *CloudAPI) StartMachine(machineID string) error {
-	if err := c.ProcessFunctionHook(c, machineID); err != nil {
+// StartMachine starts a machine. It keeps its state until the ActionStart
+// transition completes, and is running after that.
+func (c *CloudAPI) StartMachine(machineID string) (err error) {
+	call, err := c.StartCall(HookStartMachine, c, machineID)
+	if err != nil {
 		return err
 	}
+	defer c.ProcessAfterHook(call, c, nil, &err)
 
-	for _, machine := range c.machines {
-		if machine.Id == machineID {
-			machine.State = "running"
-			machine.Updated = time.Now().Format("2013-11-26T19:47:13.448Z")
-			return nil
-		}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.settle()
+	machine, err := c.getMachineWrapper(machineID)
+	if err != nil {
+		return err
+	}
+	if err := checkIdle(machine); err != nil {
+		return err
 	}
 
-	return fmt.Errorf("Machine %s not found", machineID)
+	c.startTransition(machine, ActionStart, machine.State, "running", nil)
+	return nil
 }
 
-// RebootMachine changes a machine's state to "running" and updates Updated
-func (c *CloudAPI) RebootMachine(machineID string) error {
-	if err := c.ProcessFunctionHook(c, machineID); err != nil {
+// RebootMachine reboots a machine. It is stopping until the ActionReboot
+// transition completes, and running after that.
+func (c *CloudAPI) RebootMachine(machineID string) (err error) {
+	call, err := c.StartCall(HookRebootMachine, c, machineID)
+	if err != nil {
 		return err
 	}
+	defer c.ProcessAfterHook(call, c, nil, &err)
 
-	for _, machine := range c.machines {
-		if machine.Id == machineID {
-			machine.State = "running"
-			machine.Updated = time.Now().Format("2013-11-26T19:47:13.448Z")
-			return nil
-		}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.settle()
+	machine, err := c.getMachineWrapper(machineID)
+	if err != nil {
+		return err
+	}
+	if err := checkIdle(machine); err != nil {
+		return err
 	}
 
-	return fmt.Errorf("Machine %s not found", machineID)
+	c.startTransition(machine, ActionReboot, "stopping", "running", nil)
+	return nil
 }
 
-// ResizeMachine changes a machine's package to a new size. Unlike the real API,
-// this method lets you downsize machines.
-func (c *CloudAPI) ResizeMachine(machineID, packageName string) error {
-	if err := c.ProcessFunctionHook(c, machineID, packageName); err != nil {
+// ResizeMachine changes a machine's package to a new size once the
+// ActionResize transition completes. Unlike the real API, this method lets you
+// downsize machines.
+func (c *CloudAPI) ResizeMachine(machineID, packageName string) (err error) {
+	call, err := c.StartCall(HookResizeMachine, c, machineID, packageName)
+	if err != nil {
 		return err
 	}
+	defer c.ProcessAfterHook(call, c, nil, &err)
 
 	mPkg, err := c.GetPackage(packageName)
 	if err != nil {
-		return err
+		return asInvalidArgument(err)
 	}
 
-	for _, machine := range c.machines {
-		if machine.Id == machineID {
-			machine.Package = packageName
-			machine.Memory = mPkg.Memory
-			machine.Disk = mPkg.Disk
-			machine.Updated = time.Now().Format("2013-11-26T19:47:13.448Z")
-			return nil
-		}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.settle()
+	wrapper, err := c.getMachineWrapper(machineID)
+	if err != nil {
+		return err
+	}
+	if err := checkIdle(wrapper); err != nil {
+		return err
+	}
+	if err := c.checkLimits(0, mPkg.Memory-wrapper.Memory, mPkg.Disk-wrapper.Disk); err != nil {
+		return err
+	}
+	if err := c.checkResize(wrapper, mPkg.Memory, mPkg.Disk); err != nil {
+		return err
 	}
 
-	return fmt.Errorf("Machine %s not found", machineID)
+	c.startTransition(wrapper, ActionResize, wrapper.State, wrapper.State, func(m *machine) {
+		m.Package = packageName
+		m.Memory = mPkg.Memory
+		m.Disk = mPkg.Disk
+	})
+	return nil
 }
 
 // RenameMachine changes a machine's name
-func (c *CloudAPI) RenameMachine(machineID, newName string) error {
-	if err := c.ProcessFunctionHook(c, machineID, newName); err != nil {
+func (c *CloudAPI) RenameMachine(machineID, newName string) (err error) {
+	call, err := c.StartCall(HookRenameMachine, c, machineID, newName)
+	if err != nil {
 		return err
 	}
+	defer c.ProcessAfterHook(call, c, nil, &err)
 
-	for _, machine := range c.machines {
-		if machine.Id == machineID {
-			machine.Name = newName
-			machine.Updated = time.Now().Format("2013-11-26T19:47:13.448Z")
-			return nil
-		}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.settle()
+	machine, err := c.getMachineWrapper(machineID)
+	if err != nil {
+		return err
 	}
 
-	return fmt.Errorf("Machine %s not found", machineID)
+	machine.Name = newName
+	machine.Updated = c.now().UTC().Format(timeLayout)
+	return nil
 }
 
 // ListMachineFirewallRules returns a list of firewall rules that apply to the
 // given machine
-func (c *CloudAPI) ListMachineFirewallRules(machineID string) ([]*cloudapi.FirewallRule, error) {
-	if err := c.ProcessFunctionHook(c, machineID); err != nil {
+func (c *CloudAPI) ListMachineFirewallRules(machineID string) (result []*cloudapi.FirewallRule, err error) {
+	call, err := c.StartCall(HookListMachineFirewallRules, c, machineID)
+	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
 	fwRules := []*cloudapi.FirewallRule{}
 	for _, r := range c.firewallRules {
 		vm := "vm " + machineID
 		if strings.Contains(r.Rule, vm) {
-			fwRules = append(fwRules, r)
+			rule := *r
+			fwRules = append(fwRules, &rule)
 		}
 	}
 
@@ -279,12 +415,17 @@ func (c *CloudAPI) ListMachineFirewallRules(machineID string) ([]*cloudapi.Firew
 }
 
 // EnableFirewallMachine enables the firewall for the given machine
-func (c *CloudAPI) EnableFirewallMachine(machineID string) error {
-	if err := c.ProcessFunctionHook(c, machineID); err != nil {
+func (c *CloudAPI) EnableFirewallMachine(machineID string) (err error) {
+	call, err := c.StartCall(HookEnableFirewallMachine, c, machineID)
+	if err != nil {
 		return err
 	}
+	defer c.ProcessAfterHook(call, c, nil, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	machine, err := c.GetMachine(machineID)
+	machine, err := c.getMachineWrapper(machineID)
 	if err != nil {
 		return err
 	}
@@ -295,12 +436,17 @@ func (c *CloudAPI) EnableFirewallMachine(machineID string) error {
 }
 
 // DisableFirewallMachine disables the firewall for the given machine
-func (c *CloudAPI) DisableFirewallMachine(machineID string) error {
-	if err := c.ProcessFunctionHook(c, machineID); err != nil {
+func (c *CloudAPI) DisableFirewallMachine(machineID string) (err error) {
+	call, err := c.StartCall(HookDisableFirewallMachine, c, machineID)
+	if err != nil {
 		return err
 	}
+	defer c.ProcessAfterHook(call, c, nil, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	machine, err := c.GetMachine(machineID)
+	machine, err := c.getMachineWrapper(machineID)
 	if err != nil {
 		return err
 	}
@@ -310,22 +456,30 @@ func (c *CloudAPI) DisableFirewallMachine(machineID string) error {
 	return nil
 }
 
-// DeleteMachine deletes the given machine from the double
-func (c *CloudAPI) DeleteMachine(machineID string) error {
-	if err := c.ProcessFunctionHook(c, machineID); err != nil {
+// DeleteMachine deletes the given machine from the double. It is reported as
+// deleted until the ActionDelete transition completes, and gone after that.
+func (c *CloudAPI) DeleteMachine(machineID string) (err error) {
+	call, err := c.StartCall(HookDeleteMachine, c, machineID)
+	if err != nil {
 		return err
 	}
+	defer c.ProcessAfterHook(call, c, nil, &err)
 
-	for i, machine := range c.machines {
-		if machine.Id == machineID {
-			if machine.State == "stopped" {
-				c.machines = append(c.machines[:i], c.machines[i+1:]...)
-				return nil
-			}
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-			return fmt.Errorf("Cannot Delete machine %s, machine is not stopped.", machineID)
-		}
+	c.settle()
+	machine, err := c.getMachineWrapper(machineID)
+	if err != nil {
+		return err
+	}
+	if err := checkIdle(machine); err != nil {
+		return err
+	}
+	if machine.State != "stopped" && machine.State != "failed" {
+		return stateError("Cannot Delete machine %s, machine is not stopped.", machineID)
 	}
 
-	return fmt.Errorf("Machine %s not found", machineID)
+	c.startTransition(machine, ActionDelete, "deleted", "", nil)
+	return nil
 }
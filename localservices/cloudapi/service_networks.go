@@ -1,7 +1,8 @@
 package cloudapi
 
 import (
-	"fmt"
+	"net/netip"
+	"sort"
 	"strings"
 
 	"github.com/joyent/gosdc/cloudapi"
@@ -9,26 +10,250 @@ import (
 
 // Networks API
 
-// ListNetworks returns a list of networks that the double knows about
-func (c *CloudAPI) ListNetworks() ([]cloudapi.Network, error) {
-	if err := c.ProcessFunctionHook(c); err != nil {
+// ListNetworks returns a list of networks that the double knows about,
+// followed by the fabric networks of the account
+func (c *CloudAPI) ListNetworks() (result []cloudapi.Network, err error) {
+	call, err := c.StartCall(HookListNetworks, c)
+	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
 
-	return c.networks, nil
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	out := []cloudapi.Network{}
+	for _, n := range c.primary.networks {
+		out = append(out, copyNetwork(n))
+	}
+
+	return append(out, c.fabricNetworks()...), nil
 }
 
-// GetNetwork gets a network by ID
-func (c *CloudAPI) GetNetwork(networkID string) (*cloudapi.Network, error) {
-	if err := c.ProcessFunctionHook(c, networkID); err != nil {
+// GetNetwork gets a network, which may be a fabric network of the account, by
+// ID
+func (c *CloudAPI) GetNetwork(networkID string) (result *cloudapi.Network, err error) {
+	call, err := c.StartCall(HookGetNetwork, c, networkID)
+	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.findNetwork(networkID)
+}
+
+// defaultNetworks returns the networks a machine created on no network is
+// on, as in CloudAPI: the first public network of the double and the first
+// private one. The caller must hold c.mu.
+func (c *CloudAPI) defaultNetworks() []string {
+	var public, private string
+	for _, n := range c.primary.networks {
+		if n.Public && public == "" {
+			public = n.Id
+		} else if !n.Public && private == "" {
+			private = n.Id
+		}
+	}
+	var networks []string
+	for _, id := range []string{public, private} {
+		if id != "" {
+			networks = append(networks, id)
+		}
+	}
+	return networks
+}
 
-	for _, n := range c.networks {
+// findNetwork returns a network of the double or a fabric network of the
+// account. The caller must hold c.mu.
+func (c *CloudAPI) findNetwork(networkID string) (*cloudapi.Network, error) {
+	for _, n := range c.primary.networks {
 		if strings.EqualFold(n.Id, networkID) {
-			return &n, nil
+			out := copyNetwork(n)
+			return &out, nil
+		}
+	}
+	for _, vlan := range c.fabricVLANs {
+		for _, n := range vlan.Networks {
+			if strings.EqualFold(n.Id, networkID) {
+				out := fabricNetworkAsNetwork(n)
+				return &out, nil
+			}
+		}
+	}
+
+	return nil, notFoundError("Network %s not found", networkID)
+}
+
+// fabricNetworks returns the fabric networks of the account as networks,
+// ordered by VLAN and ID. The caller must hold c.mu.
+func (c *CloudAPI) fabricNetworks() []cloudapi.Network {
+	ids := make([]int, 0, len(c.fabricVLANs))
+	for id := range c.fabricVLANs {
+		ids = append(ids, int(id))
+	}
+	sort.Ints(ids)
+
+	out := []cloudapi.Network{}
+	for _, id := range ids {
+		networks := []cloudapi.FabricNetwork{}
+		for _, n := range c.fabricVLANs[int16(id)].Networks {
+			networks = append(networks, *n)
+		}
+		sort.Sort(fabricNetworksByID(networks))
+		for i := range networks {
+			out = append(out, fabricNetworkAsNetwork(&networks[i]))
+		}
+	}
+	return out
+}
+
+// fabricNetworkAsNetwork returns a fabric network as CloudAPI lists it among
+// the other networks
+func fabricNetworkAsNetwork(n *cloudapi.FabricNetwork) cloudapi.Network {
+	return cloudapi.Network{
+		Id:               n.Id,
+		Name:             n.Name,
+		Public:           n.Public,
+		Fabric:           true,
+		Description:      n.Description,
+		Subnet:           n.Subnet,
+		ProvisionStartIp: n.ProvisionStartIp,
+		ProvisionEndIp:   n.ProvisionEndIp,
+		Gateway:          n.Gateway,
+		Resolvers:        copyStrings(n.Resolvers),
+		Routes:           copyStringMap(n.Routes),
+		InternetNAT:      n.InternetNAT,
+		VLANId:           n.VLANId,
+
+		Subnet6:           n.Subnet6,
+		ProvisionStartIp6: n.ProvisionStartIp6,
+		ProvisionEndIp6:   n.ProvisionEndIp6,
+		Gateway6:          n.Gateway6,
+	}
+}
+
+func copyNetwork(n cloudapi.Network) cloudapi.Network {
+	n.Resolvers = copyStrings(n.Resolvers)
+	n.Routes = copyStringMap(n.Routes)
+	return n
+}
+
+// copyNetworks returns a deep copy of a list of networks, empty rather than
+// nil
+func copyNetworks(networks []cloudapi.Network) []cloudapi.Network {
+	out := make([]cloudapi.Network, len(networks))
+	for i, n := range networks {
+		out[i] = copyNetwork(n)
+	}
+	return out
+}
+
+// ListNetworkIPs lists the IPs of a network that are managed by the
+// datacenter, or reserved or used by the account, sorted by address
+func (c *CloudAPI) ListNetworkIPs(networkID string) (result []cloudapi.NetworkIP, err error) {
+	call, err := c.StartCall(HookListNetworkIPs, c, networkID)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.settleAll()
+	ranges, err := c.networkRanges(networkID)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := []netip.Addr{}
+	ips := map[netip.Addr]*cloudapi.NetworkIP{}
+	for _, r := range ranges {
+		for addr, ip := range c.networkIPs(r) {
+			ips[addr] = ip
+			if ip.Managed || ip.OwnerUUID == c.accountID {
+				addrs = append(addrs, addr)
+			}
 		}
 	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Less(addrs[j]) })
+
+	out := []cloudapi.NetworkIP{}
+	for _, addr := range addrs {
+		out = append(out, *ips[addr])
+	}
+	return out, nil
+}
+
+// GetNetworkIP gets an IP of a network, which need not be in use
+func (c *CloudAPI) GetNetworkIP(networkID, ipAddress string) (result *cloudapi.NetworkIP, err error) {
+	call, err := c.StartCall(HookGetNetworkIP, c, networkID, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	return nil, fmt.Errorf("Network %s not found", networkID)
+	c.settleAll()
+	return c.getNetworkIP(networkID, ipAddress)
+}
+
+// UpdateNetworkIP reserves an IP of a network, so that it is not given to new
+// NICs, or releases it. IPs managed by the datacenter or used by another
+// account cannot be updated.
+func (c *CloudAPI) UpdateNetworkIP(networkID, ipAddress string, reserved bool) (result *cloudapi.NetworkIP, err error) {
+	call, err := c.StartCall(HookUpdateNetworkIP, c, networkID, ipAddress, reserved)
+	if err != nil {
+		return nil, err
+	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.settleAll()
+	r, addr, err := c.addrRange(networkID, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	if ip := c.networkIPs(r)[addr]; ip != nil {
+		if ip.Managed {
+			return nil, invalidArgumentError("IP %s is managed by the datacenter and cannot be updated", ipAddress)
+		}
+		if ip.OwnerUUID != c.accountID {
+			return nil, conflictError("IP %s is in use by another account", ipAddress)
+		}
+	}
+
+	if reserved {
+		if c.reservedIPs[r.networkID] == nil {
+			c.reservedIPs[r.networkID] = map[string]bool{}
+		}
+		c.reservedIPs[r.networkID][addr.String()] = true
+	} else {
+		delete(c.reservedIPs[r.networkID], addr.String())
+	}
+
+	return c.getNetworkIP(networkID, ipAddress)
+}
+
+// getNetworkIP returns an IP of a network as the account sees it. The caller
+// must hold c.mu.
+func (c *CloudAPI) getNetworkIP(networkID, ipAddress string) (*cloudapi.NetworkIP, error) {
+	r, addr, err := c.addrRange(networkID, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	ip := c.networkIPs(r)[addr]
+	if ip == nil {
+		ip = &cloudapi.NetworkIP{IP: addr.String()}
+	}
+	out := c.visibleIP(ip)
+	return &out, nil
 }
@@ -1,19 +1,24 @@
 package cloudapi
 
 import (
-	"fmt"
 	"strconv"
 
 	"github.com/joyent/gosdc/cloudapi"
 )
 
 // ListPackages lists packages in the double
-func (c *CloudAPI) ListPackages(filters map[string]string) ([]cloudapi.Package, error) {
-	if err := c.ProcessFunctionHook(c, filters); err != nil {
+func (c *CloudAPI) ListPackages(filters map[string]string) (result []cloudapi.Package, err error) {
+	call, err := c.StartCall(HookListPackages, c, filters)
+	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
 
-	availablePackages := c.packages
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	availablePackages := make([]cloudapi.Package, len(c.primary.packages))
+	copy(availablePackages, c.primary.packages)
 
 	if filters != nil {
 		for k, f := range filters {
@@ -59,12 +64,17 @@ func (c *CloudAPI) ListPackages(filters map[string]string) ([]cloudapi.Package,
 }
 
 // GetPackage gets a single package in the double
-func (c *CloudAPI) GetPackage(packageName string) (*cloudapi.Package, error) {
-	if err := c.ProcessFunctionHook(c, packageName); err != nil {
+func (c *CloudAPI) GetPackage(packageName string) (result *cloudapi.Package, err error) {
+	call, err := c.StartCall(HookGetPackage, c, packageName)
+	if err != nil {
 		return nil, err
 	}
+	defer c.ProcessAfterHook(call, c, &result, &err)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
 
-	for _, pkg := range c.packages {
+	for _, pkg := range c.primary.packages {
 		if pkg.Name == packageName {
 			return &pkg, nil
 		}
@@ -73,5 +83,5 @@ func (c *CloudAPI) GetPackage(packageName string) (*cloudapi.Package, error) {
 		}
 	}
 
-	return nil, fmt.Errorf("Package %s not found", packageName)
+	return nil, notFoundError("Package %s not found", packageName)
 }
@@ -9,11 +9,17 @@
 package cloudapi_test
 
 import (
-	gc "launchpad.net/gocheck"
+	"fmt"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
+
+	gc "launchpad.net/gocheck"
 
 	"github.com/joyent/gosdc/cloudapi"
 	lc "github.com/joyent/gosdc/localservices/cloudapi"
+	"github.com/joyent/gosdc/localservices/hook"
 )
 
 type CloudAPISuite struct {
@@ -213,7 +219,8 @@ func (s *CloudAPISuite) TestGetMachine(c *gc.C) {
 }
 
 func (s *CloudAPISuite) TestCreateMachine(c *gc.C) {
-	m := s.createMachine(c, testMachineName, testPackage, testImage, nil, nil)
+	m, err := s.service.CreateMachine(testMachineName, testPackage, testImage, nil, nil, nil)
+	c.Assert(err, gc.IsNil)
 	defer s.deleteMachine(c, m.Id)
 
 	c.Assert(m.Name, gc.Equals, testMachineName)
@@ -221,6 +228,8 @@ func (s *CloudAPISuite) TestCreateMachine(c *gc.C) {
 	c.Assert(m.Image, gc.Equals, testImage)
 	c.Assert(m.Type, gc.Equals, "virtualmachine")
 	c.Assert(len(m.IPs), gc.Equals, 2)
+	c.Assert(m.Networks, gc.DeepEquals, []string{testNetworkID, "456def0a-33ff-7f8e-9a0b-33bb44cc"})
+	c.Assert(m.PrimaryIP, gc.Equals, m.IPs[0])
 	c.Assert(m.State, gc.Equals, "running")
 }
 
@@ -316,6 +325,776 @@ func (s *CloudAPISuite) TestDeleteMachine(c *gc.C) {
 	s.deleteMachine(c, m.Id)
 }
 
+// Tests for Machine Snapshots API
+func (s *CloudAPISuite) TestCreateMachineSnapshot(c *gc.C) {
+	m := s.createMachine(c, testMachineName, testPackage, testImage, nil, nil)
+	defer s.deleteMachine(c, m.Id)
+
+	snapshot, err := s.service.CreateMachineSnapshot(m.Id, "test-snapshot")
+	c.Assert(err, gc.IsNil)
+	c.Assert(snapshot, gc.DeepEquals, &cloudapi.Snapshot{Name: "test-snapshot", State: "queued"})
+
+	_, err = s.service.CreateMachineSnapshot(m.Id, "test-snapshot")
+	c.Assert(err, gc.ErrorMatches, "Snapshot test-snapshot already exists for machine .*")
+}
+
+func (s *CloudAPISuite) TestListMachineSnapshots(c *gc.C) {
+	m := s.createMachine(c, testMachineName, testPackage, testImage, nil, nil)
+	defer s.deleteMachine(c, m.Id)
+
+	_, err := s.service.CreateMachineSnapshot(m.Id, "test-snapshot")
+	c.Assert(err, gc.IsNil)
+
+	snapshots, err := s.service.ListMachineSnapshots(m.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(snapshots, gc.DeepEquals, []cloudapi.Snapshot{{Name: "test-snapshot", State: "created"}})
+}
+
+func (s *CloudAPISuite) TestGetMachineSnapshot(c *gc.C) {
+	m := s.createMachine(c, testMachineName, testPackage, testImage, nil, nil)
+	defer s.deleteMachine(c, m.Id)
+
+	_, err := s.service.CreateMachineSnapshot(m.Id, "test-snapshot")
+	c.Assert(err, gc.IsNil)
+
+	snapshot, err := s.service.GetMachineSnapshot(m.Id, "test-snapshot")
+	c.Assert(err, gc.IsNil)
+	c.Assert(snapshot, gc.DeepEquals, &cloudapi.Snapshot{Name: "test-snapshot", State: "created"})
+
+	_, err = s.service.GetMachineSnapshot(m.Id, "missing")
+	c.Assert(err, gc.ErrorMatches, "Snapshot missing not found for machine .*")
+}
+
+func (s *CloudAPISuite) TestStartMachineFromSnapshot(c *gc.C) {
+	m := s.createMachine(c, testMachineName, testPackage, testImage,
+		map[string]string{"role": "web"}, map[string]string{"env": "test"})
+	defer s.deleteMachine(c, m.Id)
+
+	_, err := s.service.CreateMachineSnapshot(m.Id, "test-snapshot")
+	c.Assert(err, gc.IsNil)
+
+	_, err = s.service.UpdateMachineMetadata(m.Id, map[string]string{"role": "db"})
+	c.Assert(err, gc.IsNil)
+	_, err = s.service.AddMachineTags(m.Id, map[string]string{"extra": "tag"})
+	c.Assert(err, gc.IsNil)
+
+	err = s.service.StartMachineFromSnapshot(m.Id, "test-snapshot")
+	c.Assert(err, gc.ErrorMatches, "Cannot start machine .* from snapshot, machine is not stopped.")
+
+	err = s.service.StopMachine(m.Id)
+	c.Assert(err, gc.IsNil)
+	err = s.service.StartMachineFromSnapshot(m.Id, "test-snapshot")
+	c.Assert(err, gc.IsNil)
+
+	machine, err := s.service.GetMachine(m.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(machine.State, gc.Equals, "running")
+	c.Assert(machine.Metadata, gc.DeepEquals, map[string]string{"role": "web"})
+	c.Assert(machine.Tags, gc.DeepEquals, map[string]string{"env": "test"})
+}
+
+func (s *CloudAPISuite) TestDeleteMachineSnapshot(c *gc.C) {
+	m := s.createMachine(c, testMachineName, testPackage, testImage, nil, nil)
+	defer s.deleteMachine(c, m.Id)
+
+	_, err := s.service.CreateMachineSnapshot(m.Id, "test-snapshot")
+	c.Assert(err, gc.IsNil)
+
+	err = s.service.DeleteMachineSnapshot(m.Id, "test-snapshot")
+	c.Assert(err, gc.IsNil)
+
+	snapshots, err := s.service.ListMachineSnapshots(m.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(snapshots, gc.HasLen, 0)
+}
+
+func (s *CloudAPISuite) TestDeleteMachineRemovesSnapshots(c *gc.C) {
+	m := s.createMachine(c, testMachineName, testPackage, testImage, nil, nil)
+
+	_, err := s.service.CreateMachineSnapshot(m.Id, "test-snapshot")
+	c.Assert(err, gc.IsNil)
+
+	s.deleteMachine(c, m.Id)
+
+	_, err = s.service.ListMachineSnapshots(m.Id)
+	c.Assert(err, gc.ErrorMatches, "Machine .* not found")
+}
+
+// Tests for machine state transitions
+func (s *CloudAPISuite) newTimedService(c *gc.C) (*lc.CloudAPI, *lc.FakeClock) {
+	service := lc.New(testServiceURL, testUserAccount)
+	clock := lc.NewFakeClock(time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC))
+	service.SetClock(clock)
+	for _, action := range []string{lc.ActionProvision, lc.ActionStart, lc.ActionStop, lc.ActionReboot, lc.ActionResize, lc.ActionDelete} {
+		service.SetTransition(action, lc.Transition{Duration: 10 * time.Second})
+	}
+	return service, clock
+}
+
+func assertMachineState(c *gc.C, service *lc.CloudAPI, machineID, state string) {
+	m, err := service.GetMachine(machineID)
+	c.Assert(err, gc.IsNil)
+	c.Assert(m.State, gc.Equals, state)
+}
+
+func (s *CloudAPISuite) TestMachineTransitions(c *gc.C) {
+	service, clock := s.newTimedService(c)
+
+	m, err := service.CreateMachine(testMachineName, testPackage, testImage, nil, nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(m.State, gc.Equals, "provisioning")
+	c.Assert(m.Created, gc.Equals, "2016-01-01T00:00:00.000Z")
+
+	err = service.StopMachine(m.Id)
+	c.Assert(err, gc.ErrorMatches, "Machine .* is provisioning, wait for it to provision")
+
+	clock.Advance(9 * time.Second)
+	assertMachineState(c, service, m.Id, "provisioning")
+	clock.Advance(time.Second)
+	assertMachineState(c, service, m.Id, "running")
+	machine, err := service.GetMachine(m.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(machine.Updated, gc.Equals, "2016-01-01T00:00:10.000Z")
+
+	c.Assert(service.RebootMachine(m.Id), gc.IsNil)
+	assertMachineState(c, service, m.Id, "stopping")
+	clock.Advance(10 * time.Second)
+	assertMachineState(c, service, m.Id, "running")
+
+	c.Assert(service.ResizeMachine(m.Id, "Medium"), gc.IsNil)
+	machine, err = service.GetMachine(m.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(machine.Package, gc.Equals, testPackage)
+	clock.Advance(10 * time.Second)
+	machine, err = service.GetMachine(m.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(machine.Package, gc.Equals, "Medium")
+
+	c.Assert(service.StopMachine(m.Id), gc.IsNil)
+	assertMachineState(c, service, m.Id, "stopping")
+	clock.Advance(10 * time.Second)
+	assertMachineState(c, service, m.Id, "stopped")
+
+	c.Assert(service.StartMachine(m.Id), gc.IsNil)
+	assertMachineState(c, service, m.Id, "stopped")
+	clock.Advance(10 * time.Second)
+	assertMachineState(c, service, m.Id, "running")
+
+	c.Assert(service.StopMachine(m.Id), gc.IsNil)
+	clock.Advance(10 * time.Second)
+	c.Assert(service.DeleteMachine(m.Id), gc.IsNil)
+	assertMachineState(c, service, m.Id, "deleted")
+	count, err := service.CountMachines()
+	c.Assert(err, gc.IsNil)
+	c.Assert(count, gc.Equals, 0)
+
+	clock.Advance(10 * time.Second)
+	_, err = service.GetMachine(m.Id)
+	c.Assert(err, gc.ErrorMatches, "Machine .* not found")
+}
+
+func (s *CloudAPISuite) TestMachineTransitionFailures(c *gc.C) {
+	service, clock := s.newTimedService(c)
+	service.SetTransition(lc.ActionProvision, lc.Transition{Duration: 10 * time.Second, Failures: 1})
+	service.SetTransition(lc.ActionStop, lc.Transition{Failures: -1, FailState: "running"})
+
+	failed, err := service.CreateMachine(testMachineName, testPackage, testImage, nil, nil, nil)
+	c.Assert(err, gc.IsNil)
+	clock.Advance(10 * time.Second)
+	assertMachineState(c, service, failed.Id, "failed")
+
+	// Failed machines can be deleted straight away.
+	c.Assert(service.DeleteMachine(failed.Id), gc.IsNil)
+
+	m, err := service.CreateMachine(testMachineName, testPackage, testImage, nil, nil, nil)
+	c.Assert(err, gc.IsNil)
+	clock.Advance(10 * time.Second)
+	assertMachineState(c, service, m.Id, "running")
+
+	for i := 0; i < 2; i++ {
+		c.Assert(service.StopMachine(m.Id), gc.IsNil)
+		assertMachineState(c, service, m.Id, "running")
+	}
+}
+
+func (s *CloudAPISuite) TestSnapshotTransitions(c *gc.C) {
+	service, clock := s.newTimedService(c)
+	service.SetTransition(lc.ActionSnapshot, lc.Transition{Duration: 10 * time.Second})
+
+	m, err := service.CreateMachine(testMachineName, testPackage, testImage, nil, nil, nil)
+	c.Assert(err, gc.IsNil)
+	clock.Advance(10 * time.Second)
+	c.Assert(service.StopMachine(m.Id), gc.IsNil)
+	clock.Advance(10 * time.Second)
+
+	_, err = service.CreateMachineSnapshot(m.Id, "test-snapshot")
+	c.Assert(err, gc.IsNil)
+	clock.Advance(9 * time.Second)
+	snapshot, err := service.GetMachineSnapshot(m.Id, "test-snapshot")
+	c.Assert(err, gc.IsNil)
+	c.Assert(snapshot.State, gc.Equals, "queued")
+	err = service.StartMachineFromSnapshot(m.Id, "test-snapshot")
+	c.Assert(err, gc.ErrorMatches, "Cannot start machine .* from snapshot test-snapshot, snapshot is queued.")
+
+	clock.Advance(time.Second)
+	snapshots, err := service.ListMachineSnapshots(m.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(snapshots, gc.DeepEquals, []cloudapi.Snapshot{{Name: "test-snapshot", State: "created"}})
+	c.Assert(service.StartMachineFromSnapshot(m.Id, "test-snapshot"), gc.IsNil)
+
+	service.SetTransition(lc.ActionSnapshot, lc.Transition{Failures: 1})
+	_, err = service.CreateMachineSnapshot(m.Id, "failed-snapshot")
+	c.Assert(err, gc.IsNil)
+	snapshot, err = service.GetMachineSnapshot(m.Id, "failed-snapshot")
+	c.Assert(err, gc.IsNil)
+	c.Assert(snapshot.State, gc.Equals, "failed")
+}
+
+// Tests for account limits and compute capacity
+func (s *CloudAPISuite) TestLimits(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+	c.Assert(service.SetLimits(lc.Limits{Machines: -1}), gc.ErrorMatches, "Limits must not be negative")
+	c.Assert(service.SetLimits(lc.Limits{Machines: 2, Memory: 2560}), gc.IsNil)
+	c.Assert(service.Limits(), gc.Equals, lc.Limits{Machines: 2, Memory: 2560})
+
+	m, err := service.CreateMachine(testMachineName, testPackage, testImage, nil, nil, nil)
+	c.Assert(err, gc.IsNil)
+	_, err = service.CreateMachine(testMachineName, "Medium", testImage, nil, nil, nil)
+	c.Assert(err, gc.ErrorMatches, "Quota exceeded; .*")
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeQuotaExceeded)
+	err = service.ResizeMachine(m.Id, "Large")
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeQuotaExceeded)
+
+	_, err = service.CreateMachine(testMachineName, "Micro", testImage, nil, nil, nil)
+	c.Assert(err, gc.IsNil)
+	_, err = service.CreateMachine(testMachineName, "Micro", testImage, nil, nil, nil)
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeQuotaExceeded)
+
+	// Shrinking a machine is within limits even with the account at its
+	// machine limit.
+	c.Assert(service.ResizeMachine(m.Id, "Micro"), gc.IsNil)
+
+	c.Assert(service.StopMachine(m.Id), gc.IsNil)
+	c.Assert(service.DeleteMachine(m.Id), gc.IsNil)
+	_, err = service.CreateMachine(testMachineName, "Medium", testImage, nil, nil, nil)
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *CloudAPISuite) TestComputeNodes(c *gc.C) {
+	service, clock := s.newTimedService(c)
+	err := service.SetComputeNodes([]lc.ComputeNode{{Id: "cn1", Memory: 2048, Disk: 65536}, {Id: "cn1", Memory: 1024, Disk: 65536}})
+	c.Assert(err, gc.ErrorMatches, "Compute node cn1 is given twice")
+	err = service.SetComputeNodes([]lc.ComputeNode{{Id: "cn1", Memory: 2048, Disk: 65536}, {Id: "cn2", Memory: 1024, Disk: 65536}})
+	c.Assert(err, gc.IsNil)
+
+	first, err := service.CreateMachine(testMachineName, "Medium", testImage, nil, nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(first.ComputeNode, gc.Equals, "cn1")
+	second, err := service.CreateMachine(testMachineName, testPackage, testImage, nil, nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(second.ComputeNode, gc.Equals, "cn2")
+
+	// The pool is full: the machine is accepted but fails to provision.
+	full, err := service.CreateMachine(testMachineName, "Micro", testImage, nil, nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(full.ComputeNode, gc.Equals, "")
+	c.Assert(full.State, gc.Equals, "provisioning")
+	clock.Advance(10 * time.Second)
+	assertMachineState(c, service, full.Id, "failed")
+	assertMachineState(c, service, first.Id, "running")
+	err = service.ProvisionError(full.Id)
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeInsufficientCapacity)
+	c.Assert(service.ProvisionError(first.Id), gc.IsNil)
+
+	err = service.ResizeMachine(second.Id, "Medium")
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeInsufficientCapacity)
+
+	c.Assert(service.NodeUsage(), gc.DeepEquals, []lc.NodeUsage{
+		{ComputeNode: lc.ComputeNode{Id: "cn1", Memory: 2048, Disk: 65536}, Machines: []string{first.Id}, UsedMemory: 2048, UsedDisk: 32768},
+		{ComputeNode: lc.ComputeNode{Id: "cn2", Memory: 1024, Disk: 65536}, Machines: []string{second.Id}, UsedMemory: 1024, UsedDisk: 16384},
+	})
+
+	// Deleted machines free their compute node once gone.
+	c.Assert(service.StopMachine(first.Id), gc.IsNil)
+	clock.Advance(10 * time.Second)
+	c.Assert(service.DeleteMachine(first.Id), gc.IsNil)
+	clock.Advance(10 * time.Second)
+	m, err := service.CreateMachine(testMachineName, "Micro", testImage, nil, nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(m.ComputeNode, gc.Equals, "cn1")
+}
+
+func (s *CloudAPISuite) TestFixtureCapacity(c *gc.C) {
+	f, err := lc.ParseFixture([]byte(`
+limits:
+  machines: 10
+compute_nodes:
+  - id: cn1
+    memory: 4096
+    disk: 102400
+`))
+	c.Assert(err, gc.IsNil)
+
+	service := lc.New(testServiceURL, testUserAccount)
+	c.Assert(service.LoadFixture(f), gc.IsNil)
+	c.Assert(service.Limits(), gc.Equals, lc.Limits{Machines: 10})
+	c.Assert(service.ComputeNodes(), gc.DeepEquals, []lc.ComputeNode{{Id: "cn1", Memory: 4096, Disk: 102400}})
+
+	dumped := service.DumpFixture()
+	c.Assert(*dumped.Limits, gc.Equals, lc.Limits{Machines: 10})
+	c.Assert(dumped.ComputeNodes, gc.DeepEquals, service.ComputeNodes())
+
+	err = service.LoadFixture(&lc.Fixture{ComputeNodes: []lc.ComputeNode{{Id: "cn2"}}})
+	c.Assert(err, gc.ErrorMatches, "Compute node cn2 has no memory or disk")
+}
+
+// Tests for accounts
+func (s *CloudAPISuite) TestAccounts(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+	_, err := service.AddAccount("")
+	c.Assert(err, gc.ErrorMatches, `Invalid login ""`)
+	_, err = service.AddAccount("_admin")
+	c.Assert(err, gc.ErrorMatches, `Invalid login "_admin"`)
+	bob, err := service.AddAccount("bob")
+	c.Assert(err, gc.IsNil)
+	_, err = service.AddAccount("bob")
+	c.Assert(err, gc.ErrorMatches, "Account bob already exists")
+	c.Assert(service.Accounts(), gc.DeepEquals, []string{"bob", testUserAccount})
+	account, err := service.Account("bob")
+	c.Assert(err, gc.IsNil)
+	c.Assert(account, gc.Equals, bob)
+	_, err = bob.Account("nobody")
+	c.Assert(err, gc.ErrorMatches, "Account nobody not found")
+	c.Assert(bob.AccountID(), gc.Not(gc.Equals), service.AccountID())
+
+	// packages are shared, keys and machines are not
+	pkgs, err := bob.ListPackages(nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(pkgs, gc.HasLen, 4)
+	_, err = bob.CreateKey(testKeyName, testKey)
+	c.Assert(err, gc.IsNil)
+	keys, err := service.ListKeys()
+	c.Assert(err, gc.IsNil)
+	c.Assert(keys, gc.HasLen, 0)
+	m, err := bob.CreateMachine(testMachineName, testPackage, testImage, nil, nil, nil)
+	c.Assert(err, gc.IsNil)
+	_, err = service.GetMachine(m.Id)
+	c.Assert(err, gc.ErrorMatches, "Machine .* not found")
+
+	// checkpoints cover every account
+	id := service.Checkpoint()
+	c.Assert(bob.DeleteKey(testKeyName), gc.IsNil)
+	c.Assert(service.Restore(id), gc.IsNil)
+	_, err = bob.GetKey(testKeyName)
+	c.Assert(err, gc.IsNil)
+	bob.Reset()
+	count, err := bob.CountMachines()
+	c.Assert(err, gc.IsNil)
+	c.Assert(count, gc.Equals, 0)
+	pkgs, err = bob.ListPackages(nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(pkgs, gc.HasLen, 4)
+}
+
+func (s *CloudAPISuite) TestSharedImages(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+	bob, err := service.AddAccount("bob")
+	c.Assert(err, gc.IsNil)
+	alice, err := service.AddAccount("alice")
+	c.Assert(err, gc.IsNil)
+
+	f := &lc.Fixture{Images: []cloudapi.Image{
+		{Id: "public-image", Name: "base", Type: "smartmachine", Public: true},
+		{Id: "private-image", Name: "app", Type: "smartmachine", Owner: service.AccountID(), ACL: []string{bob.AccountID()}},
+		{Id: "alice-image", Name: "tools", Type: "smartmachine", Owner: "alice"},
+	}}
+	c.Assert(service.LoadFixture(f), gc.IsNil)
+
+	imageIDs := func(api *lc.CloudAPI) []string {
+		images, err := api.ListImages(nil)
+		c.Assert(err, gc.IsNil)
+		ids := []string{}
+		for _, image := range images {
+			ids = append(ids, image.Id)
+		}
+		return ids
+	}
+	c.Assert(imageIDs(service), gc.DeepEquals, []string{"public-image", "private-image"})
+	c.Assert(imageIDs(bob), gc.DeepEquals, []string{"public-image", "private-image"})
+	c.Assert(imageIDs(alice), gc.DeepEquals, []string{"public-image", "alice-image"})
+
+	_, err = alice.GetImage("private-image")
+	c.Assert(err, gc.ErrorMatches, "Image private-image not found")
+	_, err = alice.CreateMachine(testMachineName, testPackage, "private-image", nil, nil, nil)
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeInvalidArgument)
+	_, err = bob.CreateMachine(testMachineName, testPackage, "private-image", nil, nil, nil)
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *CloudAPISuite) TestAccountsShareComputeNodes(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+	bob, err := service.AddAccount("bob")
+	c.Assert(err, gc.IsNil)
+	c.Assert(bob.SetComputeNodes([]lc.ComputeNode{{Id: "cn1", Memory: 1024, Disk: 65536}}), gc.IsNil)
+	c.Assert(service.SetLimits(lc.Limits{Machines: 1}), gc.IsNil)
+
+	m, err := service.CreateMachine(testMachineName, testPackage, testImage, nil, nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(m.ComputeNode, gc.Equals, "cn1")
+
+	// limits are the account's own, compute nodes are not
+	full, err := bob.CreateMachine(testMachineName, testPackage, testImage, nil, nil, nil)
+	c.Assert(err, gc.IsNil)
+	assertMachineState(c, bob, full.Id, "failed")
+	c.Assert(lc.ErrorCode(bob.ProvisionError(full.Id)), gc.Equals, lc.CodeInsufficientCapacity)
+}
+
+func (s *CloudAPISuite) TestIPAllocation(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+	vlan, err := service.CreateFabricVLAN(cloudapi.FabricVLAN{Name: "ipam"})
+	c.Assert(err, gc.IsNil)
+	network, err := service.CreateFabricNetwork(vlan.Id, cloudapi.CreateFabricNetworkOpts{
+		Name:             "ipam-net",
+		Subnet:           "10.70.0.0/29",
+		ProvisionStartIp: "10.70.0.1",
+		ProvisionEndIp:   "10.70.0.4",
+		Gateway:          "10.70.0.1",
+	})
+	c.Assert(err, gc.IsNil)
+
+	var machines []*cloudapi.Machine
+	for _, ip := range []string{"10.70.0.2", "10.70.0.3", "10.70.0.4"} {
+		m, err := service.CreateMachine(testMachineName, testPackage, testImage, []string{network.Id, testNetworkID}, nil, nil)
+		c.Assert(err, gc.IsNil)
+		c.Assert(m.IPs, gc.HasLen, 2)
+		c.Assert(m.IPs[0], gc.Equals, ip)
+		c.Assert(m.PrimaryIP, gc.Equals, m.IPs[1])
+		machines = append(machines, m)
+	}
+	nics, err := service.ListNICs(machines[0].Id)
+	c.Assert(err, gc.IsNil)
+	for _, nic := range nics {
+		if nic.Network == network.Id {
+			c.Assert(nic.Netmask, gc.Equals, "255.255.255.248")
+			c.Assert(nic.Gateway, gc.Equals, "10.70.0.1")
+		}
+	}
+
+	// the range is exhausted, on create as on AddNIC
+	_, err = service.CreateMachine(testMachineName, testPackage, testImage, []string{network.Id}, nil, nil)
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeSubnetFull)
+	other, err := service.CreateMachine(testMachineName, testPackage, testImage, []string{testNetworkID}, nil, nil)
+	c.Assert(err, gc.IsNil)
+	_, err = service.AddNIC(other.Id, network.Id)
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeSubnetFull)
+
+	// deleting a machine frees its addresses
+	c.Assert(service.StopMachine(machines[1].Id), gc.IsNil)
+	c.Assert(service.DeleteMachine(machines[1].Id), gc.IsNil)
+	nic, err := service.AddNIC(other.Id, network.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(nic.IP, gc.Equals, "10.70.0.3")
+	m, err := service.GetMachine(other.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(m.IPs, gc.DeepEquals, []string{other.IPs[0], "10.70.0.3"})
+
+	// so does removing a NIC
+	c.Assert(service.RemoveNIC(other.Id, nic.MAC), gc.IsNil)
+	m, err = service.GetMachine(other.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(m.IPs, gc.DeepEquals, other.IPs)
+	m, err = service.CreateMachine(testMachineName, testPackage, testImage, []string{network.Id}, nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(m.IPs, gc.DeepEquals, []string{"10.70.0.3"})
+}
+
+func (s *CloudAPISuite) TestDualStackAllocation(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+	vlan, err := service.CreateFabricVLAN(cloudapi.FabricVLAN{Name: "dual-stack"})
+	c.Assert(err, gc.IsNil)
+	network, err := service.CreateFabricNetwork(vlan.Id, cloudapi.CreateFabricNetworkOpts{
+		Name:              "dual-stack-net",
+		Subnet:            "10.71.0.0/24",
+		Gateway:           "10.71.0.1",
+		Subnet6:           "fd00:71::/64",
+		ProvisionStartIp6: "fd00:71::10",
+		ProvisionEndIp6:   "fd00:71::ff",
+		Gateway6:          "fd00:71::1",
+	})
+	c.Assert(err, gc.IsNil)
+	n, err := service.GetNetwork(network.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(n.Subnet6, gc.Equals, "fd00:71::/64")
+	c.Assert(n.Gateway6, gc.Equals, "fd00:71::1")
+
+	// IPv6 addresses can be reserved like IPv4 ones
+	_, err = service.UpdateNetworkIP(network.Id, "fd00:71::10", true)
+	c.Assert(err, gc.IsNil)
+
+	m, err := service.CreateMachine(testMachineName, testPackage, testImage, []string{network.Id}, nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(m.IPs, gc.DeepEquals, []string{"10.71.0.2", "fd00:71::11"})
+	c.Assert(m.PrimaryIP, gc.Equals, "10.71.0.2")
+	nics, err := service.ListNICs(m.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(nics, gc.HasLen, 1)
+	c.Assert(nics[0].IP, gc.Equals, "10.71.0.2")
+	c.Assert(nics[0].Gateway, gc.Equals, "10.71.0.1")
+	c.Assert(nics[0].IPs, gc.DeepEquals, []string{"10.71.0.2/24", "fd00:71::11/64"})
+	c.Assert(nics[0].Gateways, gc.DeepEquals, []string{"10.71.0.1", "fd00:71::1"})
+
+	ip, err := service.GetNetworkIP(network.Id, "fd00:71::11")
+	c.Assert(err, gc.IsNil)
+	c.Assert(ip.BelongsToUUID, gc.Equals, m.Id)
+	ips, err := service.ListNetworkIPs(network.Id)
+	c.Assert(err, gc.IsNil)
+	var listed []string
+	for _, ip := range ips {
+		listed = append(listed, ip.IP)
+	}
+	c.Assert(listed, gc.DeepEquals, []string{
+		"10.71.0.0", "10.71.0.1", "10.71.0.2", "10.71.0.255",
+		"fd00:71::", "fd00:71::1", "fd00:71::10", "fd00:71::11", "fd00:71::ffff:ffff:ffff:ffff",
+	})
+
+	// the IPv6 gateway can be changed, within the IPv6 subnet only
+	_, err = service.UpdateFabricNetwork(vlan.Id, network.Id, cloudapi.UpdateFabricNetworkOpts{Gateway6: "fd00:72::1"})
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeInvalidArgument)
+	updated, err := service.UpdateFabricNetwork(vlan.Id, network.Id, cloudapi.UpdateFabricNetworkOpts{Gateway6: "fd00:71::fe"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(updated.Gateway6, gc.Equals, "fd00:71::fe")
+}
+
+func (s *CloudAPISuite) TestNetworkIPs(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+	vlan, err := service.CreateFabricVLAN(cloudapi.FabricVLAN{Name: "ips"})
+	c.Assert(err, gc.IsNil)
+	network, err := service.CreateFabricNetwork(vlan.Id, cloudapi.CreateFabricNetworkOpts{
+		Name:    "ips-net",
+		Subnet:  "10.80.0.0/29",
+		Gateway: "10.80.0.1",
+	})
+	c.Assert(err, gc.IsNil)
+	m, err := service.CreateMachine(testMachineName, testPackage, testImage, []string{network.Id}, nil, nil)
+	c.Assert(err, gc.IsNil)
+
+	// a reserved address is not handed out
+	ip, err := service.UpdateNetworkIP(network.Id, "10.80.0.3", true)
+	c.Assert(err, gc.IsNil)
+	c.Assert(*ip, gc.DeepEquals, cloudapi.NetworkIP{IP: "10.80.0.3", Reserved: true, OwnerUUID: service.AccountID()})
+	next, err := service.CreateMachine(testMachineName, testPackage, testImage, []string{network.Id}, nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(next.IPs, gc.DeepEquals, []string{"10.80.0.4"})
+
+	ips, err := service.ListNetworkIPs(network.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(ips, gc.DeepEquals, []cloudapi.NetworkIP{
+		{IP: "10.80.0.0", Reserved: true, Managed: true},
+		{IP: "10.80.0.1", Reserved: true, Managed: true},
+		{IP: "10.80.0.2", OwnerUUID: service.AccountID(), BelongsToUUID: m.Id, BelongsToType: "zone"},
+		{IP: "10.80.0.3", Reserved: true, OwnerUUID: service.AccountID()},
+		{IP: "10.80.0.4", OwnerUUID: service.AccountID(), BelongsToUUID: next.Id, BelongsToType: "zone"},
+		{IP: "10.80.0.7", Reserved: true, Managed: true},
+	})
+
+	ip, err = service.GetNetworkIP(network.Id, "10.80.0.5")
+	c.Assert(err, gc.IsNil)
+	c.Assert(*ip, gc.DeepEquals, cloudapi.NetworkIP{IP: "10.80.0.5"})
+	_, err = service.GetNetworkIP(network.Id, "10.80.1.5")
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeResourceNotFound)
+	_, err = service.UpdateNetworkIP(network.Id, "10.80.0.1", true)
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeInvalidArgument)
+
+	ip, err = service.UpdateNetworkIP(network.Id, "10.80.0.3", false)
+	c.Assert(err, gc.IsNil)
+	c.Assert(*ip, gc.DeepEquals, cloudapi.NetworkIP{IP: "10.80.0.3"})
+}
+
+func (s *CloudAPISuite) TestFabricNetworksAreNetworks(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+	vlan, err := service.CreateFabricVLAN(cloudapi.FabricVLAN{Name: "first-class"})
+	c.Assert(err, gc.IsNil)
+	fabricNetwork, err := service.CreateFabricNetwork(vlan.Id, cloudapi.CreateFabricNetworkOpts{
+		Name:        "first-class-net",
+		Subnet:      "10.90.0.0/24",
+		Gateway:     "10.90.0.1",
+		Resolvers:   []string{"8.8.8.8"},
+		InternetNAT: true,
+	})
+	c.Assert(err, gc.IsNil)
+
+	networks, err := service.ListNetworks()
+	c.Assert(err, gc.IsNil)
+	c.Assert(networks, gc.HasLen, 3)
+	c.Assert(networks[2], gc.DeepEquals, cloudapi.Network{
+		Id:          fabricNetwork.Id,
+		Name:        "first-class-net",
+		Fabric:      true,
+		Subnet:      "10.90.0.0/24",
+		Gateway:     "10.90.0.1",
+		Resolvers:   []string{"8.8.8.8"},
+		InternetNAT: true,
+		VLANId:      vlan.Id,
+	})
+	network, err := service.GetNetwork(fabricNetwork.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(*network, gc.DeepEquals, networks[2])
+
+	// fabric networks are not those of other accounts
+	bob, err := service.AddAccount("bob")
+	c.Assert(err, gc.IsNil)
+	_, err = bob.GetNetwork(fabricNetwork.Id)
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeResourceNotFound)
+
+	m, err := service.CreateMachine(testMachineName, testPackage, testImage, []string{fabricNetwork.Id}, nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(m.Networks, gc.DeepEquals, []string{fabricNetwork.Id})
+	c.Assert(m.IPs, gc.DeepEquals, []string{"10.90.0.2"})
+	_, err = bob.CreateMachine(testMachineName, testPackage, testImage, []string{fabricNetwork.Id}, nil, nil)
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeInvalidArgument)
+
+	// a network in use cannot be deleted
+	err = service.DeleteFabricNetwork(vlan.Id, fabricNetwork.Id)
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeInUseError)
+	c.Assert(service.StopMachine(m.Id), gc.IsNil)
+	c.Assert(service.DeleteMachine(m.Id), gc.IsNil)
+	c.Assert(service.DeleteFabricNetwork(vlan.Id, fabricNetwork.Id), gc.IsNil)
+	_, err = service.GetNetwork(fabricNetwork.Id)
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeResourceNotFound)
+}
+
+func (s *CloudAPISuite) TestFabricVLANIDsAndNames(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+	for _, id := range []int16{-1, 4096} {
+		_, err := service.CreateFabricVLAN(cloudapi.FabricVLAN{Id: id, Name: "out-of-range"})
+		c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeInvalidArgument)
+	}
+	vlan, err := service.CreateFabricVLAN(cloudapi.FabricVLAN{Id: 4095, Name: "last"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(vlan.Id, gc.Equals, int16(4095))
+	_, err = service.CreateFabricVLAN(cloudapi.FabricVLAN{Id: 4095, Name: "again"})
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeInUseError)
+
+	other, err := service.CreateFabricVLAN(cloudapi.FabricVLAN{Name: "other"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(other.Id, gc.Not(gc.Equals), int16(0))
+	_, err = service.CreateFabricVLAN(cloudapi.FabricVLAN{Name: "last"})
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeInUseError)
+	_, err = service.UpdateFabricVLAN(cloudapi.FabricVLAN{Id: other.Id, Name: "last"})
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeInUseError)
+
+	_, err = service.CreateFabricNetwork(vlan.Id, cloudapi.CreateFabricNetworkOpts{Name: "net", Subnet: "10.100.0.0/24"})
+	c.Assert(err, gc.IsNil)
+	_, err = service.CreateFabricNetwork(other.Id, cloudapi.CreateFabricNetworkOpts{Name: "net", Subnet: "10.101.0.0/24"})
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeInUseError)
+}
+
+func (s *CloudAPISuite) TestCreateFabricNetworkValidation(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+	vlan, err := service.CreateFabricVLAN(cloudapi.FabricVLAN{Name: "validated"})
+	c.Assert(err, gc.IsNil)
+	other, err := service.CreateFabricVLAN(cloudapi.FabricVLAN{Name: "validated-too"})
+	c.Assert(err, gc.IsNil)
+	_, err = service.CreateFabricVLAN(cloudapi.FabricVLAN{})
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeInvalidArgument)
+
+	_, err = service.CreateFabricNetwork(vlan.Id, cloudapi.CreateFabricNetworkOpts{
+		Name:             "reversed",
+		Subnet:           "10.140.0.0/24",
+		ProvisionStartIp: "10.140.0.200",
+		ProvisionEndIp:   "10.140.0.100",
+	})
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeInvalidArgument)
+	c.Assert(err, gc.ErrorMatches, "provision range 10.140.0.200-10.140.0.100 is reversed")
+
+	// subnets must not overlap on a VLAN, but may on different ones
+	_, err = service.CreateFabricNetwork(vlan.Id, cloudapi.CreateFabricNetworkOpts{Name: "wide", Subnet: "10.140.0.0/16"})
+	c.Assert(err, gc.IsNil)
+	_, err = service.CreateFabricNetwork(vlan.Id, cloudapi.CreateFabricNetworkOpts{Name: "narrow", Subnet: "10.140.1.0/24"})
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeInvalidArgument)
+	_, err = service.CreateFabricNetwork(other.Id, cloudapi.CreateFabricNetworkOpts{Name: "narrow", Subnet: "10.140.1.0/24"})
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *CloudAPISuite) TestUpdateFabricNetwork(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+	vlan, err := service.CreateFabricVLAN(cloudapi.FabricVLAN{Name: "update"})
+	c.Assert(err, gc.IsNil)
+	network, err := service.CreateFabricNetwork(vlan.Id, cloudapi.CreateFabricNetworkOpts{
+		Name:        "update-net",
+		Description: "before",
+		Subnet:      "10.110.0.0/24",
+		Gateway:     "10.110.0.1",
+	})
+	c.Assert(err, gc.IsNil)
+	_, err = service.CreateFabricNetwork(vlan.Id, cloudapi.CreateFabricNetworkOpts{Name: "taken", Subnet: "10.111.0.0/24"})
+	c.Assert(err, gc.IsNil)
+
+	updated, err := service.UpdateFabricNetwork(vlan.Id, network.Id, cloudapi.UpdateFabricNetworkOpts{
+		Name:      "renamed-net",
+		Gateway:   "10.110.0.254",
+		Resolvers: []string{"10.110.0.53"},
+		Routes:    map[string]string{"10.120.0.0/16": "10.110.0.254"},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(updated.Name, gc.Equals, "renamed-net")
+	c.Assert(updated.Description, gc.Equals, "before")
+	c.Assert(updated.Gateway, gc.Equals, "10.110.0.254")
+	c.Assert(updated.Resolvers, gc.DeepEquals, []string{"10.110.0.53"})
+	c.Assert(updated.Routes, gc.DeepEquals, map[string]string{"10.120.0.0/16": "10.110.0.254"})
+	got, err := service.GetNetwork(network.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(got.Name, gc.Equals, "renamed-net")
+	c.Assert(got.Gateway, gc.Equals, "10.110.0.254")
+
+	// an empty description, resolvers or routes clear them
+	empty := ""
+	updated, err = service.UpdateFabricNetwork(vlan.Id, network.Id, cloudapi.UpdateFabricNetworkOpts{
+		Description: &empty,
+		Resolvers:   []string{},
+		Routes:      map[string]string{},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(updated.Description, gc.Equals, "")
+	c.Assert(updated.Resolvers, gc.HasLen, 0)
+	c.Assert(updated.Routes, gc.HasLen, 0)
+	c.Assert(updated.Name, gc.Equals, "renamed-net")
+
+	_, err = service.UpdateFabricNetwork(vlan.Id, network.Id, cloudapi.UpdateFabricNetworkOpts{Name: "taken"})
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeInUseError)
+	_, err = service.UpdateFabricNetwork(vlan.Id, network.Id, cloudapi.UpdateFabricNetworkOpts{Gateway: "10.99.0.1"})
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeInvalidArgument)
+	_, err = service.UpdateFabricNetwork(vlan.Id, "no-such-network", cloudapi.UpdateFabricNetworkOpts{Name: "x"})
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeResourceNotFound)
+}
+
+func (s *CloudAPISuite) TestNetworkIPsOfOtherAccounts(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+	bob, err := service.AddAccount("bob")
+	c.Assert(err, gc.IsNil)
+	_, err = bob.UpdateNetworkIP(testNetworkID, "32.151.0.10", true)
+	c.Assert(err, gc.IsNil)
+	m, err := bob.CreateMachine(testMachineName, testPackage, testImage, []string{testNetworkID}, nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(m.IPs, gc.DeepEquals, []string{"32.151.0.11"})
+
+	// addresses of other accounts on a shared network are taken, but whose
+	// they are is not shown
+	ip, err := service.GetNetworkIP(testNetworkID, "32.151.0.11")
+	c.Assert(err, gc.IsNil)
+	c.Assert(*ip, gc.DeepEquals, cloudapi.NetworkIP{IP: "32.151.0.11"})
+	_, err = service.UpdateNetworkIP(testNetworkID, "32.151.0.10", false)
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeInUseError)
+	ips, err := service.ListNetworkIPs(testNetworkID)
+	c.Assert(err, gc.IsNil)
+	for _, ip := range ips {
+		c.Assert(ip.Managed, gc.Equals, true)
+	}
+	m, err = service.CreateMachine(testMachineName, testPackage, testImage, []string{testNetworkID}, nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(m.IPs, gc.DeepEquals, []string{"32.151.0.12"})
+}
+
 // Tests for FirewallRules API
 func (s *CloudAPISuite) TestCreateFirewallRule(c *gc.C) {
 	testFwRule := s.createFirewallRule(c)
@@ -410,9 +1189,788 @@ func (s *CloudAPISuite) TestGetNetwork(c *gc.C) {
 	c.Assert(err, gc.IsNil)
 	c.Assert(net, gc.NotNil)
 	c.Assert(net, gc.DeepEquals, &cloudapi.Network{
-		Id:          testNetworkID,
-		Name:        "Test-Joyent-Public",
-		Public:      true,
-		Description: "",
+		Id:               testNetworkID,
+		Name:             "Test-Joyent-Public",
+		Public:           true,
+		Description:      "",
+		Subnet:           "32.151.0.0/16",
+		ProvisionStartIp: "32.151.0.10",
+		ProvisionEndIp:   "32.151.255.250",
+		Gateway:          "32.151.0.1",
+	})
+}
+
+// Tests for Analytics API
+func (s *CloudAPISuite) createInstrumentation(c *gc.C, opts cloudapi.CreateInstrumentationOpts) *cloudapi.Instrumentation {
+	inst, err := s.service.CreateInstrumentation(opts)
+	c.Assert(err, gc.IsNil)
+
+	return inst
+}
+
+func (s *CloudAPISuite) deleteInstrumentation(c *gc.C, instrumentationID string) {
+	err := s.service.DeleteInstrumentation(instrumentationID)
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *CloudAPISuite) TestDescribeAnalytics(c *gc.C) {
+	analytics, err := s.service.DescribeAnalytics()
+	c.Assert(err, gc.IsNil)
+	c.Assert(analytics.Modules["syscall"], gc.NotNil)
+	c.Assert(analytics.Fields["latency"], gc.DeepEquals, map[string]interface{}{"label": "latency", "type": "time"})
+	c.Assert(analytics.Metrics["syscall"].(map[string]interface{})["syscalls"], gc.NotNil)
+	c.Assert(analytics.Transformations["geolocate"], gc.NotNil)
+}
+
+func (s *CloudAPISuite) TestCreateInstrumentation(c *gc.C) {
+	inst := s.createInstrumentation(c, cloudapi.CreateInstrumentationOpts{
+		Module:        "syscall",
+		Stat:          "syscalls",
+		Decomposition: "execname,latency",
 	})
+	defer s.deleteInstrumentation(c, inst.Id)
+
+	c.Assert(inst.Decomposition, gc.DeepEquals, []string{"execname", "latency"})
+	c.Assert(inst.ValueArity, gc.Equals, "numeric-decomposition")
+	c.Assert(inst.ValueDimension, gc.Equals, 3)
+	c.Assert(inst.Granularity, gc.Equals, 1)
+	c.Assert(inst.RetentionTime, gc.Equals, 600)
+	c.Assert(inst.Uris, gc.HasLen, 3)
+
+	clone := s.createInstrumentation(c, cloudapi.CreateInstrumentationOpts{Clone: mustAtoi(c, inst.Id)})
+	defer s.deleteInstrumentation(c, clone.Id)
+	c.Assert(clone.Id, gc.Not(gc.Equals), inst.Id)
+	c.Assert(clone.Decomposition, gc.DeepEquals, inst.Decomposition)
+}
+
+func (s *CloudAPISuite) TestCreateInstrumentationInvalid(c *gc.C) {
+	_, err := s.service.CreateInstrumentation(cloudapi.CreateInstrumentationOpts{Module: "cpu", Stat: "nope"})
+	c.Assert(err, gc.ErrorMatches, "Unknown metric cpu.nope")
+
+	_, err = s.service.CreateInstrumentation(cloudapi.CreateInstrumentationOpts{Module: "cpu", Stat: "usage", Decomposition: "latency"})
+	c.Assert(err, gc.ErrorMatches, "Metric cpu.usage cannot be decomposed by latency")
+
+	_, err = s.service.CreateInstrumentation(cloudapi.CreateInstrumentationOpts{Module: "syscall", Stat: "syscalls", Decomposition: "execname,syscall"})
+	c.Assert(err, gc.ErrorMatches, "Cannot decompose by both execname and syscall")
+}
+
+func (s *CloudAPISuite) TestListInstrumentations(c *gc.C) {
+	inst := s.createInstrumentation(c, cloudapi.CreateInstrumentationOpts{Module: "cpu", Stat: "usage"})
+	defer s.deleteInstrumentation(c, inst.Id)
+
+	insts, err := s.service.ListInstrumentations()
+	c.Assert(err, gc.IsNil)
+	c.Assert(insts, gc.DeepEquals, []cloudapi.Instrumentation{*inst})
+
+	got, err := s.service.GetInstrumentation(inst.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(got, gc.DeepEquals, inst)
+}
+
+func (s *CloudAPISuite) TestGetInstrumentationValue(c *gc.C) {
+	scalar := s.createInstrumentation(c, cloudapi.CreateInstrumentationOpts{Module: "cpu", Stat: "usage", Granularity: 10, RetentionTime: 60})
+	defer s.deleteInstrumentation(c, scalar.Id)
+	discrete := s.createInstrumentation(c, cloudapi.CreateInstrumentationOpts{Module: "nic", Stat: "bytes", Decomposition: "direction"})
+	defer s.deleteInstrumentation(c, discrete.Id)
+	numeric := s.createInstrumentation(c, cloudapi.CreateInstrumentationOpts{Module: "syscall", Stat: "syscalls", Decomposition: "latency"})
+	defer s.deleteInstrumentation(c, numeric.Id)
+
+	value, err := s.service.GetInstrumentationValue(scalar.Id, 0)
+	c.Assert(err, gc.IsNil)
+	c.Assert(value.Duration, gc.Equals, 10)
+	c.Assert(value.StartTime%10, gc.Equals, 0)
+	c.Assert(value.Value.(int) < 100, gc.Equals, true)
+
+	again, err := s.service.GetInstrumentationValue(scalar.Id, value.StartTime+5)
+	c.Assert(err, gc.IsNil)
+	c.Assert(again, gc.DeepEquals, value)
+
+	_, err = s.service.GetInstrumentationValue(scalar.Id, value.StartTime-60)
+	c.Assert(err, gc.ErrorMatches, "No data for instrumentation .*")
+
+	value, err = s.service.GetInstrumentationValue(discrete.Id, 0)
+	c.Assert(err, gc.IsNil)
+	c.Assert(value.Value, gc.HasLen, 3)
+	c.Assert(value.Value.(map[string]interface{})["direction-0"], gc.NotNil)
+
+	value, err = s.service.GetInstrumentationValue(numeric.Id, 0)
+	c.Assert(err, gc.IsNil)
+	for _, bucket := range value.Value.([]interface{}) {
+		bounds := bucket.([]interface{})[0].([]int)
+		c.Assert(bounds[1]-bounds[0], gc.Equals, 99999)
+	}
+}
+
+func (s *CloudAPISuite) TestAnalyticsSeed(c *gc.C) {
+	opts := cloudapi.CreateInstrumentationOpts{Module: "fs", Stat: "logical_ops", Decomposition: "optype,latency"}
+	values := make([]*cloudapi.InstrumentationValue, 3)
+	startTime := 0
+	for i, seed := range []int64{42, 42, 7} {
+		service := lc.New(testServiceURL, testUserAccount)
+		service.SetAnalyticsSeed(seed)
+		inst, err := service.CreateInstrumentation(opts)
+		c.Assert(err, gc.IsNil)
+
+		values[i], err = service.GetInstrumentationValue(inst.Id, startTime)
+		c.Assert(err, gc.IsNil)
+		startTime = values[i].StartTime
+	}
+
+	c.Assert(values[1], gc.DeepEquals, values[0])
+	c.Assert(values[2], gc.Not(gc.DeepEquals), values[0])
+}
+
+func (s *CloudAPISuite) TestGetInstrumentationHeatmap(c *gc.C) {
+	inst := s.createInstrumentation(c, cloudapi.CreateInstrumentationOpts{
+		Module:        "syscall",
+		Stat:          "syscalls",
+		Decomposition: "syscall,latency",
+		Granularity:   5,
+		RetentionTime: 300,
+	})
+	defer s.deleteInstrumentation(c, inst.Id)
+
+	heatmap, err := s.service.GetInstrumentationHeatmap(inst.Id, cloudapi.HeatmapOpts{})
+	c.Assert(err, gc.IsNil)
+	c.Assert(heatmap.BucketTime%5, gc.Equals, 0)
+	c.Assert(heatmap.BucketYmin, gc.Equals, 0)
+	c.Assert(heatmap.BucketYmax, gc.Equals, 1000000)
+
+	present := 0
+	for _, count := range heatmap.Present {
+		present += count.(int)
+	}
+	c.Assert(present, gc.Equals, heatmap.Total)
+
+	// The top left pixel is the highest bucket of the oldest interval.
+	details, err := s.service.GetInstrumentationHeatmapDetails(inst.Id, cloudapi.HeatmapOpts{Width: 60, Height: 10, Nbuckets: 10})
+	c.Assert(err, gc.IsNil)
+	c.Assert(details.BucketTime, gc.Equals, heatmap.BucketTime)
+	c.Assert(details.BucketYmin, gc.Equals, 900000)
+	c.Assert(details.BucketYmax, gc.Equals, 1000000)
+
+	_, err = s.service.GetInstrumentationHeatmapDetails(inst.Id, cloudapi.HeatmapOpts{X: 600})
+	c.Assert(err, gc.ErrorMatches, "Point \\(600, 0\\) is outside of the 600x300 heatmap")
+
+	scalar := s.createInstrumentation(c, cloudapi.CreateInstrumentationOpts{Module: "cpu", Stat: "usage"})
+	defer s.deleteInstrumentation(c, scalar.Id)
+	_, err = s.service.GetInstrumentationHeatmap(scalar.Id, cloudapi.HeatmapOpts{})
+	c.Assert(err, gc.ErrorMatches, "Instrumentation .* has no numeric decomposition")
+}
+
+// Tests for Datacenters API
+func (s *CloudAPISuite) TestDatacenters(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+
+	dcs, err := service.ListDatacenters()
+	c.Assert(err, gc.IsNil)
+	c.Assert(dcs, gc.DeepEquals, map[string]string{lc.DefaultDatacenter: testServiceURL})
+
+	service.SetDatacenters(map[string]string{"us-east-1": "https://us-east-1.api.example.com"})
+	url, err := service.GetDatacenter("us-east-1")
+	c.Assert(err, gc.IsNil)
+	c.Assert(url, gc.Equals, "https://us-east-1.api.example.com")
+
+	_, err = service.GetDatacenter(lc.DefaultDatacenter)
+	c.Assert(err, gc.ErrorMatches, "Datacenter us-west-1 not found")
+}
+
+func (s *CloudAPISuite) TestServices(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+
+	services, err := service.ListServices()
+	c.Assert(err, gc.IsNil)
+	c.Assert(services, gc.DeepEquals, map[string]string{"cloudapi": testServiceURL})
+
+	service.SetServices(map[string]string{"manta": "https://manta.example.com"})
+	services, err = service.ListServices()
+	c.Assert(err, gc.IsNil)
+	c.Assert(services, gc.DeepEquals, map[string]string{"manta": "https://manta.example.com"})
+}
+
+func (s *CloudAPISuite) TestJoinRegion(c *gc.C) {
+	east := lc.New("http://localhost:3001", testUserAccount)
+	west := lc.New("http://localhost:3002/", testUserAccount)
+	lc.JoinRegion(map[string]*lc.CloudAPI{"us-east-1": east, "us-west-1": west})
+
+	region := map[string]string{
+		"us-east-1": "http://localhost:3001",
+		"us-west-1": "http://localhost:3002",
+	}
+	for _, dc := range []*lc.CloudAPI{east, west} {
+		dcs, err := dc.ListDatacenters()
+		c.Assert(err, gc.IsNil)
+		c.Assert(dcs, gc.DeepEquals, region)
+	}
+
+	url, err := east.GetDatacenter("us-west-1")
+	c.Assert(err, gc.IsNil)
+	c.Assert(url, gc.Equals, "http://localhost:3002")
+}
+
+// Tests for concurrent use of the double
+func (s *CloudAPISuite) TestConcurrentMachines(c *gc.C) {
+	const workers = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- s.exerciseMachine(fmt.Sprintf("%s-%d", testMachineName, i))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		c.Check(err, gc.IsNil)
+	}
+	count, err := s.service.CountMachines()
+	c.Assert(err, gc.IsNil)
+	c.Assert(count, gc.Equals, 0)
+}
+
+// exerciseMachine runs a machine through its lifecycle, touching every kind of
+// state the double keeps for it.
+func (s *CloudAPISuite) exerciseMachine(name string) error {
+	m, err := s.service.CreateMachine(name, testPackage, testImage, []string{testNetworkID}, nil, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := s.service.AddMachineTags(m.Id, map[string]string{"worker": name}); err != nil {
+		return err
+	}
+	if _, err := s.service.UpdateMachineMetadata(m.Id, map[string]string{"worker": name}); err != nil {
+		return err
+	}
+	if _, err := s.service.ListMachines(map[string]string{"tags.worker": name}); err != nil {
+		return err
+	}
+	rule, err := s.service.CreateFirewallRule(fmt.Sprintf("FROM any TO vm %s ALLOW tcp PORT 22", m.Id), true)
+	if err != nil {
+		return err
+	}
+	if _, err := s.service.ListMachineFirewallRules(m.Id); err != nil {
+		return err
+	}
+	if err := s.service.DeleteFirewallRule(rule.Id); err != nil {
+		return err
+	}
+	if err := s.service.StopMachine(m.Id); err != nil {
+		return err
+	}
+	return s.service.DeleteMachine(m.Id)
+}
+
+func mustAtoi(c *gc.C, s string) int {
+	i, err := strconv.Atoi(s)
+	c.Assert(err, gc.IsNil)
+	return i
+}
+
+// Tests for fixtures
+const testFixture = `
+packages:
+  - name: Tiny
+    memory: 256
+    disk: 4096
+    id: 00000000-0000-0000-0000-000000000001
+    default: true
+images:
+  - id: 00000000-0000-0000-0000-00000000000a
+    name: base64
+    os: smartos
+    type: smartmachine
+    public: true
+    state: active
+fabric_vlans:
+  - vlan_id: 2
+    name: backend
+    networks:
+      - id: 00000000-0000-0000-0000-0000000000f1
+        name: backend-net
+        subnet: 10.50.0.0/24
+keys:
+  - name: deploy
+    key: ssh-rsa AAAA deploy@localhost
+machines:
+  - id: 00000000-0000-0000-0000-0000000000b1
+    name: web
+    state: stopped
+    package: Tiny
+    image: 00000000-0000-0000-0000-00000000000a
+    networks: [00000000-0000-0000-0000-0000000000f1]
+    tags:
+      role: web
+    metadata:
+      owner: ops
+    nics:
+      - mac: "90:b8:d0:00:00:01"
+        ip: 10.50.0.10
+        primary: true
+        network: 00000000-0000-0000-0000-0000000000f1
+firewall_rules:
+  - id: 00000000-0000-0000-0000-0000000000c1
+    rule: FROM any TO tag role ALLOW tcp PORT 80
+    enabled: true
+`
+
+func (s *CloudAPISuite) TestLoadFixture(c *gc.C) {
+	f, err := lc.ParseFixture([]byte(testFixture))
+	c.Assert(err, gc.IsNil)
+	service := lc.New(testServiceURL, testUserAccount)
+	c.Assert(service.LoadFixture(f), gc.IsNil)
+
+	pkgs, err := service.ListPackages(nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(pkgs, gc.HasLen, 1)
+	c.Assert(pkgs[0].Name, gc.Equals, "Tiny")
+
+	// networks are left out of the fixture and keep their defaults, listed
+	// along with the fabric network of the fixture
+	networks, err := service.ListNetworks()
+	c.Assert(err, gc.IsNil)
+	c.Assert(networks, gc.HasLen, 3)
+	c.Assert(networks[2].Fabric, gc.Equals, true)
+	c.Assert(networks[2].VLANId, gc.Equals, int16(2))
+
+	fabricNetworks, err := service.ListFabricNetworks(2)
+	c.Assert(err, gc.IsNil)
+	c.Assert(fabricNetworks, gc.HasLen, 1)
+	c.Assert(fabricNetworks[0].Fabric, gc.Equals, true)
+	c.Assert(fabricNetworks[0].VLANId, gc.Equals, int16(2))
+
+	key, err := service.GetKey("deploy")
+	c.Assert(err, gc.IsNil)
+	c.Assert(key.Key, gc.Equals, "ssh-rsa AAAA deploy@localhost")
+
+	m, err := service.GetMachine("00000000-0000-0000-0000-0000000000b1")
+	c.Assert(err, gc.IsNil)
+	c.Assert(m.State, gc.Equals, "stopped")
+	c.Assert(m.Metadata, gc.DeepEquals, map[string]string{"owner": "ops"})
+	tag, err := service.GetMachineTag(m.Id, "role")
+	c.Assert(err, gc.IsNil)
+	c.Assert(tag, gc.Equals, "web")
+
+	nics, err := service.ListNICs(m.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(nics, gc.HasLen, 1)
+	c.Assert(nics[0].IP, gc.Equals, "10.50.0.10")
+	c.Assert(nics[0].State, gc.Equals, cloudapi.NICStateRunning)
+
+	rule, err := service.GetFirewallRule("00000000-0000-0000-0000-0000000000c1")
+	c.Assert(err, gc.IsNil)
+	c.Assert(rule.Enabled, gc.Equals, true)
+
+	c.Assert(service.StartMachine(m.Id), gc.IsNil)
+}
+
+func (s *CloudAPISuite) TestDumpFixture(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+	_, err := service.CreateKey(testKeyName, testKey)
+	c.Assert(err, gc.IsNil)
+	vlan, err := service.CreateFabricVLAN(cloudapi.FabricVLAN{Name: "dump"})
+	c.Assert(err, gc.IsNil)
+	_, err = service.CreateFabricNetwork(vlan.Id, cloudapi.CreateFabricNetworkOpts{Name: "dump-net", Subnet: "10.60.0.0/24"})
+	c.Assert(err, gc.IsNil)
+	_, err = service.CreateMachine(testMachineName, testPackage, testImage, []string{testNetworkID}, map[string]string{"a": "b"}, map[string]string{"c": "d"})
+	c.Assert(err, gc.IsNil)
+	_, err = service.CreateFirewallRule(testFwRule, true)
+	c.Assert(err, gc.IsNil)
+
+	dumped := service.DumpFixture()
+	c.Assert(dumped.Machines, gc.HasLen, 1)
+	c.Assert(dumped.Machines[0].NICs, gc.HasLen, 1)
+	c.Assert(dumped.Packages, gc.DeepEquals, lc.DefaultFixture().Packages)
+
+	for _, encode := range []func() ([]byte, error){dumped.JSON, dumped.YAML} {
+		data, err := encode()
+		c.Assert(err, gc.IsNil)
+		f, err := lc.ParseFixture(data)
+		c.Assert(err, gc.IsNil)
+
+		restored := lc.New(testServiceURL, testUserAccount)
+		c.Assert(restored.LoadFixture(f), gc.IsNil)
+		c.Assert(restored.DumpFixture(), gc.DeepEquals, dumped)
+	}
+}
+
+func (s *CloudAPISuite) TestParseFixtureError(c *gc.C) {
+	_, err := lc.ParseFixture([]byte(`{"packages": {}}`))
+	c.Assert(err, gc.NotNil)
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeInvalidContent)
+}
+
+func (s *CloudAPISuite) TestLoadFixtureIsAtomic(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+	_, err := service.CreateKey(testKeyName, testKey)
+	c.Assert(err, gc.IsNil)
+	m, err := service.CreateMachine(testMachineName, testPackage, testImage, []string{testNetworkID}, nil, nil)
+	c.Assert(err, gc.IsNil)
+	before := service.DumpFixture()
+
+	f, err := lc.ParseFixture([]byte(`
+packages:
+  - name: Tiny
+    memory: 256
+keys: []
+machines:
+  - id: 00000000-0000-0000-0000-0000000000b1
+    networks: [` + testNetworkID + `]
+    nics:
+      - mac: 90:b8:d0:00:00:01
+        ip: 192.168.0.1
+        network: ` + testNetworkID + `
+`))
+	c.Assert(err, gc.IsNil)
+	err = service.LoadFixture(f)
+	c.Assert(err, gc.ErrorMatches, "NIC 90:b8:d0:00:00:01 of machine .* has address 192.168.0.1 outside network .*")
+	c.Assert(service.DumpFixture(), gc.DeepEquals, before)
+
+	f.Machines[0].NICs = append(f.Machines[0].NICs, f.Machines[0].NICs[0])
+	f.Machines[0].NICs[0].IP, f.Machines[0].NICs[1].IP = "32.151.0.20", "32.151.0.20"
+	f.Machines[0].NICs[1].MAC = "90:b8:d0:00:00:02"
+	c.Assert(service.LoadFixture(f), gc.ErrorMatches, "NIC 90:b8:d0:00:00:0. of machine .* has address 32.151.0.20, which machine .* has too")
+	c.Assert(service.DumpFixture(), gc.DeepEquals, before)
+
+	_, err = service.GetMachine(m.Id)
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *CloudAPISuite) TestDumpFixtureCompletesActions(c *gc.C) {
+	service, clock := s.newTimedService(c)
+	deleted, err := service.CreateMachine("deleted", testPackage, testImage, nil, nil, nil)
+	c.Assert(err, gc.IsNil)
+	clock.Advance(10 * time.Second)
+	c.Assert(service.StopMachine(deleted.Id), gc.IsNil)
+	clock.Advance(10 * time.Second)
+	c.Assert(service.DeleteMachine(deleted.Id), gc.IsNil)
+	m, err := service.CreateMachine(testMachineName, testPackage, testImage, nil, nil, nil)
+	c.Assert(err, gc.IsNil)
+
+	// The machines are dumped as they will be, and left as they are
+	dumped := service.DumpFixture()
+	c.Assert(dumped.Machines, gc.HasLen, 1)
+	c.Assert(dumped.Machines[0].Id, gc.Equals, m.Id)
+	c.Assert(dumped.Machines[0].State, gc.Equals, "running")
+	assertMachineState(c, service, m.Id, "provisioning")
+
+	restored := lc.New(testServiceURL, testUserAccount)
+	c.Assert(restored.LoadFixture(dumped), gc.IsNil)
+	assertMachineState(c, restored, m.Id, "running")
+}
+
+func (s *CloudAPISuite) TestLoadFixtureKeepsNICNetworks(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+	m, err := service.CreateMachine(testMachineName, testPackage, testImage, []string{testNetworkID}, nil, nil)
+	c.Assert(err, gc.IsNil)
+	before := service.DumpFixture()
+
+	f := &lc.Fixture{Networks: []cloudapi.Network{}}
+	err = service.LoadFixture(f)
+	c.Assert(err, gc.ErrorMatches, "NIC .* of machine "+m.Id+" is on network "+testNetworkID+", which is not in the fixture")
+	c.Assert(service.DumpFixture(), gc.DeepEquals, before)
+
+	f.Machines = []lc.FixtureMachine{}
+	c.Assert(service.LoadFixture(f), gc.IsNil)
+	machines, err := service.ListMachines(nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(machines, gc.HasLen, 0)
+}
+
+func (s *CloudAPISuite) TestLoadFixturePlacesMachines(c *gc.C) {
+	f, err := lc.ParseFixture([]byte(`
+compute_nodes:
+  - id: cn1
+    memory: 1024
+    disk: 102400
+  - id: cn2
+    memory: 1024
+    disk: 102400
+machines:
+  - id: 00000000-0000-0000-0000-0000000000b1
+    memory: 1024
+  - id: 00000000-0000-0000-0000-0000000000b2
+    memory: 512
+  - id: 00000000-0000-0000-0000-0000000000b3
+    memory: 512
+    compute_node: cn1
+`))
+	c.Assert(err, gc.IsNil)
+	service := lc.New(testServiceURL, testUserAccount)
+	c.Assert(service.LoadFixture(f), gc.IsNil)
+
+	// machines given a compute node take their room on it first
+	for id, node := range map[string]string{"b1": "cn2", "b2": "cn1", "b3": "cn1"} {
+		m, err := service.GetMachine("00000000-0000-0000-0000-0000000000" + id)
+		c.Assert(err, gc.IsNil)
+		c.Assert(m.ComputeNode, gc.Equals, node)
+	}
+
+	f.Machines[2].ComputeNode = "cn3"
+	c.Assert(service.LoadFixture(f), gc.ErrorMatches, "Machine .* is on compute node cn3, which is not in the fixture")
+	f.Machines[2].ComputeNode = ""
+	f.Machines[2].Memory = 1024
+	c.Assert(service.LoadFixture(f), gc.ErrorMatches, "There isn't enough capacity in this datacenter")
+}
+
+// Tests for checkpoints
+func (s *CloudAPISuite) TestCheckpointRestore(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+	_, err := service.CreateKey(testKeyName, testKey)
+	c.Assert(err, gc.IsNil)
+	m, err := service.CreateMachine(testMachineName, testPackage, testImage, []string{testNetworkID}, nil, map[string]string{"role": "web"})
+	c.Assert(err, gc.IsNil)
+	cp := service.Checkpoint()
+
+	c.Assert(service.DeleteKey(testKeyName), gc.IsNil)
+	_, err = service.AddMachineTags(m.Id, map[string]string{"role": "db"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(service.StopMachine(m.Id), gc.IsNil)
+	_, err = service.CreateFirewallRule(testFwRule, true)
+	c.Assert(err, gc.IsNil)
+
+	for i := 0; i < 2; i++ {
+		c.Assert(service.Restore(cp), gc.IsNil)
+
+		_, err = service.GetKey(testKeyName)
+		c.Assert(err, gc.IsNil)
+		restored, err := service.GetMachine(m.Id)
+		c.Assert(err, gc.IsNil)
+		c.Assert(restored.State, gc.Equals, "running")
+		c.Assert(restored.Tags, gc.DeepEquals, map[string]string{"role": "web"})
+		rules, err := service.ListFirewallRules()
+		c.Assert(err, gc.IsNil)
+		c.Assert(rules, gc.HasLen, 0)
+
+		// changes after a restore do not leak into the checkpoint
+		_, err = service.AddMachineTags(m.Id, map[string]string{"role": "cache"})
+		c.Assert(err, gc.IsNil)
+	}
+
+	err = service.Restore("unknown")
+	c.Assert(err, gc.ErrorMatches, "Checkpoint unknown not found")
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeResourceNotFound)
+}
+
+func (s *CloudAPISuite) TestCheckpointRestoreNetworks(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+	networks := []cloudapi.Network{{Id: testNetworkID, Name: "public", Resolvers: []string{"8.8.8.8"}}}
+	c.Assert(service.LoadFixture(&lc.Fixture{Networks: networks}), gc.IsNil)
+	networks[0].Resolvers[0] = "changed"
+	vlan, err := service.CreateFabricVLAN(cloudapi.FabricVLAN{Name: "checkpoint"})
+	c.Assert(err, gc.IsNil)
+	fabric, err := service.CreateFabricNetwork(vlan.Id, cloudapi.CreateFabricNetworkOpts{
+		Name:      "checkpoint-net",
+		Subnet:    "10.70.0.0/24",
+		Resolvers: []string{"10.70.0.2"},
+		Routes:    map[string]string{"10.80.0.0/16": "10.70.0.1"},
+	})
+	c.Assert(err, gc.IsNil)
+	cp := service.Checkpoint()
+
+	_, err = service.UpdateFabricNetwork(vlan.Id, fabric.Id, cloudapi.UpdateFabricNetworkOpts{
+		Resolvers: []string{},
+		Routes:    map[string]string{},
+	})
+	c.Assert(err, gc.IsNil)
+	c.Assert(service.Restore(cp), gc.IsNil)
+
+	restored, err := service.GetFabricNetwork(vlan.Id, fabric.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(restored.Resolvers, gc.DeepEquals, []string{"10.70.0.2"})
+	c.Assert(restored.Routes, gc.DeepEquals, map[string]string{"10.80.0.0/16": "10.70.0.1"})
+	public, err := service.GetNetwork(testNetworkID)
+	c.Assert(err, gc.IsNil)
+	c.Assert(public.Resolvers, gc.DeepEquals, []string{"8.8.8.8"})
+}
+
+func (s *CloudAPISuite) TestReset(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+	_, err := service.CreateKey(testKeyName, testKey)
+	c.Assert(err, gc.IsNil)
+	_, err = service.CreateMachine(testMachineName, testPackage, testImage, []string{testNetworkID}, nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(service.LoadFixture(&lc.Fixture{Packages: []cloudapi.Package{{Name: "Tiny"}}}), gc.IsNil)
+	cp := service.Checkpoint()
+
+	service.Reset()
+	c.Assert(service.DumpFixture(), gc.DeepEquals, lc.DefaultFixture())
+	c.Assert(service.Restore(cp), gc.IsNil)
+	keys, err := service.ListKeys()
+	c.Assert(err, gc.IsNil)
+	c.Assert(keys, gc.HasLen, 1)
+
+	service.SetBaseline()
+	baseline := service.DumpFixture()
+	c.Assert(service.DeleteKey(testKeyName), gc.IsNil)
+	service.Reset()
+	c.Assert(service.DumpFixture(), gc.DeepEquals, baseline)
+}
+
+// Tests for faults
+func (s *CloudAPISuite) TestAddFault(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+
+	_, err := service.AddFault(lc.Fault{Operation: "CreateMachine"})
+	c.Assert(err, gc.ErrorMatches, "Fault has no effect")
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeInvalidArgument)
+	_, err = service.AddFault(lc.Fault{Route: "[", Drop: true})
+	c.Assert(err, gc.ErrorMatches, `Invalid fault route "\["`)
+	_, err = service.AddFault(lc.Fault{Drop: true, Probability: 2})
+	c.Assert(err, gc.ErrorMatches, "Fault probability must be between 0 and 1")
+
+	first, err := service.AddFault(lc.Fault{Operation: "CreateMachine", Code: lc.CodeRequestThrottled})
+	c.Assert(err, gc.IsNil)
+	second, err := service.AddFault(lc.Fault{Method: "GET", Latency: time.Second})
+	c.Assert(err, gc.IsNil)
+	c.Assert(service.Faults(), gc.DeepEquals, []lc.Fault{*first, *second})
+
+	c.Assert(service.RemoveFault(first.Id), gc.IsNil)
+	c.Assert(service.Faults(), gc.DeepEquals, []lc.Fault{*second})
+	err = service.RemoveFault(first.Id)
+	c.Assert(lc.ErrorCode(err), gc.Equals, lc.CodeResourceNotFound)
+
+	// faults are configuration, kept by Reset
+	service.Reset()
+	c.Assert(service.Faults(), gc.HasLen, 1)
+	service.ClearFaults()
+	c.Assert(service.Faults(), gc.HasLen, 0)
+}
+
+func (s *CloudAPISuite) TestFixtureFaults(c *gc.C) {
+	f, err := lc.ParseFixture([]byte(`
+faults:
+  - operation: CreateMachine
+    code: ServiceUnavailable
+    probability: 0.25
+  - route: /gouser/machines/*
+    latency: 1.5s
+`))
+	c.Assert(err, gc.IsNil)
+	c.Assert(f.Faults, gc.DeepEquals, []lc.Fault{
+		{Operation: "CreateMachine", Code: lc.CodeServiceUnavailable, Probability: 0.25},
+		{Route: "/gouser/machines/*", Latency: 1500 * time.Millisecond},
+	})
+
+	service := lc.New(testServiceURL, testUserAccount)
+	c.Assert(service.LoadFixture(f), gc.IsNil)
+	faults := service.Faults()
+	c.Assert(faults, gc.HasLen, 2)
+	c.Assert(faults[1].Latency, gc.Equals, 1500*time.Millisecond)
+
+	_, err = lc.ParseFixture([]byte(`{"faults": [{"drop": true, "latency": "soon"}]}`))
+	c.Assert(err, gc.ErrorMatches, `.*Invalid fault latency "soon"`)
+	err = service.LoadFixture(&lc.Fixture{Faults: []lc.Fault{{Operation: "GetMachine"}}})
+	c.Assert(err, gc.ErrorMatches, "Fault has no effect")
+}
+
+// Tests for call recording
+func (s *CloudAPISuite) TestExpectations(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+	create := service.ExpectCalled("CreateMachine").With(hook.Any, testPackage, testImage).Times(2)
+	service.ExpectCalled("StopMachine").After(create)
+	service.ExpectNotCalled("DeleteMachine")
+
+	for _, name := range []string{"first", "second"} {
+		_, err := service.CreateMachine(name, testPackage, testImage, []string{testNetworkID}, nil, nil)
+		c.Assert(err, gc.IsNil)
+	}
+	machines := service.CallsTo("CreateMachine")
+	c.Assert(machines, gc.HasLen, 2)
+	c.Assert(machines[1].Args[0], gc.Equals, "second")
+	c.Assert(service.Verify(), gc.ErrorMatches, "unmet expectations:\nexpected at least 1 calls to StopMachine, got 0")
+
+	list, err := service.ListMachines(nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(service.StopMachine(list[0].Id), gc.IsNil)
+	c.Assert(service.Verify(), gc.IsNil)
+}
+
+// Tests for stacked hooks
+func (s *CloudAPISuite) TestAfterHooks(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+	var created *cloudapi.Machine
+	service.AddAfterHook("CreateMachine", func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		created = result.(*cloudapi.Machine)
+		return nil
+	})
+	service.AddAfterHook("CreateMachine", func(sc hook.ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fmt.Errorf("lost the response to %s", args[0])
+	}, hook.Once())
+
+	// the machine is created although the call fails
+	_, err := service.CreateMachine(testMachineName, testPackage, testImage, []string{testNetworkID}, nil, nil)
+	c.Assert(err, gc.ErrorMatches, "lost the response to "+testMachineName)
+	c.Assert(created, gc.NotNil)
+	m, err := service.GetMachine(created.Id)
+	c.Assert(err, gc.IsNil)
+	c.Assert(m.Name, gc.Equals, testMachineName)
+
+	// both helpers fail the call without replacing each other
+	service.AddBeforeHook("StopMachine", func(hook.ServiceControl, ...interface{}) error {
+		return fmt.Errorf("first helper")
+	}, hook.Once())
+	service.AddBeforeHook("StopMachine", func(hook.ServiceControl, ...interface{}) error {
+		return fmt.Errorf("second helper")
+	}, hook.Once())
+	c.Assert(service.StopMachine(m.Id), gc.ErrorMatches, "first helper")
+	c.Assert(service.StopMachine(m.Id), gc.ErrorMatches, "second helper")
+	c.Assert(service.StopMachine(m.Id), gc.IsNil)
+}
+
+// Tests for typed hooks
+func (s *CloudAPISuite) TestTypedHooks(c *gc.C) {
+	service := lc.New(testServiceURL, testUserAccount)
+	service.BeforeCreateMachine(func(name, pkg, image string) error {
+		if pkg == "Large" {
+			return fmt.Errorf("no capacity for %s", name)
+		}
+		return nil
+	})
+	var resized []string
+	service.AfterResizeMachine(func(err error, machineID, packageName string) error {
+		resized = append(resized, packageName)
+		return err
+	})
+	var listed int
+	service.AfterListMachines(func(result []*cloudapi.Machine, err error, filters map[string]string) error {
+		listed = len(result)
+		return nil
+	}, hook.Once())
+
+	_, err := service.CreateMachine(testMachineName, "Large", testImage, []string{testNetworkID}, nil, nil)
+	c.Assert(err, gc.ErrorMatches, "no capacity for "+testMachineName)
+	m, err := service.CreateMachine(testMachineName, testPackage, testImage, []string{testNetworkID}, nil, nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(service.ResizeMachine(m.Id, "Medium"), gc.IsNil)
+	c.Assert(resized, gc.DeepEquals, []string{"Medium"})
+	_, err = service.ListMachines(nil)
+	c.Assert(err, gc.IsNil)
+	c.Assert(listed, gc.Equals, 1)
+
+	c.Assert(service.CallsTo(lc.HookCreateMachine), gc.HasLen, 2)
+
+	service.BeforeAddMachineTags(func(machineID string, tags map[string]string) error {
+		if _, ok := tags["locked"]; ok {
+			return fmt.Errorf("machine %s is locked", machineID)
+		}
+		return nil
+	})
+	_, err = service.AddMachineTags(m.Id, map[string]string{"locked": "true"})
+	c.Assert(err, gc.ErrorMatches, "machine "+m.Id+" is locked")
+	var vlans []int16
+	service.AfterCreateFabricVLAN(func(result *cloudapi.FabricVLAN, err error, vlan cloudapi.FabricVLAN) error {
+		vlans = append(vlans, result.Id)
+		return err
+	})
+	_, err = service.CreateFabricVLAN(cloudapi.FabricVLAN{Id: 3, Name: "hooked"})
+	c.Assert(err, gc.IsNil)
+	c.Assert(vlans, gc.DeepEquals, []int16{3})
+	c.Assert(service.UpdateMachine(m.Id, "rename", map[string]string{"name": "renamed"}), gc.IsNil)
+	c.Assert(service.UpdateMachine(m.Id, "explode", nil), gc.ErrorMatches, "explode is not a valid action")
+	c.Assert(service.CallsTo(lc.HookUpdateMachine), gc.HasLen, 2)
+	c.Assert(service.CallsTo(lc.HookRenameMachine), gc.HasLen, 1)
 }
@@ -0,0 +1,315 @@
+package hook
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// DefaultCallLimit is how many calls a TestService keeps by default, see SetCallLimit.
+const DefaultCallLimit = 10000
+
+// Call is a call of a service function, or of a control point, recorded by TestService.
+type Call struct {
+	Name ControlPoint
+	// Args are the arguments passed to the control point, as passed.
+	Args []interface{}
+	// Time is when the call reached its control point.
+	Time time.Time
+	// Duration is how long the call took, from Time until it returned through ProcessAfterHook or was failed by a
+	// hook. It is zero for a call still running, or for one that never reaches ProcessAfterHook.
+	Duration time.Duration
+	// Result is the result the call returned through ProcessAfterHook, if any.
+	Result interface{}
+	// Err is the error the call returned: that of the hook that failed it, or that of the operation as passed to
+	// ProcessAfterHook.
+	Err error
+
+	done bool
+}
+
+func (c Call) String() string {
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = fmt.Sprintf("%#v", arg)
+	}
+	return fmt.Sprintf("%s(%s)", c.Name, strings.Join(args, ", "))
+}
+
+// RecordCalls turns the recording of calls on or off. Calls are recorded unless turned off.
+func (s *TestService) RecordCalls(record bool) {
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	s.notRecording = !record
+}
+
+// SetCallLimit sets how many calls the service keeps, DefaultCallLimit by default. Once over the limit, the oldest
+// calls are forgotten, and expectations are checked against the calls kept. A limit of zero or less keeps every call.
+func (s *TestService) SetCallLimit(limit int) {
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	if limit == 0 {
+		limit = -1
+	}
+	s.callLimit = limit
+	s.trimCalls()
+}
+
+// trimCalls forgets the oldest calls over the limit. The caller must hold s.callsMu.
+func (s *TestService) trimCalls() {
+	limit := s.callLimit
+	if limit == 0 {
+		limit = DefaultCallLimit
+	}
+	if limit > 0 && len(s.calls) > limit {
+		s.calls = append([]*Call(nil), s.calls[len(s.calls)-limit:]...)
+	}
+}
+
+// recordCall adds a call to the calls of the service and returns it, unless recording is turned off.
+func (s *TestService) recordCall(name ControlPoint, args []interface{}) *Call {
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	if s.notRecording {
+		return nil
+	}
+	call := &Call{Name: name, Args: args, Time: time.Now()}
+	s.calls = append(s.calls, call)
+	s.trimCalls()
+	return call
+}
+
+// recordError sets the error returned by the hook for a recorded call, and finishes the call if the hook failed it.
+func (s *TestService) recordError(call *Call, err error) {
+	if call == nil {
+		return
+	}
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	call.Err = err
+	if err != nil {
+		call.Duration = time.Since(call.Time)
+		call.done = true
+	}
+}
+
+// recordReturn finishes a recorded call, setting what it returned.
+func (s *TestService) recordReturn(call *Call, result interface{}, err error) {
+	if call == nil {
+		return
+	}
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	call.Duration = time.Since(call.Time)
+	call.Result = result
+	call.Err = err
+	call.done = true
+}
+
+// Calls returns the calls recorded by the service, in the order they were made.
+func (s *TestService) Calls() []Call {
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	calls := make([]Call, len(s.calls))
+	for i, call := range s.calls {
+		calls[i] = *call
+	}
+	return calls
+}
+
+// CallsTo returns the recorded calls to the named function or control point.
+func (s *TestService) CallsTo(name ControlPoint) []Call {
+	var calls []Call
+	for _, call := range s.Calls() {
+		if call.Name == name {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// ResetCalls forgets the recorded calls and expectations.
+func (s *TestService) ResetCalls() {
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	s.calls = nil
+	s.expectations = nil
+}
+
+// ArgMatcher matches an argument of a call.
+type ArgMatcher interface {
+	Match(arg interface{}) bool
+	String() string
+}
+
+type anyArg struct{}
+
+func (anyArg) Match(interface{}) bool { return true }
+func (anyArg) String() string         { return "any" }
+
+// Any matches any argument.
+var Any ArgMatcher = anyArg{}
+
+type equalArg struct {
+	value interface{}
+}
+
+func (m equalArg) Match(arg interface{}) bool { return reflect.DeepEqual(m.value, arg) }
+func (m equalArg) String() string             { return fmt.Sprintf("%#v", m.value) }
+
+// Equals matches arguments deeply equal to the given value.
+func Equals(value interface{}) ArgMatcher {
+	return equalArg{value}
+}
+
+type funcArg struct {
+	description string
+	match       func(interface{}) bool
+}
+
+func (m funcArg) Match(arg interface{}) bool { return m.match(arg) }
+func (m funcArg) String() string             { return m.description }
+
+// MatchFunc matches the arguments for which match returns true. The description is used in Verify errors.
+func MatchFunc(description string, match func(arg interface{}) bool) ArgMatcher {
+	return funcArg{description, match}
+}
+
+// Expectation is a constraint on the calls of a service, checked by Verify.
+type Expectation struct {
+	name     ControlPoint
+	min, max int // max < 0 for no upper bound
+	matchers []ArgMatcher
+	after    []*Expectation
+}
+
+// ExpectCalled adds the expectation that the named function or control point is called, at least once unless
+// constrained further.
+// Use it like this:
+//
+//	create := s.ExpectCalled("CreateMachine").Times(2).With(hook.Any, hook.Equals("Small"))
+//	s.ExpectCalled("StopMachine").After(create)
+//	...
+//	if err := s.Verify(); err != nil {
+//	    t.Fatal(err)
+//	}
+func (s *TestService) ExpectCalled(name ControlPoint) *Expectation {
+	e := &Expectation{name: name, min: 1, max: -1}
+	s.callsMu.Lock()
+	defer s.callsMu.Unlock()
+	s.expectations = append(s.expectations, e)
+	return e
+}
+
+// ExpectNotCalled adds the expectation that the named function or control point is not called.
+func (s *TestService) ExpectNotCalled(name ControlPoint) *Expectation {
+	return s.ExpectCalled(name).Times(0)
+}
+
+// Times expects exactly n matching calls.
+func (e *Expectation) Times(n int) *Expectation {
+	e.min, e.max = n, n
+	return e
+}
+
+// AtLeast expects n matching calls or more.
+func (e *Expectation) AtLeast(n int) *Expectation {
+	e.min, e.max = n, -1
+	return e
+}
+
+// AtMost expects at most n matching calls.
+func (e *Expectation) AtMost(n int) *Expectation {
+	e.min, e.max = 0, n
+	return e
+}
+
+// With only counts the calls whose leading arguments match the given values. A value that is an ArgMatcher is
+// used as is, any other value matches arguments deeply equal to it.
+func (e *Expectation) With(args ...interface{}) *Expectation {
+	e.matchers = make([]ArgMatcher, len(args))
+	for i, arg := range args {
+		if m, ok := arg.(ArgMatcher); ok {
+			e.matchers[i] = m
+		} else {
+			e.matchers[i] = Equals(arg)
+		}
+	}
+	return e
+}
+
+// After expects the matching calls to be made after all the calls matching the given expectations.
+func (e *Expectation) After(others ...*Expectation) *Expectation {
+	e.after = append(e.after, others...)
+	return e
+}
+
+func (e *Expectation) matches(call Call) bool {
+	if call.Name != e.name || len(call.Args) < len(e.matchers) {
+		return false
+	}
+	for i, m := range e.matchers {
+		if !m.Match(call.Args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *Expectation) String() string {
+	if e.matchers == nil {
+		return string(e.name)
+	}
+	args := make([]string, len(e.matchers))
+	for i, m := range e.matchers {
+		args[i] = m.String()
+	}
+	return fmt.Sprintf("%s(%s)", e.name, strings.Join(args, ", "))
+}
+
+// indexes returns the positions of the calls matching the expectation.
+func (e *Expectation) indexes(calls []Call) []int {
+	var indexes []int
+	for i, call := range calls {
+		if e.matches(call) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// Verify checks the recorded calls against the expectations, returning an error describing every unmet one.
+func (s *TestService) Verify() error {
+	calls := s.Calls()
+	s.callsMu.Lock()
+	expectations := append([]*Expectation(nil), s.expectations...)
+	s.callsMu.Unlock()
+
+	var failures []string
+	for _, e := range expectations {
+		indexes := e.indexes(calls)
+		n := len(indexes)
+		switch {
+		case e.min == e.max && n != e.min:
+			failures = append(failures, fmt.Sprintf("expected %d calls to %s, got %d", e.min, e, n))
+		case n < e.min:
+			failures = append(failures, fmt.Sprintf("expected at least %d calls to %s, got %d", e.min, e, n))
+		case e.max >= 0 && n > e.max:
+			failures = append(failures, fmt.Sprintf("expected at most %d calls to %s, got %d", e.max, e, n))
+		}
+		if n == 0 {
+			continue
+		}
+		for _, before := range e.after {
+			previous := before.indexes(calls)
+			if len(previous) > 0 && previous[len(previous)-1] > indexes[0] {
+				failures = append(failures, fmt.Sprintf("expected calls to %s after calls to %s", e, before))
+			}
+		}
+	}
+	if failures == nil {
+		return nil
+	}
+	return fmt.Errorf("unmet expectations:\n%s", strings.Join(failures, "\n"))
+}
@@ -1,17 +1,42 @@
+// Package hook lets tests change and observe what a service double does when its control points are reached.
+//
+// Control points are named with the ControlPoint type, which RegisterControlPoint, ProcessControlHook and the other
+// methods taking a control point name used to take as a string. Calls passing a string constant still compile;
+// those passing a string variable need a ControlPoint conversion, and implementations of ServiceControl need their
+// RegisterControlPoint method changed to take a ControlPoint.
 package hook
 
 import (
 	"runtime"
 	"strings"
+	"sync"
 )
 
-// TestService is the root object for the test service
+// TestService is the root object for the test service. Hooks may be
+// registered and processed concurrently. Every call reaching a control point
+// is recorded, see Calls and ExpectCalled.
 type TestService struct {
 	ServiceControl
 	// Hooks to run when specified control points are reached in the service business logic.
 	ControlHooks map[string]ControlProcessor
+	hooksMu      sync.RWMutex
+	// Hooks stacked on control points with AddBeforeHook and AddAfterHook.
+	beforeHooks map[ControlPoint][]*stackedHook
+	afterHooks  map[ControlPoint][]*stackedHook
+
+	// Calls reaching control points, and the expectations Verify checks them against.
+	calls        []*Call
+	expectations []*Expectation
+	notRecording bool
+	callLimit    int // 0 for DefaultCallLimit, negative for none
+	callsMu      sync.Mutex
 }
 
+// ControlPoint names a point of the service business logic hooks run at: a service function, such as
+// "CreateMachine", or a logical execution point meaningful to the service. Services export a constant for each of
+// their control points.
+type ControlPoint string
+
 // ControlProcessor defines a function that is run when a specified control point is reached in the service
 // business logic. The function receives the service instance so internal state can be inspected, plus for any
 // arguments passed to the currently executing service function.
@@ -25,7 +50,7 @@ type ControlHookCleanup func()
 // If name is "", the hook for the currently executing function is executed.
 // Returns a function which can be used to remove the hook.
 type ServiceControl interface {
-	RegisterControlPoint(name string, controller ControlProcessor) ControlHookCleanup
+	RegisterControlPoint(name ControlPoint, controller ControlProcessor) ControlHookCleanup
 }
 
 // currentServiceMethodName returns the method executing on the service when ProcessControlHook was invoked.
@@ -46,40 +71,83 @@ func unqualifiedMethodName(pc uintptr) string {
 
 // ProcessControlHook retrieves the ControlProcessor for the specified hook name and runs it, returning any error.
 // Use it like this to invoke a hook registered for some arbitrary control point:
-// if err := n.ProcessControlHook("foobar", <serviceinstance>, <somearg1>, <somearg2>); err != nil {
-//     return err
-// }
-func (s *TestService) ProcessControlHook(hookName string, sc ServiceControl, args ...interface{}) error {
-	if s.ControlHooks == nil {
-		return nil
+//
+//	if err := n.ProcessControlHook("foobar", <serviceinstance>, <somearg1>, <somearg2>); err != nil {
+//	    return err
+//	}
+//
+// Use StartCall instead to also run the After hooks and record what the call returns.
+func (s *TestService) ProcessControlHook(hookName ControlPoint, sc ServiceControl, args ...interface{}) error {
+	_, err := s.StartCall(hookName, sc, args...)
+	return err
+}
+
+// CallHandle is a call started with StartCall, to finish with ProcessAfterHook.
+type CallHandle struct {
+	name ControlPoint
+	args []interface{}
+	call *Call // nil if calls are not recorded
+}
+
+// StartCall records a call reaching the named control point and runs its hooks like ProcessControlHook. It returns
+// a handle on the call, which ProcessAfterHook finishes once the service function returns.
+// Use it like this, with named results:
+//
+//	call, err := n.StartCall("foobar", <serviceinstance>, <somearg1>, <somearg2>)
+//	if err != nil {
+//	    return nil, err
+//	}
+//	defer n.ProcessAfterHook(call, <serviceinstance>, &result, &err)
+func (s *TestService) StartCall(hookName ControlPoint, sc ServiceControl, args ...interface{}) (*CallHandle, error) {
+	s.hooksMu.RLock()
+	hook, ok := s.ControlHooks[string(hookName)]
+	before := append([]*stackedHook(nil), s.beforeHooks[hookName]...)
+	s.hooksMu.RUnlock()
+	call := &CallHandle{name: hookName, args: args, call: s.recordCall(hookName, args)}
+	// The hooks run without the lock held so they can register or remove hooks.
+	var err error
+	if ok {
+		err = hook(sc, args...)
 	}
-	if hook, ok := s.ControlHooks[hookName]; ok {
-		return hook(sc, args...)
+	for _, h := range before {
+		if err != nil {
+			break
+		}
+		if s.take(h) {
+			err = h.before(sc, args...)
+		}
 	}
-	return nil
+	s.recordError(call.call, err)
+	return call, err
 }
 
 // ProcessFunctionHook runs the ControlProcessor for the current function, returning any error.
 // Use it like this:
-// if err := n.ProcessFunctionHook(<serviceinstance>, <somearg1>, <somearg2>); err != nil {
-//     return err
-// }
+//
+//	if err := n.ProcessFunctionHook(<serviceinstance>, <somearg1>, <somearg2>); err != nil {
+//	    return err
+//	}
+//
+// Deprecated: the name of the current function is looked up at run time, which inlining, wrappers or renaming
+// silently break. Use ProcessControlHook with a ControlPoint constant instead.
 func (s *TestService) ProcessFunctionHook(sc ServiceControl, args ...interface{}) error {
 	hookName := s.currentServiceMethodName()
-	return s.ProcessControlHook(hookName, sc, args...)
+	return s.ProcessControlHook(ControlPoint(hookName), sc, args...)
 }
 
 // RegisterControlPoint assigns the specified controller to the named hook. If nil, any existing controller for the
 // hook is removed.
 // hookName is the name of a function on the service or some arbitrarily named control point.
-func (s *TestService) RegisterControlPoint(hookName string, controller ControlProcessor) ControlHookCleanup {
+func (s *TestService) RegisterControlPoint(hookName ControlPoint, controller ControlProcessor) ControlHookCleanup {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
 	if s.ControlHooks == nil {
 		s.ControlHooks = make(map[string]ControlProcessor)
 	}
 	if controller == nil {
-		delete(s.ControlHooks, hookName)
+		delete(s.ControlHooks, string(hookName))
 	} else {
-		s.ControlHooks[hookName] = controller
+		s.ControlHooks[string(hookName)] = controller
 	}
 	return func() {
 		s.RegisterControlPoint(hookName, nil)
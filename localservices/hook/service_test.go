@@ -2,8 +2,10 @@ package hook
 
 import (
 	"fmt"
-	gc "launchpad.net/gocheck"
+	"sync"
 	"testing"
+
+	gc "launchpad.net/gocheck"
 )
 
 func Test(t *testing.T) {
@@ -103,3 +105,248 @@ func (s *ServiceSuite) TestHookCleanup(c *gc.C) {
 	c.Assert(s.ts.label, gc.Equals, "foobar")
 
 }
+
+func (s *ServiceSuite) TestConcurrentHooks(c *gc.C) {
+	noop := func(ServiceControl, ...interface{}) error { return nil }
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			cleanup := s.ts.RegisterControlPoint("baz", noop)
+			cleanup()
+		}()
+		go func() {
+			defer wg.Done()
+			c.Check(s.ts.ProcessControlHook("baz", s.ts), gc.IsNil)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *ServiceSuite) TestCallsAreRecorded(c *gc.C) {
+	c.Assert(s.ts.foo("first", false), gc.IsNil)
+	c.Assert(s.ts.foo("second", true), gc.NotNil)
+	c.Assert(s.ts.bar(), gc.IsNil)
+
+	calls := s.ts.Calls()
+	c.Assert(calls, gc.HasLen, 3)
+	c.Assert(calls[0].Name, gc.Equals, ControlPoint("foo"))
+	c.Assert(calls[0].Args, gc.DeepEquals, []interface{}{"first", false})
+	c.Assert(calls[0].Err, gc.IsNil)
+	c.Assert(calls[1].Err, gc.ErrorMatches, "An error occurred")
+	c.Assert(calls[2].String(), gc.Equals, "foobar()")
+	c.Assert(calls[1].Time.Before(calls[0].Time), gc.Equals, false)
+	c.Assert(s.ts.CallsTo("foo"), gc.HasLen, 2)
+
+	result, err := s.ts.baz("x")
+	c.Assert(err, gc.IsNil)
+	calls = s.ts.CallsTo("baz")
+	c.Assert(calls, gc.HasLen, 1)
+	c.Assert(calls[0].Result, gc.Equals, result)
+	c.Assert(calls[0].Err, gc.IsNil)
+	c.Assert(calls[0].Duration > 0, gc.Equals, true)
+	s.ts.AddAfterHook("baz", func(ServiceControl, interface{}, error, ...interface{}) error {
+		return fmt.Errorf("failed after the fact")
+	}, Once())
+	_, err = s.ts.baz("x")
+	c.Assert(s.ts.CallsTo("baz")[1].Err, gc.Equals, err)
+	s.ts.AddBeforeHook("baz", func(ServiceControl, ...interface{}) error {
+		return fmt.Errorf("failed before")
+	}, Once())
+	_, err = s.ts.baz("x")
+	calls = s.ts.CallsTo("baz")
+	c.Assert(calls[2].Err, gc.Equals, err)
+	c.Assert(calls[2].Result, gc.IsNil)
+	c.Assert(calls[2].Duration > 0, gc.Equals, true)
+
+	s.ts.RecordCalls(false)
+	c.Assert(s.ts.bar(), gc.IsNil)
+	c.Assert(s.ts.Calls(), gc.HasLen, 6)
+	s.ts.RecordCalls(true)
+	s.ts.ResetCalls()
+	c.Assert(s.ts.Calls(), gc.HasLen, 0)
+}
+
+func (s *ServiceSuite) TestCallLimit(c *gc.C) {
+	for i := 0; i < DefaultCallLimit+1; i++ {
+		s.ts.ProcessControlHook("baz", s.ts, i)
+	}
+	calls := s.ts.Calls()
+	c.Assert(calls, gc.HasLen, DefaultCallLimit)
+	c.Assert(calls[0].Args, gc.DeepEquals, []interface{}{1})
+
+	s.ts.SetCallLimit(2)
+	calls = s.ts.Calls()
+	c.Assert(calls, gc.HasLen, 2)
+	c.Assert(calls[1].Args, gc.DeepEquals, []interface{}{DefaultCallLimit})
+
+	s.ts.SetCallLimit(-1)
+	for i := 0; i < 3; i++ {
+		s.ts.ProcessControlHook("baz", s.ts, i)
+	}
+	c.Assert(s.ts.Calls(), gc.HasLen, 5)
+}
+
+func (s *ServiceSuite) TestExpectations(c *gc.C) {
+	foo := s.ts.ExpectCalled("foo").Times(2)
+	s.ts.ExpectCalled("foo").With("second").Times(1)
+	s.ts.ExpectCalled("foo").With(MatchFunc("a label", func(arg interface{}) bool {
+		_, ok := arg.(string)
+		return ok
+	}), Any).AtLeast(2)
+	s.ts.ExpectCalled("foobar").After(foo)
+	s.ts.ExpectNotCalled("baz")
+
+	c.Assert(s.ts.foo("first", false), gc.IsNil)
+	c.Assert(s.ts.foo("second", false), gc.IsNil)
+	c.Assert(s.ts.bar(), gc.IsNil)
+	c.Assert(s.ts.Verify(), gc.IsNil)
+}
+
+func (s *ServiceSuite) TestUnmetExpectations(c *gc.C) {
+	bar := s.ts.ExpectCalled("foobar")
+	s.ts.ExpectCalled("foo").Times(2).After(bar)
+	s.ts.ExpectCalled("foo").With("third")
+	s.ts.ExpectCalled("foo").With(Any, false).AtMost(0)
+	s.ts.ExpectNotCalled("foobar")
+
+	c.Assert(s.ts.foo("first", false), gc.IsNil)
+	c.Assert(s.ts.bar(), gc.IsNil)
+	c.Assert(s.ts.Verify(), gc.ErrorMatches, `unmet expectations:
+expected 2 calls to foo, got 1
+expected calls to foo after calls to foobar
+expected at least 1 calls to foo\("third"\), got 0
+expected 0 calls to foo\(any, false\), got 1
+expected 0 calls to foobar, got 1`)
+
+	s.ts.ResetCalls()
+	c.Assert(s.ts.Verify(), gc.IsNil)
+}
+
+func (s *testService) baz(label string) (result string, err error) {
+	call, err := s.StartCall("baz", s, label)
+	if err != nil {
+		return "", err
+	}
+	defer s.ProcessAfterHook(call, s, &result, &err)
+	return "baz " + label, nil
+}
+
+func (s *ServiceSuite) TestStackedBeforeHooks(c *gc.C) {
+	var order []string
+	record := func(label string) ControlProcessor {
+		return func(ServiceControl, ...interface{}) error {
+			order = append(order, label)
+			return nil
+		}
+	}
+	s.ts.AddBeforeHook("foo", record("second"))
+	s.ts.AddBeforeHook("foo", record("first"), Priority(-1))
+	cleanup := s.ts.AddBeforeHook("foo", record("third"))
+	s.ts.AddBeforeHook("foo", record("once"), Once(), Priority(1))
+
+	c.Assert(s.ts.foo("stacked", false), gc.IsNil)
+	c.Assert(s.ts.label, gc.Equals, "stacked")
+	c.Assert(order, gc.DeepEquals, []string{"first", "second", "third", "once"})
+
+	// The hook registered with RegisterControlPoint still runs first, and replaces none of the stacked ones.
+	order = nil
+	cleanup()
+	s.ts.RegisterControlPoint("foo", functionControlHook)
+	c.Assert(s.ts.foo("again", false), gc.IsNil)
+	c.Assert(order, gc.DeepEquals, []string{"first", "second"})
+}
+
+func (s *ServiceSuite) TestStackedHookError(c *gc.C) {
+	var runs int
+	s.ts.AddBeforeHook("foobar", func(ServiceControl, ...interface{}) error {
+		return fmt.Errorf("injected")
+	}, NTimes(2))
+	s.ts.AddBeforeHook("foobar", func(ServiceControl, ...interface{}) error {
+		runs++
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		c.Assert(s.ts.bar(), gc.ErrorMatches, "injected")
+	}
+	c.Assert(runs, gc.Equals, 0)
+	c.Assert(s.ts.bar(), gc.IsNil)
+	c.Assert(runs, gc.Equals, 1)
+	c.Assert(s.ts.CallsTo("foobar")[0].Err, gc.ErrorMatches, "injected")
+}
+
+func (s *ServiceSuite) TestAfterHooks(c *gc.C) {
+	var seen []interface{}
+	s.ts.AddAfterHook("baz", func(sc ServiceControl, result interface{}, err error, args ...interface{}) error {
+		seen = append(seen, result, err, args[0])
+		return nil
+	})
+	s.ts.AddAfterHook("baz", func(sc ServiceControl, result interface{}, err error, args ...interface{}) error {
+		return fmt.Errorf("%s failed after the fact", result)
+	}, Once())
+	s.ts.AddAfterHook("baz", func(sc ServiceControl, result interface{}, err error, args ...interface{}) error {
+		seen = append(seen, err.Error())
+		return nil
+	}, Priority(1), Once())
+
+	result, err := s.ts.baz("x")
+	c.Assert(result, gc.Equals, "baz x")
+	c.Assert(err, gc.ErrorMatches, "baz x failed after the fact")
+	c.Assert(seen, gc.DeepEquals, []interface{}{"baz x", nil, "x", "baz x failed after the fact"})
+
+	_, err = s.ts.baz("y")
+	c.Assert(err, gc.IsNil)
+}
+
+func (s *ServiceSuite) TestConcurrentOnceHooks(c *gc.C) {
+	var mu sync.Mutex
+	runs := 0
+	s.ts.AddBeforeHook("baz", func(ServiceControl, ...interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		runs++
+		return nil
+	}, NTimes(3))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Check(s.ts.ProcessControlHook("baz", s.ts), gc.IsNil)
+		}()
+	}
+	wg.Wait()
+	c.Assert(runs, gc.Equals, 3)
+}
+
+func (s *ServiceSuite) TestAfterHookResult(c *gc.C) {
+	var seen interface{}
+	s.ts.AddAfterHook("baz", func(sc ServiceControl, result interface{}, err error, args ...interface{}) error {
+		seen = result
+		return nil
+	})
+	_, err := s.ts.baz("x")
+	c.Assert(err, gc.IsNil)
+	c.Assert(seen, gc.Equals, "baz x")
+}
+
+func (s *ServiceSuite) TestOverlappingCalls(c *gc.C) {
+	first, err := s.ts.StartCall("baz", s.ts, "x")
+	c.Assert(err, gc.IsNil)
+	second, err := s.ts.StartCall("baz", s.ts, "x")
+	c.Assert(err, gc.IsNil)
+
+	// Each call is finished with its own result, even with the same arguments and out of order. The result may be
+	// passed as is, and the error omitted.
+	result := "first"
+	s.ts.ProcessAfterHook(second, s.ts, "second", nil)
+	s.ts.ProcessAfterHook(first, s.ts, &result, nil)
+	calls := s.ts.CallsTo("baz")
+	c.Assert(calls, gc.HasLen, 2)
+	c.Assert(calls[0].Result, gc.Equals, "first")
+	c.Assert(calls[1].Result, gc.Equals, "second")
+	c.Assert(calls[1].Err, gc.IsNil)
+}
@@ -0,0 +1,163 @@
+package hook
+
+import (
+	"reflect"
+)
+
+// AfterProcessor defines a function that is run when a service function returns. Besides the arguments of the
+// function, it receives its result and error, so that it can inspect them or make the call fail after the fact.
+type AfterProcessor func(sc ServiceControl, result interface{}, err error, args ...interface{}) error
+
+// HookOption configures a hook added with AddBeforeHook or AddAfterHook.
+type HookOption func(*stackedHook)
+
+// Once removes the hook after it has run once.
+func Once() HookOption {
+	return NTimes(1)
+}
+
+// NTimes removes the hook after it has run n times.
+func NTimes(n int) HookOption {
+	return func(h *stackedHook) {
+		h.times = n
+	}
+}
+
+// Priority sets the order of the hook among the hooks of its control point: hooks run by increasing priority, and
+// in the order they were added for the same priority. The default priority is 0.
+func Priority(priority int) HookOption {
+	return func(h *stackedHook) {
+		h.priority = priority
+	}
+}
+
+// stackedHook is one of the hooks stacked on a control point.
+type stackedHook struct {
+	name     ControlPoint
+	before   ControlProcessor
+	after    AfterProcessor
+	priority int
+	times    int // runs left, 0 for no limit
+	removed  bool
+}
+
+// AddBeforeHook adds a hook run when the named control point is reached, after the hook registered with
+// RegisterControlPoint if any and the Before hooks coming first. The first hook to return an error stops the others
+// and fails the call. Hooks added this way do not replace each other, so independent test helpers can stack them.
+// Returns a function which can be used to remove the hook.
+func (s *TestService) AddBeforeHook(hookName ControlPoint, processor ControlProcessor, opts ...HookOption) ControlHookCleanup {
+	return s.addHook(&stackedHook{name: hookName, before: processor}, opts)
+}
+
+// AddAfterHook adds a hook run when the service function of the named control point returns, see
+// ProcessAfterHook. After hooks run in order, each seeing the error left by the previous one.
+// Returns a function which can be used to remove the hook.
+func (s *TestService) AddAfterHook(hookName ControlPoint, processor AfterProcessor, opts ...HookOption) ControlHookCleanup {
+	return s.addHook(&stackedHook{name: hookName, after: processor}, opts)
+}
+
+func (s *TestService) addHook(h *stackedHook, opts []HookOption) ControlHookCleanup {
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	stacks := s.stacks(h)
+	if *stacks == nil {
+		*stacks = make(map[ControlPoint][]*stackedHook)
+	}
+	stack := (*stacks)[h.name]
+	i := len(stack)
+	for i > 0 && stack[i-1].priority > h.priority {
+		i--
+	}
+	stack = append(stack, nil)
+	copy(stack[i+1:], stack[i:])
+	stack[i] = h
+	(*stacks)[h.name] = stack
+
+	return func() {
+		s.hooksMu.Lock()
+		defer s.hooksMu.Unlock()
+		s.removeHook(h)
+	}
+}
+
+// stacks returns the hooks of the phase of the given hook. The caller must hold hooksMu.
+func (s *TestService) stacks(h *stackedHook) *map[ControlPoint][]*stackedHook {
+	if h.after != nil {
+		return &s.afterHooks
+	}
+	return &s.beforeHooks
+}
+
+// removeHook takes a hook off its control point. The caller must hold hooksMu.
+func (s *TestService) removeHook(h *stackedHook) {
+	if h.removed {
+		return
+	}
+	h.removed = true
+	stacks := s.stacks(h)
+	stack := (*stacks)[h.name]
+	for i, other := range stack {
+		if other == h {
+			stack = append(stack[:i:i], stack[i+1:]...)
+			break
+		}
+	}
+	if len(stack) == 0 {
+		delete(*stacks, h.name)
+	} else {
+		(*stacks)[h.name] = stack
+	}
+}
+
+// take reserves a run of a hook, removing it once it has run the times it was added for. Returns false if the hook
+// has been removed since the stack it belongs to was read.
+func (s *TestService) take(h *stackedHook) bool {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	if h.removed {
+		return false
+	}
+	if h.times > 0 {
+		h.times--
+		if h.times == 0 {
+			s.removeHook(h)
+		}
+	}
+	return true
+}
+
+// ProcessAfterHook runs the After hooks of the control point of a call started with StartCall, once its service
+// function has returned. result points to the result of the function, or is the result itself or nil, and err to
+// its error, which is replaced by the error returned by an After hook; a nil err stands for no error. The call is
+// finished with the result and the error, whether or not there are After hooks.
+func (s *TestService) ProcessAfterHook(call *CallHandle, sc ServiceControl, result interface{}, err *error) {
+	if call == nil {
+		return
+	}
+	if err == nil {
+		err = new(error)
+	}
+	value := result
+	if v := reflect.ValueOf(result); v.Kind() == reflect.Ptr && !v.IsNil() {
+		value = v.Elem().Interface()
+	}
+	defer func() {
+		s.recordReturn(call.call, value, *err)
+	}()
+
+	s.hooksMu.RLock()
+	after := append([]*stackedHook(nil), s.afterHooks[call.name]...)
+	s.hooksMu.RUnlock()
+	for _, h := range after {
+		if !s.take(h) {
+			continue
+		}
+		if hookErr := h.after(sc, value, *err, call.args...); hookErr != nil {
+			*err = hookErr
+		}
+	}
+}
@@ -0,0 +1,258 @@
+//
+// gosdc - Go library to interact with the Joyent CloudAPI
+//
+// Test kit booting the CloudAPI double behind a ready to use client
+//
+// Copyright (c) Joyent Inc.
+//
+
+/*
+Package testkit boots the local CloudAPI double over HTTP and returns a
+cloudapi.Client wired to it, so tests don't have to repeat the server, router,
+key and credentials setup.
+
+	func TestSomething(t *testing.T) {
+		client, double := testkit.New(t,
+			testkit.WithHook(lc.HookCreateMachine, failCreate),
+		)
+		...
+	}
+
+Everything started by New is torn down through t.Cleanup.
+*/
+package testkit
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http/httptest"
+
+	"github.com/joyent/gocommon/client"
+	"github.com/joyent/gosdc/cloudapi"
+	lc "github.com/joyent/gosdc/localservices/cloudapi"
+	"github.com/joyent/gosdc/localservices/hook"
+	"github.com/joyent/gosign/auth"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// DefaultAccount is the account name the double is rooted at unless
+	// WithAccount is given.
+	DefaultAccount = "testkit"
+
+	// KeyName is the name the generated key is registered under in the double.
+	KeyName = "testkit"
+
+	keyBits = 2048
+)
+
+// T is the subset of testing.TB used by the kit. *testing.T and *testing.B
+// both satisfy it.
+type T interface {
+	Fatalf(format string, args ...interface{})
+	Cleanup(func())
+}
+
+// Fixture seeds the double before the client is handed out.
+type Fixture func(api *lc.CloudAPI) error
+
+// Option configures the kit built by New.
+type Option func(*config)
+
+type config struct {
+	account  string
+	logger   *log.Logger
+	fixtures []Fixture
+	hooks    []namedHook
+	verify   bool
+}
+
+type namedHook struct {
+	name      hook.ControlPoint
+	processor hook.ControlProcessor
+}
+
+// WithAccount roots the double and the client credentials at the given account.
+func WithAccount(account string) Option {
+	return func(cfg *config) {
+		cfg.account = account
+	}
+}
+
+// WithLogger sets the logger used by the client. Client logging is discarded
+// by default.
+func WithLogger(logger *log.Logger) Option {
+	return func(cfg *config) {
+		cfg.logger = logger
+	}
+}
+
+// WithFixture runs fn against the double once it is set up. Fixtures run in
+// the order they are given; the first error fails the test.
+func WithFixture(fn Fixture) Option {
+	return func(cfg *config) {
+		cfg.fixtures = append(cfg.fixtures, fn)
+	}
+}
+
+// WithFixtureFile loads the JSON or YAML fixture at path into the double, see
+// cloudapi.Fixture. The key of the kit is kept even if the fixture replaces
+// the keys of the account.
+func WithFixtureFile(path string) Option {
+	return WithFixture(func(api *lc.CloudAPI) error {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		f, err := lc.ParseFixture(data)
+		if err != nil {
+			return err
+		}
+		if f.Keys != nil {
+			key, err := api.GetKey(KeyName)
+			if err != nil {
+				return err
+			}
+			f.Keys = append(f.Keys, *key)
+		}
+		return api.LoadFixture(f)
+	})
+}
+
+// WithHook adds a Before hook to the double, see hook.TestService. Hooks
+// given for the same control point all run, in the order they are given.
+func WithHook(name hook.ControlPoint, processor hook.ControlProcessor) Option {
+	return func(cfg *config) {
+		cfg.hooks = append(cfg.hooks, namedHook{name, processor})
+	}
+}
+
+// WithVerify fails the test at cleanup if the calls made to the double do
+// not meet the expectations set on it with ExpectCalled.
+func WithVerify() Option {
+	return func(cfg *config) {
+		cfg.verify = true
+	}
+}
+
+// New starts the CloudAPI double on a local HTTP server and returns a client
+// authenticated against it with a freshly generated key, together with the
+// double itself for direct inspection. The generated public key is registered
+// in the double as KeyName and the double requires every request to be signed.
+func New(t T, opts ...Option) (*cloudapi.Client, *lc.CloudAPI) {
+	cfg := &config{
+		account: DefaultAccount,
+		logger:  log.New(ioutil.Discard, "", log.LstdFlags),
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	mux := httprouter.New()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	api := lc.New(server.URL, cfg.account)
+	api.SetupHTTP(mux)
+
+	creds := register(t, api)
+	api.RequireSignatures(true)
+
+	for _, h := range cfg.hooks {
+		t.Cleanup(api.AddBeforeHook(h.name, h.processor))
+	}
+
+	for _, fixture := range cfg.fixtures {
+		if err := fixture(api); err != nil {
+			t.Fatalf("testkit: fixture failed: %v", err)
+		}
+	}
+
+	// calls made while setting up the kit are not the test's
+	api.ResetCalls()
+	if cfg.verify {
+		t.Cleanup(func() {
+			if err := api.Verify(); err != nil {
+				t.Fatalf("testkit: %v", err)
+			}
+		})
+	}
+
+	return cloudapi.New(client.NewClient(creds.SdcEndpoint.URL, cloudapi.DefaultAPIVersion, creds, cfg.logger)), api
+}
+
+// AddAccount adds an account to a double started by New and returns a client
+// authenticated as that account, with a key of its own registered as
+// KeyName, together with the double of the account. Client logging is
+// discarded.
+func AddAccount(t T, api *lc.CloudAPI, login string) (*cloudapi.Client, *lc.CloudAPI) {
+	account, err := api.AddAccount(login)
+	if err != nil {
+		t.Fatalf("testkit: cannot add account %s: %v", login, err)
+	}
+	creds := register(t, account)
+	account.ResetCalls()
+
+	logger := log.New(ioutil.Discard, "", log.LstdFlags)
+	return cloudapi.New(client.NewClient(creds.SdcEndpoint.URL, cloudapi.DefaultAPIVersion, creds, logger)), account
+}
+
+// register generates a key, registers it in the account of the double as
+// KeyName and returns the credentials signing with it.
+func register(t T, api *lc.CloudAPI) *auth.Credentials {
+	privateKey, err := rsa.GenerateKey(rand.Reader, keyBits)
+	if err != nil {
+		t.Fatalf("testkit: cannot generate key: %v", err)
+	}
+	privatePEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	})
+
+	authentication, err := auth.NewAuth(api.UserAccount, string(privatePEM), "rsa-sha256")
+	if err != nil {
+		t.Fatalf("testkit: cannot set up authentication: %v", err)
+	}
+
+	if _, err := api.CreateKey(KeyName, AuthorizedKey(&privateKey.PublicKey)); err != nil {
+		t.Fatalf("testkit: cannot register key: %v", err)
+	}
+
+	return &auth.Credentials{
+		UserAuthentication: authentication,
+		SdcKeyId:           KeyName,
+		SdcEndpoint:        auth.Endpoint{URL: api.URL()},
+	}
+}
+
+// AuthorizedKey encodes the public key in OpenSSH authorized_keys format, as
+// CreateKey expects it.
+func AuthorizedKey(key *rsa.PublicKey) string {
+	var wire []byte
+	wire = appendString(wire, []byte("ssh-rsa"))
+	wire = appendString(wire, mpint(big.NewInt(int64(key.E))))
+	wire = appendString(wire, mpint(key.N))
+	return "ssh-rsa " + base64.StdEncoding.EncodeToString(wire) + " " + KeyName
+}
+
+func appendString(buf, s []byte) []byte {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(s)))
+	return append(append(buf, length[:]...), s...)
+}
+
+// mpint returns the SSH wire encoding of a positive integer.
+func mpint(n *big.Int) []byte {
+	b := n.Bytes()
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
+}
@@ -0,0 +1,268 @@
+//
+// gosdc - Go library to interact with the Joyent CloudAPI
+//
+// Test kit tests
+//
+// Copyright (c) Joyent Inc.
+//
+
+package testkit_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joyent/gosdc/cloudapi"
+	lc "github.com/joyent/gosdc/localservices/cloudapi"
+	"github.com/joyent/gosdc/localservices/hook"
+	"github.com/joyent/gosdc/localservices/testkit"
+)
+
+func TestNewServesClient(t *testing.T) {
+	t.Parallel()
+
+	client, api := testkit.New(t)
+
+	keys, err := client.ListKeys()
+	if err != nil {
+		t.Fatalf("ListKeys: %v", err)
+	}
+	if len(keys) != 1 || keys[0].Name != testkit.KeyName {
+		t.Fatalf("expected only the %q key, got %v", testkit.KeyName, keys)
+	}
+	if api.UserAccount != testkit.DefaultAccount {
+		t.Fatalf("expected account %q, got %q", testkit.DefaultAccount, api.UserAccount)
+	}
+}
+
+func TestWithFixture(t *testing.T) {
+	t.Parallel()
+
+	client, _ := testkit.New(t,
+		testkit.WithAccount("fixtures"),
+		testkit.WithFixture(func(api *lc.CloudAPI) error {
+			_, err := api.CreateFirewallRule("FROM any TO all vms ALLOW tcp PORT 22", true)
+			return err
+		}),
+	)
+
+	rules, err := client.ListFirewallRules()
+	if err != nil {
+		t.Fatalf("ListFirewallRules: %v", err)
+	}
+	if len(rules) != 1 || !rules[0].Enabled {
+		t.Fatalf("expected the seeded firewall rule, got %v", rules)
+	}
+}
+
+func TestWithHook(t *testing.T) {
+	t.Parallel()
+
+	client, _ := testkit.New(t,
+		testkit.WithHook("ListNetworks", func(sc hook.ServiceControl, args ...interface{}) error {
+			return fmt.Errorf("networks unavailable")
+		}),
+	)
+
+	if _, err := client.ListNetworks(); err == nil {
+		t.Fatal("expected the hook to fail ListNetworks")
+	}
+	if _, err := client.ListPackages(cloudapi.NewFilter()); err != nil {
+		t.Fatalf("ListPackages: %v", err)
+	}
+}
+
+func TestWithHookStacks(t *testing.T) {
+	t.Parallel()
+
+	var calls []string
+	record := func(label string) hook.ControlProcessor {
+		return func(sc hook.ServiceControl, args ...interface{}) error {
+			calls = append(calls, label)
+			return nil
+		}
+	}
+	client, _ := testkit.New(t,
+		testkit.WithHook("ListNetworks", record("first")),
+		testkit.WithHook("ListNetworks", record("second")),
+	)
+
+	if _, err := client.ListNetworks(); err != nil {
+		t.Fatalf("ListNetworks: %v", err)
+	}
+	if len(calls) != 2 || calls[0] != "first" || calls[1] != "second" {
+		t.Fatalf("expected both hooks to run in order, got %v", calls)
+	}
+}
+
+func TestWithVerify(t *testing.T) {
+	t.Parallel()
+
+	client, api := testkit.New(t, testkit.WithVerify())
+	api.ExpectNotCalled("CreateKey")
+	list := api.ExpectCalled("ListPackages").Times(1)
+	api.ExpectCalled("GetPackage").With("Small").After(list)
+
+	if _, err := client.ListPackages(cloudapi.NewFilter()); err != nil {
+		t.Fatalf("ListPackages: %v", err)
+	}
+	if _, err := client.GetPackage("Small"); err != nil {
+		t.Fatalf("GetPackage: %v", err)
+	}
+}
+
+func TestRegion(t *testing.T) {
+	t.Parallel()
+
+	east, eastAPI := testkit.New(t)
+	_, westAPI := testkit.New(t)
+	lc.JoinRegion(map[string]*lc.CloudAPI{"us-east-1": eastAPI, "us-west-1": westAPI})
+
+	dcs, err := east.ListDatacenters()
+	if err != nil {
+		t.Fatalf("ListDatacenters: %v", err)
+	}
+	if len(dcs) != 2 || dcs["us-west-1"] == nil {
+		t.Fatalf("expected both datacenters of the region, got %v", dcs)
+	}
+}
+
+func TestAddAccount(t *testing.T) {
+	t.Parallel()
+
+	client, api := testkit.New(t)
+	bob, bobAPI := testkit.AddAccount(t, api, "bob")
+
+	if _, err := bob.CreateMachine(cloudapi.CreateMachineOpts{Package: "Small", Image: "11223344-0a0a-ff99-11bb-0a1b2c3d4e5f"}); err != nil {
+		t.Fatalf("CreateMachine: %v", err)
+	}
+	machines, err := client.ListMachines(nil)
+	if err != nil {
+		t.Fatalf("ListMachines: %v", err)
+	}
+	if len(machines) != 0 {
+		t.Fatalf("expected machines of other accounts to be hidden, got %v", machines)
+	}
+	if n, err := bobAPI.CountMachines(); err != nil || n != 1 {
+		t.Fatalf("expected bob to have a machine, got %d, %v", n, err)
+	}
+
+	if err := bobAPI.DeleteKey(testkit.KeyName); err != nil {
+		t.Fatalf("DeleteKey: %v", err)
+	}
+	if _, err := bob.ListKeys(); err == nil {
+		t.Fatal("expected the requests of bob to be signed by a key of bob")
+	}
+	if _, err := client.ListKeys(); err != nil {
+		t.Fatalf("ListKeys: %v", err)
+	}
+}
+
+func TestSignatures(t *testing.T) {
+	t.Parallel()
+
+	client, api := testkit.New(t)
+
+	if _, err := client.ListKeys(); err != nil {
+		t.Fatalf("ListKeys: %v", err)
+	}
+
+	api.SetClock(lc.NewFakeClock(time.Now().Add(time.Hour)))
+	if _, err := client.ListKeys(); err == nil {
+		t.Fatal("expected a stale Date header to be rejected")
+	}
+	api.SetClock(lc.NewFakeClock(time.Now()))
+
+	other, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	if err := api.DeleteKey(testkit.KeyName); err != nil {
+		t.Fatalf("DeleteKey: %v", err)
+	}
+	if _, err := client.ListKeys(); err == nil {
+		t.Fatal("expected a deleted key to be rejected")
+	}
+	if _, err := api.CreateKey(testkit.KeyName, testkit.AuthorizedKey(&other.PublicKey)); err != nil {
+		t.Fatalf("CreateKey: %v", err)
+	}
+	if _, err := client.ListKeys(); err == nil {
+		t.Fatal("expected a signature by a rotated key to be rejected")
+	}
+
+	api.RequireSignatures(false)
+	if _, err := client.ListKeys(); err != nil {
+		t.Fatalf("ListKeys: %v", err)
+	}
+}
+
+func TestWithFixtureFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "fixture.yaml")
+	fixture := "packages:\n  - name: Tiny\n    memory: 256\nkeys:\n  - name: deploy\n    key: ssh-rsa AAAA deploy@localhost\n"
+	if err := ioutil.WriteFile(path, []byte(fixture), 0600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	client, _ := testkit.New(t, testkit.WithFixtureFile(path))
+
+	pkgs, err := client.ListPackages(cloudapi.NewFilter())
+	if err != nil {
+		t.Fatalf("ListPackages: %v", err)
+	}
+	if len(pkgs) != 1 || pkgs[0].Name != "Tiny" {
+		t.Fatalf("expected only the Tiny package, got %v", pkgs)
+	}
+	keys, err := client.ListKeys()
+	if err != nil {
+		t.Fatalf("ListKeys: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected the fixture key and the kit key, got %v", keys)
+	}
+}
+
+func TestConcurrentClients(t *testing.T) {
+	t.Parallel()
+
+	const workers, machinesPerWorker = 8, 5
+	client, api := testkit.New(t)
+
+	t.Run("workers", func(t *testing.T) {
+		for w := 0; w < workers; w++ {
+			w := w
+			t.Run(fmt.Sprintf("worker-%d", w), func(t *testing.T) {
+				t.Parallel()
+				for i := 0; i < machinesPerWorker; i++ {
+					machine, err := client.CreateMachine(cloudapi.CreateMachineOpts{
+						Name:    fmt.Sprintf("worker-%d-%d", w, i),
+						Package: "Small",
+						Image:   "11223344-0a0a-ff99-11bb-0a1b2c3d4e5f",
+					})
+					if err != nil {
+						t.Fatalf("CreateMachine: %v", err)
+					}
+					if _, err := client.ListMachines(nil); err != nil {
+						t.Fatalf("ListMachines: %v", err)
+					}
+					if _, err := client.AddMachineTags(machine.Id, map[string]string{"worker": fmt.Sprint(w)}); err != nil {
+						t.Fatalf("AddMachineTags: %v", err)
+					}
+					if _, err := api.ListMachines(nil); err != nil {
+						t.Fatalf("ListMachines on the double: %v", err)
+					}
+				}
+			})
+		}
+	})
+
+	if n, err := api.CountMachines(); err != nil || n != workers*machinesPerWorker {
+		t.Fatalf("expected %d machines, got %d, %v", workers*machinesPerWorker, n, err)
+	}
+}